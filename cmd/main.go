@@ -25,6 +25,9 @@ var serverInitTaskList []startup.ServerTask = []startup.ServerTask{
 	////////////////////////
 	route.StartEncryption,
 	data.StartUsers,
+	data.StartSessions,
+	data.StartRoles,
+	data.StartOIDC,
 	data.StartRoomsSystem,
 	schedule.StartTaskQueue,
 	schedule.StartCronScheduler,
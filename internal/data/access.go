@@ -0,0 +1,441 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Game Visibility
+
+// Who can find and join a game
+//    public   :: listed in the lobby, anyone can join
+//    unlisted :: not listed in the lobby, anyone with the GameID can join
+//    private  :: not listed in the lobby, joined with an invite code or
+//                the game password
+const (
+	GameVisibilityPublic   string = "public"
+	GameVisibilityUnlisted string = "unlisted"
+	GameVisibilityPrivate  string = "private"
+)
+
+// Who can observe a game (see GetGameData)
+//    anyone  :: any logged in user
+//    roster  :: only players in the game
+//    friends :: players in the game and friends of the owner
+const (
+	GameObserversAnyone  string = "anyone"
+	GameObserversRoster  string = "roster"
+	GameObserversFriends string = "friends"
+)
+
+// Redis Field/Key for Game Metadata Visibility
+const MetadataSetVisibility string = "visibility"
+
+// Redis Field/Key for Game Metadata Observer Policy
+const MetadataSetObservers string = "observers"
+
+// Redis Field/Key for Game Metadata Password Checksum
+//    ("" if the game has no password)
+const MetadataSetPassword string = "password"
+
+// Maximum Length of a Game Password
+const GamePasswordMax int = 128
+
+// Redis Key Prefix for Game Password Attempt Counters. Concatenated
+// with a GameID and a UserID separated by a ":"
+const GamePasswordAttemptPrefix string = "gamePasswordAttempts:"
+
+// Game passwords a user may try for a game within
+// GamePasswordAttemptWindow. Further attempts are rejected without
+// checking the password.
+const GamePasswordAttempts int = 5
+
+// Time before a Game Password Attempt Counter resets
+const GamePasswordAttemptWindow time.Duration = 15 * time.Minute
+
+//
+// Invite Codes
+
+// Redis Hash Key Prefix for a game's invite codes. Concatenated with a
+// GameID. Maps each code to when it expires (seconds since epoch)
+const GameInvitePrefix string = "gameInvites:"
+
+// Time an invite code can be used
+const GameInviteLifetime time.Duration = 24 * time.Hour
+
+// Maximum Number of unexpired invite codes for a game
+const MaxGameInvites int = 50
+
+// Number of random bytes in an invite code
+const gameInviteBytes int = 6
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Game Access
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Game Settings Endpoint/Command. Empty fields are
+// left unchanged.
+type GameSettingsCommandBody struct {
+	GameID     string
+	Visibility string
+	Observers  string
+
+	// New game password. Requires a secure connection.
+	Password string
+
+	// Removes the game password
+	ClearPassword bool
+
+	// Invalidates every invite code for the game
+	RevokeInvites bool
+}
+
+// JSON Fields for the Game Invite Endpoint/Command
+type GameInviteCommandBody struct {
+	GameID string
+}
+
+// Response to the Game Invite Endpoint/Command
+type GameInvite struct {
+	GameID string
+	Code   string
+
+	// When the code stops working (seconds since epoch)
+	Expiry int64
+}
+
+// Game Settings Endpoint. The owner of a game may change who can find,
+// join, and observe it.
+func UpdateGameSettings(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := GameSettingsCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.Password != "" && !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	if (rqBody.Visibility != "" && !isValidGameVisibility(rqBody.Visibility)) ||
+		(rqBody.Observers != "" && !isValidGameObservers(rqBody.Observers)) ||
+		len(rqBody.Password) > GamePasswordMax {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	owner, err := getGameOwner(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if owner == "" {
+		return policy.UnSuccessfulResponse("Game Does Not Exist!")
+	} else if owner != header.UserID {
+		log.Printf("Unauthorized Attempt! User %s does not own game %s\n", header.UserID, rqBody.GameID)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	if rqBody.Visibility != "" {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+rqBody.GameID, MetadataSetVisibility, rqBody.Visibility))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+	}
+
+	if rqBody.Observers != "" {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+rqBody.GameID, MetadataSetObservers, rqBody.Observers))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+	}
+
+	if rqBody.ClearPassword {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HDEL", MetadataSetPrefix+rqBody.GameID, MetadataSetPassword))
+	} else if rqBody.Password != "" {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+rqBody.GameID,
+			MetadataSetPassword, hashGamePassword(rqBody.GameID, rqBody.Password)))
+	}
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	if rqBody.RevokeInvites {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", GameInvitePrefix+rqBody.GameID))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Game Invite Endpoint. The owner of a game may create invite codes
+// that let other players join it while it is private. Codes work until
+// they expire or are revoked (see UpdateGameSettings).
+func CreateGameInvite(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := GameInviteCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	owner, err := getGameOwner(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if owner == "" {
+		return policy.UnSuccessfulResponse("Game Does Not Exist!")
+	} else if owner != header.UserID {
+		log.Printf("Unauthorized Attempt! User %s does not own game %s\n", header.UserID, rqBody.GameID)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	numInvites, err := pruneGameInvites(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if numInvites >= MaxGameInvites {
+		return policy.UnSuccessfulResponse("Too Many Invites!")
+	}
+
+	codeBytes := make([]byte, gameInviteBytes)
+	_, err = rand.Read(codeBytes)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	invite := GameInvite{
+		GameID: rqBody.GameID,
+		Code:   hex.EncodeToString(codeBytes),
+		Expiry: time.Now().UTC().Add(GameInviteLifetime).Unix(),
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", GameInvitePrefix+rqBody.GameID, invite.Code, fmt.Sprintf("%d", invite.Expiry)))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   invite,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns whether a user may join a game. Private games need a valid
+// invite code or the game password. Each user may only try
+// GamePasswordAttempts passwords for a game within
+// GamePasswordAttemptWindow. Users already in the roster may always
+// rejoin.
+//
+// authID   :: Unique Identifier for the user joining
+// metadata :: metadata of the game
+// args     :: the Join Game request
+//
+// returns -> bool  :: true if the user may join
+//         -> error :: non-nil if the database could not be read
+func canJoinGame(authID string, metadata GameMetadata, args SelectGameArgs) (bool, error) {
+	if metadata.Visibility != GameVisibilityPrivate || metadata.Owner == authID {
+		return true, nil
+	}
+
+	isInGame, err := IsUserInGame(authID, metadata.Id)
+	if err != nil || isInGame {
+		return isInGame, err
+	}
+
+	if args.InviteCode != "" {
+		var expiryStr string
+		err = redis.MainRedis.Do(radix.Cmd(&expiryStr, "HGET", GameInvitePrefix+metadata.Id, args.InviteCode))
+		if err != nil {
+			return false, err
+		} else if expiryStr != "" {
+			expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+			if err != nil {
+				return false, err
+			}
+
+			return time.Now().UTC().Unix() < expiry, nil
+		}
+	}
+
+	if args.Password != "" {
+		allowed, err := countGamePasswordAttempt(authID, metadata.Id)
+		if err != nil || !allowed {
+			return false, err
+		}
+
+		var checksum string
+		err = redis.MainRedis.Do(radix.Cmd(&checksum, "HGET", MetadataSetPrefix+metadata.Id, MetadataSetPassword))
+		if err != nil {
+			return false, err
+		}
+
+		return checksum != "" && checksum == hashGamePassword(metadata.Id, args.Password), nil
+	}
+
+	return false, nil
+}
+
+// Counts a game password attempt by a user and returns whether it is
+// within GamePasswordAttempts.
+//
+// authID :: Unique Identifier for the user joining
+// gameID :: Unique Identifier for game in string form
+func countGamePasswordAttempt(authID string, gameID string) (bool, error) {
+	key := GamePasswordAttemptPrefix + gameID + ":" + authID
+
+	var count int
+	err := redis.MainRedis.Do(radix.Cmd(&count, "INCR", key))
+	if err != nil {
+		return false, err
+	}
+
+	if count == 1 {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "PEXPIRE", key, fmt.Sprintf("%d", GamePasswordAttemptWindow.Milliseconds())))
+		if err != nil {
+			return false, err
+		}
+	} else if count > GamePasswordAttempts {
+		log.Printf("Too Many Game Password Attempts! User %s Game %s\n", authID, gameID)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Returns whether a user may observe a game (see GetGameData)
+//
+// authID :: Unique Identifier for the user observing
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> bool  :: true if the user may observe
+//         -> error :: non-nil if the database could not be read
+func canObserveGame(authID string, gameID string) (bool, error) {
+	fields := make([]string, 2)
+	err := redis.MainRedis.Do(radix.Cmd(&fields, "HMGET", MetadataSetPrefix+gameID, MetadataSetOwner, MetadataSetObservers))
+	if err != nil {
+		return false, err
+	}
+
+	owner, observers := fields[0], fields[1]
+	if observers == "" || observers == GameObserversAnyone || authID == owner {
+		return true, nil
+	}
+
+	isInGame, err := IsUserInGame(authID, gameID)
+	if err != nil || isInGame || observers != GameObserversFriends {
+		return isInGame, err
+	}
+
+	return IsFriend(owner, authID)
+}
+
+// Removes the GameIDs of private games a user is not playing in. Used
+// so presence does not reveal private games.
+//
+// authID  :: Unique Identifier for the user viewing the games
+// gameIDs :: games to filter
+//
+// returns -> []string :: the games the user may see
+//         -> error    :: non-nil if the database could not be read
+func visibleGameIDs(authID string, gameIDs []string) ([]string, error) {
+	result := make([]string, 0, len(gameIDs))
+	for _, gameID := range gameIDs {
+		var visibility string
+		err := redis.MainRedis.Do(radix.Cmd(&visibility, "HGET", MetadataSetPrefix+gameID, MetadataSetVisibility))
+		if err != nil {
+			return nil, err
+		}
+
+		if visibility == GameVisibilityPrivate {
+			isInGame, err := IsUserInGame(authID, gameID)
+			if err != nil {
+				return nil, err
+			} else if !isInGame {
+				continue
+			}
+		}
+
+		result = append(result, gameID)
+	}
+
+	return result, nil
+}
+
+// Removes expired invite codes for a game
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> int   :: number of unexpired invite codes
+//         -> error :: non-nil if the database could not be read/written
+func pruneGameInvites(gameID string) (int, error) {
+	var invites map[string]string
+	err := redis.MainRedis.Do(radix.Cmd(&invites, "HGETALL", GameInvitePrefix+gameID))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC().Unix()
+	count := 0
+	for code, expiryStr := range invites {
+		expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+		if err == nil && now < expiry {
+			count++
+			continue
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HDEL", GameInvitePrefix+gameID, code))
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Returns the owner of a game or "" if the game does not exist
+func getGameOwner(gameID string) (string, error) {
+	var owner string
+	err := redis.MainRedis.Do(radix.Cmd(&owner, "HGET", MetadataSetPrefix+gameID, MetadataSetOwner))
+	return owner, err
+}
+
+// Checksum of a game password. Salted with the GameID so equal
+// passwords on different games do not match.
+func hashGamePassword(gameID string, password string) string {
+	checksum := sha512.Sum512([]byte(passHashSalt + gameID + ":" + password))
+	return hex.EncodeToString(checksum[:])
+}
+
+func isValidGameVisibility(visibility string) bool {
+	return visibility == GameVisibilityPublic || visibility == GameVisibilityUnlisted || visibility == GameVisibilityPrivate
+}
+
+func isValidGameObservers(observers string) bool {
+	return observers == GameObserversAnyone || observers == GameObserversRoster || observers == GameObserversFriends
+}
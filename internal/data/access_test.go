@@ -0,0 +1,179 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestPrivateGames(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-500"
+	playerIDs := []string{"-501", "-502", "-503"}
+	deleteGamesForUsers([]string{ownerID}, t)
+
+	metadata := createGameWithArgsForUser(t, ownerID, CreateGameCommandBody{
+		Visibility: GameVisibilityPrivate,
+		Password:   "SecretRoom",
+		Tags:       []string{"privatetest"},
+	})
+	if metadata.Id == "" || metadata.Visibility != GameVisibilityPrivate || metadata.Observers != GameObserversRoster {
+		t.Fatalf("Private Game was not created! Metadata: %v\n", metadata)
+	}
+
+	t.Run("Private Games Are Not Listed", func(t *testing.T) {
+		list := listGamesTestHelper(t, playerIDs[0], ListGamesCommandBody{Tags: []string{"privatetest"}})
+		if len(list.Games) != 0 {
+			t.Errorf("Private Game was Listed! Games: %v\n", list.Games)
+		}
+
+		list = listGamesTestHelper(t, ownerID, ListGamesCommandBody{Tags: []string{"privatetest"}})
+		if !sameGameIDs(list.Games, []string{metadata.Id}) {
+			t.Errorf("Private Game was not Listed for its Owner! Games: %v\n", list.Games)
+		}
+	})
+
+	t.Run("Joining Needs An Invite Or Password", func(t *testing.T) {
+		welcome, jsonResponse := joinGameForUser(playerIDs[0], metadata.Id, t)
+		if welcome.Id != "" {
+			t.Errorf("Joined a Private Game without an Invite! Response: %s\n", jsonResponse)
+		}
+
+		welcome = joinGameWithArgsForUser(t, playerIDs[0], SelectGameArgs{GameID: metadata.Id, Password: "WrongPassword"})
+		if welcome.Id != "" {
+			t.Errorf("Joined a Private Game with the Wrong Password!\n")
+		}
+
+		welcome = joinGameWithArgsForUser(t, playerIDs[0], SelectGameArgs{GameID: metadata.Id, Password: "SecretRoom"})
+		if welcome.Id != metadata.Id {
+			t.Errorf("Could not Join a Private Game with its Password!\n")
+		}
+
+		invite := createGameInviteTestHelper(t, ownerID, metadata.Id)
+		welcome = joinGameWithArgsForUser(t, playerIDs[1], SelectGameArgs{GameID: metadata.Id, InviteCode: invite.Code})
+		if welcome.Id != metadata.Id {
+			t.Errorf("Could not Join a Private Game with an Invite!\n")
+		}
+	})
+
+	t.Run("Password Attempts Are Limited", func(t *testing.T) {
+		attemptKey := GamePasswordAttemptPrefix + metadata.Id + ":" + playerIDs[2]
+		defer redis.MainRedis.Do(radix.Cmd(nil, "DEL", attemptKey))
+
+		for i := 0; i < GamePasswordAttempts; i++ {
+			joinGameWithArgsForUser(t, playerIDs[2], SelectGameArgs{GameID: metadata.Id, Password: "WrongPassword"})
+		}
+
+		welcome := joinGameWithArgsForUser(t, playerIDs[2], SelectGameArgs{GameID: metadata.Id, Password: "SecretRoom"})
+		if welcome.Id != "" {
+			t.Errorf("Joined a Private Game after Too Many Password Attempts!\n")
+		}
+
+		var ttl int64
+		err := redis.MainRedis.Do(radix.Cmd(&ttl, "PTTL", attemptKey))
+		if err != nil {
+			t.Errorf("Error Reading Attempt Counter! Err: %v\n", err)
+		} else if ttl <= 0 {
+			t.Errorf("Password Attempt Counter does not Expire!\n")
+		}
+	})
+
+	t.Run("Only Owners Create Invites", func(t *testing.T) {
+		invite := createGameInviteTestHelper(t, playerIDs[0], metadata.Id)
+		if invite.Code != "" {
+			t.Errorf("A Player Created an Invite to a Game they do not own!\n")
+		}
+	})
+
+	t.Run("Observers Follow The Game Settings", func(t *testing.T) {
+		observeTests := []struct {
+			observers string
+			userID    string
+			expected  bool
+		}{
+			{GameObserversRoster, playerIDs[0], true},
+			{GameObserversRoster, playerIDs[2], false},
+			{GameObserversFriends, playerIDs[2], true},
+			{GameObserversAnyone, "-504", true},
+		}
+
+		err := redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendSetPrefix+ownerID, playerIDs[2]))
+		if err != nil {
+			t.Fatalf("Error Adding Friend! Err: %v\n", err)
+		}
+		defer redis.MainRedis.Do(radix.Cmd(nil, "DEL", FriendSetPrefix+ownerID))
+
+		for _, test := range observeTests {
+			gameSettingsTestHelper(t, ownerID, GameSettingsCommandBody{GameID: metadata.Id, Observers: test.observers})
+
+			canObserve, err := canObserveGame(test.userID, metadata.Id)
+			if err != nil {
+				t.Fatalf("Error Checking Observers! Err: %v\n", err)
+			} else if canObserve != test.expected {
+				t.Errorf("User %s Observing with %s was %t instead of %t!\n", test.userID, test.observers, canObserve, test.expected)
+			}
+		}
+	})
+
+	t.Run("Revoked Invites Do Not Work", func(t *testing.T) {
+		invite := createGameInviteTestHelper(t, ownerID, metadata.Id)
+		gameSettingsTestHelper(t, ownerID, GameSettingsCommandBody{GameID: metadata.Id, RevokeInvites: true, ClearPassword: true})
+
+		welcome := joinGameWithArgsForUser(t, playerIDs[2], SelectGameArgs{GameID: metadata.Id, InviteCode: invite.Code})
+		if welcome.Id != "" {
+			t.Errorf("Joined a Private Game with a Revoked Invite!\n")
+		}
+
+		welcome = joinGameWithArgsForUser(t, playerIDs[2], SelectGameArgs{GameID: metadata.Id, Password: "SecretRoom"})
+		if welcome.Id != "" {
+			t.Errorf("Joined a Private Game with a Cleared Password!\n")
+		}
+	})
+
+	deleteGamesForUsers([]string{ownerID}, t)
+}
+
+func joinGameWithArgsForUser(t *testing.T, userID string, args SelectGameArgs) GameWelcomeData {
+	request, err := policy.RequestWithUserForTesting(userID, false, policy.CmdGameJoin, args)
+	if err != nil {
+		t.Errorf("Error Creating Request Payload for joining Game!")
+	}
+
+	response := JoinGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Got Error From Join Game Request! Err: %v\n", response.ServerError)
+	}
+
+	var welcomeData GameWelcomeData
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response From Join Game! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &welcomeData)
+
+	return welcomeData
+}
+
+func createGameInviteTestHelper(t *testing.T, userID string, gameID string) GameInvite {
+	var invite GameInvite
+	endpointTestHelper(t, userID, policy.CmdGameInvite, CreateGameInvite, GameInviteCommandBody{GameID: gameID}, &invite)
+	return invite
+}
+
+func gameSettingsTestHelper(t *testing.T, userID string, body GameSettingsCommandBody) {
+	success := commandTestHelper(t, userID, policy.CmdGameConfig, UpdateGameSettings, body)
+	if !success.Successful {
+		t.Errorf("Game Settings were not Updated! Err: %s\n", success.Err)
+	}
+}
@@ -0,0 +1,426 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// API Key Tables
+
+// Redis HashTable Key Prefix for API Keys. Concatenated with the hex
+// sha256 of a key. The key itself is never stored.
+const APIKeyPrefix string = "apiKey:"
+
+// Redis HashTable Key Prefix for the API Keys of a user. Concatenated
+// with a UserID. Maps Key IDs to the hashed keys.
+const APIKeyUserSetPrefix string = "apiKeys:"
+
+// Fields for the Redis API Key HashTable
+const (
+	APIKeyUserIDField   string = "userID"
+	APIKeyIDField       string = "keyID"
+	APIKeyNameField     string = "name"
+	APIKeyCommandsField string = "commands"
+	APIKeyExpiryField   string = "expiry"
+	APIKeyIPField       string = "ip"
+	APIKeyCreatedField  string = "created"
+)
+
+//
+// API Key Limits
+
+// Prefix of every API Key. Makes keys easy to spot (i.e. in leaked logs)
+const APIKeyTokenPrefix string = "lak_"
+
+// Number of random bytes in an API Key
+const apiKeyLen int = 32
+
+// Number of hex characters of the hashed key used as its Key ID
+const apiKeyIDLen int = 16
+
+// Maximum number of API Keys a user can have
+const MaxAPIKeys int = 20
+
+// Maximum Length (in bytes) of an API Key Name
+const APIKeyNameMax int = 64
+
+// Command Codes an API Key may be created for. Command Codes belong to
+// route, so route fills this on startup from the commands it accepts
+// API Keys for.
+//
+// This Map is a Set!
+var APIKeyCommandCodes map[int64]bool = map[int64]bool{}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// API Keys
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Create API Key Endpoint/Command
+type CreateAPIKeyCommandBody struct {
+	Name string
+
+	// TCP Command Codes (see the policy.ClientCmd enum) the key may be
+	// used for. Each must be in APIKeyCommandCodes
+	Commands []int64
+
+	// Unix time (seconds) the key stops working. 0 never expires
+	Expiry int64
+
+	// IP Address or CIDR Range the key may be used from. Empty allows
+	// any address
+	IP string
+}
+
+// JSON Fields for the Revoke API Key Endpoint/Command
+type RevokeAPIKeyCommandBody struct {
+	KeyID string
+}
+
+// Information about an API Key. The key itself is only sent once when
+// it is created (see CreatedAPIKey).
+type APIKeyInfo struct {
+	KeyID    string
+	Name     string
+	Commands []int64
+	Expiry   int64  `json:",omitempty"`
+	IP       string `json:",omitempty"`
+	Created  int64
+}
+
+// Response to the Create API Key Endpoint/Command
+type CreatedAPIKey struct {
+	Key string
+	APIKeyInfo
+}
+
+// List of a user's API Keys
+type APIKeyList struct {
+	Keys []APIKeyInfo
+}
+
+// Create API Key Endpoint. Makes a long lived key for the request's user
+// limited to a list of commands. The key is only sent in this response.
+func CreateAPIKey(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := CreateAPIKeyCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	for _, code := range rqBody.Commands {
+		if !APIKeyCommandCodes[code] {
+			return policy.UnSuccessfulResponse("Bad Arguments!")
+		}
+	}
+
+	if len(rqBody.Name) > APIKeyNameMax || len(rqBody.Commands) == 0 {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	} else if rqBody.Expiry != 0 && time.Unix(rqBody.Expiry, 0).Before(time.Now().UTC()) {
+		return policy.UnSuccessfulResponse("Expiry Has Already Passed!")
+	} else if rqBody.IP != "" && !isValidIPRestriction(rqBody.IP) {
+		return policy.UnSuccessfulResponse("Invalid IP Address!")
+	}
+
+	var count int
+	err = redis.MainRedis.Do(radix.Cmd(&count, "HLEN", APIKeyUserSetPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if count >= MaxAPIKeys {
+		return policy.UnSuccessfulResponse("Too Many API Keys!")
+	}
+
+	byteTemp := make([]byte, apiKeyLen)
+	n, err := rand.Read(byteTemp)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if n < apiKeyLen {
+		return policy.RespWithError(errors.New("rand.Read did not return full API Key!"))
+	}
+
+	key := APIKeyTokenPrefix + base64.RawURLEncoding.EncodeToString(byteTemp)
+	keyHash := hashAPIKey(key)
+
+	info := APIKeyInfo{
+		KeyID:    keyHash[:apiKeyIDLen],
+		Name:     rqBody.Name,
+		Commands: rqBody.Commands,
+		Expiry:   rqBody.Expiry,
+		IP:       rqBody.IP,
+		Created:  time.Now().UTC().Unix(),
+	}
+
+	commands := make([]string, len(info.Commands))
+	for i, code := range info.Commands {
+		commands[i] = fmt.Sprintf("%d", code)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", APIKeyPrefix+keyHash,
+		APIKeyUserIDField, header.UserID,
+		APIKeyIDField, info.KeyID,
+		APIKeyNameField, info.Name,
+		APIKeyCommandsField, strings.Join(commands, ","),
+		APIKeyExpiryField, fmt.Sprintf("%d", info.Expiry),
+		APIKeyIPField, info.IP,
+		APIKeyCreatedField, fmt.Sprintf("%d", info.Created)))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", APIKeyUserSetPrefix+header.UserID, info.KeyID, keyHash))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   CreatedAPIKey{Key: key, APIKeyInfo: info},
+		Digest: json.Marshal,
+	}
+}
+
+// List API Keys Endpoint. Returns the request's user's API Keys (without
+// the keys themselves). Expired keys are removed.
+func ListAPIKeys(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	var keyHashes map[string]string
+	err = redis.MainRedis.Do(radix.Cmd(&keyHashes, "HGETALL", APIKeyUserSetPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	list := APIKeyList{Keys: make([]APIKeyInfo, 0, len(keyHashes))}
+	now := time.Now().UTC().Unix()
+	for keyID, keyHash := range keyHashes {
+		info, _, err := loadAPIKey(keyHash)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		if info.KeyID == "" || (info.Expiry != 0 && info.Expiry < now) {
+			err = revokeAPIKey(header.UserID, keyID)
+			if err != nil {
+				return policy.RespWithError(err)
+			}
+
+			continue
+		}
+
+		list.Keys = append(list.Keys, info)
+	}
+
+	return policy.CommandResponse{
+		Data:   list,
+		Digest: json.Marshal,
+	}
+}
+
+// Revoke API Key Endpoint. The key stops working immediately.
+func RevokeAPIKey(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := RevokeAPIKeyCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var exists int
+	err = redis.MainRedis.Do(radix.Cmd(&exists, "HEXISTS", APIKeyUserSetPrefix+header.UserID, rqBody.KeyID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if exists == 0 {
+		return policy.UnSuccessfulResponse("API Key Does Not Exist!")
+	}
+
+	err = revokeAPIKey(header.UserID, rqBody.KeyID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditTokenRevoked, header.UserID, AuditSuccess, "API Key "+rqBody.KeyID)
+	return policy.SuccessfulResponse()
+}
+
+// Verifies a request made with an API Key. Used by SigVerification
+// in place of a signature.
+//
+// key    :: the API Key sent with the request
+// authID :: Unique Identifier the request claims to be from
+// code   :: TCP Command Code of the request
+// ip     :: IP Address the request came from
+//
+// returns -> error :: non-nil if the request must be rejected
+func VerifyAPIKey(key string, authID string, code int64, ip string) error {
+	if !strings.HasPrefix(key, APIKeyTokenPrefix) {
+		return errors.New("Malformed API Key!")
+	}
+
+	info, userID, err := loadAPIKey(hashAPIKey(key))
+	if err != nil {
+		return err
+	} else if info.KeyID == "" {
+		return errors.New("Unknown API Key!")
+	} else if userID != authID {
+		return errors.New("API Key Does Not Belong To User!")
+	} else if info.Expiry != 0 && time.Unix(info.Expiry, 0).Before(time.Now().UTC()) {
+		return errors.New("API Key Is Expired!")
+	} else if info.IP != "" && !ipMatches(info.IP, ip) {
+		return errors.New("API Key Can Not Be Used From " + ip)
+	}
+
+	for _, allowed := range info.Commands {
+		if allowed == code {
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("API Key Can Not Be Used For Command %d", code))
+}
+
+// Revokes every API Key of a user. Used when the user is removed.
+//
+// authID :: Unique Identifier for a user
+func deleteAPIKeys(authID string) error {
+	var keyHashes []string
+	err := redis.MainRedis.Do(radix.Cmd(&keyHashes, "HVALS", APIKeyUserSetPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	for _, keyHash := range keyHashes {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", APIKeyPrefix+keyHash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", APIKeyUserSetPrefix+authID))
+}
+
+// Removes one of a user's API Keys.
+//
+// authID :: Unique Identifier for a user
+// keyID  :: Key ID of the API Key
+func revokeAPIKey(authID string, keyID string) error {
+	var keyHash string
+	err := redis.MainRedis.Do(radix.Cmd(&keyHash, "HGET", APIKeyUserSetPrefix+authID, keyID))
+	if err != nil {
+		return err
+	}
+
+	if keyHash != "" {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", APIKeyPrefix+keyHash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "HDEL", APIKeyUserSetPrefix+authID, keyID))
+}
+
+// Loads an API Key from the database.
+//
+// keyHash :: hex sha256 of the API Key
+//
+// returns -> APIKeyInfo :: the key's information (empty KeyID if the
+//                          key does not exist)
+//         -> string     :: the UserID the key belongs to
+//         -> error      :: non-nil if the database could not be read
+func loadAPIKey(keyHash string) (APIKeyInfo, string, error) {
+	var fields map[string]string
+	err := redis.MainRedis.Do(radix.Cmd(&fields, "HGETALL", APIKeyPrefix+keyHash))
+	if err != nil || len(fields) == 0 {
+		return APIKeyInfo{}, "", err
+	}
+
+	info := APIKeyInfo{
+		KeyID: fields[APIKeyIDField],
+		Name:  fields[APIKeyNameField],
+		IP:    fields[APIKeyIPField],
+	}
+
+	info.Expiry, _ = strconv.ParseInt(fields[APIKeyExpiryField], 10, 64)
+	info.Created, _ = strconv.ParseInt(fields[APIKeyCreatedField], 10, 64)
+
+	for _, codeStr := range strings.Split(fields[APIKeyCommandsField], ",") {
+		code, err := strconv.ParseInt(codeStr, 10, 64)
+		if err == nil {
+			info.Commands = append(info.Commands, code)
+		}
+	}
+
+	return info, fields[APIKeyUserIDField], nil
+}
+
+// Returns the hex sha256 of an API Key
+func hashAPIKey(key string) string {
+	hashed := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hashed[:])
+}
+
+// Returns whether an IP restriction is an IP Address or CIDR Range
+func isValidIPRestriction(restriction string) bool {
+	if net.ParseIP(restriction) != nil {
+		return true
+	}
+
+	_, _, err := net.ParseCIDR(restriction)
+	return err == nil
+}
+
+// Returns whether an IP Address is allowed by an IP restriction
+//
+// restriction :: IP Address or CIDR Range
+// ip          :: IP Address to check
+func ipMatches(restriction string, ip string) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	_, network, err := net.ParseCIDR(restriction)
+	if err == nil {
+		return network.Contains(parsedIP)
+	}
+
+	return parsedIP.Equal(net.ParseIP(restriction))
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+)
+
+// TCP Command Codes used in API Key testing
+const testGameCreateCode int64 = 1<<9 + 0
+const testGameJoinCode int64 = 1<<9 + 1
+
+func TestAPIKeys(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "APIKEY"
+	otherUsername := testUserNamePrefix + "APIKEYOTHER"
+	password := "SomeP@ssword123"
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, otherUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	otherID := getUserTestHelper(t, otherUsername)
+	deleteAPIKeys(authID)
+
+	// Route fills these on startup
+	APIKeyCommandCodes[testGameCreateCode] = true
+	defer delete(APIKeyCommandCodes, testGameCreateCode)
+
+	t.Run("Unknown Commands Are Rejected", func(t *testing.T) {
+		rejected := createAPIKeyTestHelper(t, authID, CreateAPIKeyCommandBody{Commands: []int64{testGameCreateCode, testGameJoinCode}})
+		if rejected.Key != "" {
+			t.Errorf("API Key was Created for a Command it can not be Used With!\n")
+		}
+	})
+
+	created := createAPIKeyTestHelper(t, authID, CreateAPIKeyCommandBody{
+		Name:     "Matchmaking Bot",
+		Commands: []int64{testGameCreateCode},
+		IP:       "192.0.2.0/24",
+	})
+	if created.Key == "" {
+		t.Fatalf("API Key was not created!\n")
+	}
+
+	keyTests := []struct {
+		name     string
+		authID   string
+		code     int64
+		ip       string
+		expected bool
+	}{
+		{"Allowed Command", authID, testGameCreateCode, "192.0.2.10", true},
+		{"Other Command", authID, testGameJoinCode, "192.0.2.10", false},
+		{"Other User", otherID, testGameCreateCode, "192.0.2.10", false},
+		{"Other IP Address", authID, testGameCreateCode, "198.51.100.1", false},
+	}
+
+	for _, test := range keyTests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyAPIKey(created.Key, test.authID, test.code, test.ip)
+			if test.expected && err != nil {
+				t.Errorf("Valid API Key Use was Rejected! Err: %v\n", err)
+			} else if !test.expected && err == nil {
+				t.Errorf("Invalid API Key Use was Accepted!\n")
+			}
+		})
+	}
+
+	t.Run("Expired Keys Are Rejected", func(t *testing.T) {
+		expiring := createAPIKeyTestHelper(t, authID, CreateAPIKeyCommandBody{
+			Commands: []int64{testGameCreateCode},
+			Expiry:   time.Now().UTC().Add(time.Second).Unix(),
+		})
+
+		time.Sleep(2 * time.Second)
+		err := VerifyAPIKey(expiring.Key, authID, testGameCreateCode, "")
+		if err == nil {
+			t.Errorf("Expired API Key was Accepted!\n")
+		}
+
+		list := listAPIKeysTestHelper(t, authID)
+		if len(list.Keys) != 1 || list.Keys[0].KeyID != created.KeyID {
+			t.Errorf("Expected only the unexpired key! Keys: %v\n", list.Keys)
+		}
+	})
+
+	t.Run("Revoked Keys Are Rejected", func(t *testing.T) {
+		req, err := policy.RequestWithUserForTesting(authID, false, policy.CmdKeyRevoke, RevokeAPIKeyCommandBody{KeyID: created.KeyID})
+		if err != nil {
+			t.Errorf("Failure to create Request! Err: %v\n", err)
+		}
+
+		response := RevokeAPIKey(req.Header, req.BodyFactories, req.IsSecureConnection)
+		if response.ServerError != nil {
+			t.Fatalf("Failure to Revoke API Key! Err: %v\n", response.ServerError)
+		}
+
+		err = VerifyAPIKey(created.Key, authID, testGameCreateCode, "192.0.2.10")
+		if err == nil {
+			t.Errorf("Revoked API Key was Accepted!\n")
+		}
+
+		list := listAPIKeysTestHelper(t, authID)
+		if len(list.Keys) != 0 {
+			t.Errorf("Revoked API Key was Listed! Keys: %v\n", list.Keys)
+		}
+	})
+
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+}
+
+func createAPIKeyTestHelper(t *testing.T, userID string, body CreateAPIKeyCommandBody) CreatedAPIKey {
+	var created CreatedAPIKey
+	endpointTestHelper(t, userID, policy.CmdKeyCreate, CreateAPIKey, body, &created)
+	return created
+}
+
+func listAPIKeysTestHelper(t *testing.T, userID string) APIKeyList {
+	var list APIKeyList
+	endpointTestHelper(t, userID, policy.CmdKeyList, ListAPIKeys, nil, &list)
+	return list
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Audit Log Configurables
+
+// Redis Key for the Audit Log Stream
+const AuditStreamName string = "auditLog"
+
+// Approximate number of events kept in the Audit Log. Older events are
+// trimmed as new ones are added.
+var AuditLogMaxLen int64 = 100000
+
+// Time events are kept in the Audit Log (see TrimAuditLog)
+var AuditLogRetention time.Duration = 90 * 24 * time.Hour
+
+// Number of events read at a time when querying or trimming the Audit Log
+const AuditLogBatchSize int = 500
+
+// Default and Maximum number of events returned by an Audit Log Query
+const (
+	AuditQueryDefaultLimit int = 100
+	AuditQueryMaxLimit     int = 1000
+)
+
+//
+// Audit Events
+
+// Types of Audit Events
+const (
+	AuditRegister         string = "register"
+	AuditLogin            string = "login"
+	AuditSignatureFailure string = "signatureFailure"
+	AuditTokenRevoked     string = "tokenRevoked"
+	AuditGameDeleted      string = "gameDeleted"
+	AuditAdminAction      string = "adminAction"
+)
+
+// Outcomes of Audit Events
+const (
+	AuditSuccess string = "success"
+	AuditFailure string = "failure"
+)
+
+// Fields for the Redis Audit Log Stream
+const (
+	auditEventField   string = "event"
+	auditActorField   string = "actor"
+	auditTargetField  string = "target"
+	auditIPField      string = "ip"
+	auditOutcomeField string = "outcome"
+	auditDetailField  string = "detail"
+)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Audit Log
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// An entry in the Audit Log
+type AuditEvent struct {
+	// Stream ID of the event (filled in when read)
+	ID string `json:",omitempty"`
+
+	// Time (milliseconds since epoch) of the event (filled in when read)
+	Time int64 `json:",omitempty"`
+
+	Event string
+
+	// UserID who made the request ("" if not logged in)
+	Actor string `json:",omitempty"`
+
+	// What the event happened to (i.e. a UserID, username, or GameID)
+	Target string `json:",omitempty"`
+
+	IP      string `json:",omitempty"`
+	Outcome string
+	Detail  string `json:",omitempty"`
+}
+
+// JSON Fields for the Audit Log Query Endpoint/Command. Empty fields
+// are not filtered on.
+type AuditQueryCommandBody struct {
+	// Only events where this UserID is the actor or target
+	UserID string
+
+	// Only events of this type (i.e. AuditLogin)
+	Event string
+
+	// Time range (milliseconds since epoch)
+	Since int64
+	Until int64
+
+	// Maximum number of events (see AuditQueryMaxLimit)
+	Limit int
+}
+
+// Response to the Audit Log Query Endpoint/Command. Events are newest
+// first.
+type AuditLog struct {
+	Events []AuditEvent
+}
+
+// Audit Log Query Endpoint. Administrators may read the Audit Log
+// filtered by user, event type, and time range.
+func QueryAuditLog(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := AuditQueryCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	limit := rqBody.Limit
+	if limit <= 0 {
+		limit = AuditQueryDefaultLimit
+	} else if limit > AuditQueryMaxLimit {
+		limit = AuditQueryMaxLimit
+	}
+
+	start := "-"
+	if rqBody.Since > 0 {
+		start = fmt.Sprintf("%d", rqBody.Since)
+	}
+
+	end := "+"
+	if rqBody.Until > 0 {
+		end = fmt.Sprintf("%d", rqBody.Until)
+	}
+
+	result := AuditLog{Events: make([]AuditEvent, 0)}
+	for len(result.Events) < limit {
+		var entries []radix.StreamEntry
+		err = redis.MainRedis.Do(radix.Cmd(&entries, "XREVRANGE", AuditStreamName, end, start,
+			"COUNT", fmt.Sprintf("%d", AuditLogBatchSize)))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		for _, entry := range entries {
+			event := auditEventFromEntry(entry)
+			if rqBody.Event != "" && event.Event != rqBody.Event {
+				continue
+			} else if rqBody.UserID != "" && event.Actor != rqBody.UserID && event.Target != rqBody.UserID {
+				continue
+			}
+
+			result.Events = append(result.Events, event)
+			if len(result.Events) >= limit {
+				break
+			}
+		}
+
+		if len(entries) < AuditLogBatchSize {
+			break
+		}
+
+		last := entries[len(entries)-1].ID
+		if last.Time == 0 && last.Seq == 0 {
+			break
+		}
+		end = last.Prev().String()
+	}
+
+	return policy.CommandResponse{
+		Data:   result,
+		Digest: json.Marshal,
+	}
+}
+
+// Adds an event to the Audit Log. Errors are logged since auditing
+// should never reject a request.
+//
+// event :: the event to add (ID and Time are set by the stream)
+func RecordAudit(event AuditEvent) {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "XADD", AuditStreamName, "MAXLEN", "~", fmt.Sprintf("%d", AuditLogMaxLen), "*",
+		auditEventField, event.Event,
+		auditActorField, event.Actor,
+		auditTargetField, event.Target,
+		auditIPField, event.IP,
+		auditOutcomeField, event.Outcome,
+		auditDetailField, event.Detail))
+	if err != nil {
+		log.Printf("Error Recording Audit Event! Event: %s\tErr: %v\n", event.Event, err)
+	}
+}
+
+// Adds an event for a request to the Audit Log. The actor and IP Address
+// are taken from the request header.
+//
+// header  :: header of the request
+// event   :: type of event (i.e. AuditLogin)
+// target  :: what the event happened to
+// outcome :: AuditSuccess or AuditFailure
+// detail  :: extra information (must not hold secrets)
+func auditRequest(header policy.RequestHeader, event string, target string, outcome string, detail string) {
+	RecordAudit(AuditEvent{
+		Event:   event,
+		Actor:   header.UserID,
+		Target:  target,
+		IP:      header.RemoteAddr,
+		Outcome: outcome,
+		Detail:  detail,
+	})
+}
+
+// Removes events older than AuditLogRetention from the Audit Log. Meant
+// to be run periodically by the scheduler.
+//
+// returns -> int   :: number of events removed
+//         -> error :: non-nil if the database could not be read/written
+func TrimAuditLog() (int, error) {
+	cutoff := fmt.Sprintf("%d", time.Now().UTC().Add(-AuditLogRetention).UnixNano()/int64(time.Millisecond))
+	removed := 0
+
+	for {
+		var entries []radix.StreamEntry
+		err := redis.MainRedis.Do(radix.Cmd(&entries, "XRANGE", AuditStreamName, "-", cutoff,
+			"COUNT", fmt.Sprintf("%d", AuditLogBatchSize)))
+		if err != nil {
+			return removed, err
+		} else if len(entries) == 0 {
+			return removed, nil
+		}
+
+		args := []string{AuditStreamName}
+		for _, entry := range entries {
+			args = append(args, entry.ID.String())
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "XDEL", args...))
+		if err != nil {
+			return removed, err
+		}
+
+		removed += len(entries)
+	}
+}
+
+// Converts a Redis Stream Entry to an AuditEvent
+func auditEventFromEntry(entry radix.StreamEntry) AuditEvent {
+	return AuditEvent{
+		ID:      entry.ID.String(),
+		Time:    int64(entry.ID.Time),
+		Event:   entry.Fields[auditEventField],
+		Actor:   entry.Fields[auditActorField],
+		Target:  entry.Fields[auditTargetField],
+		IP:      entry.Fields[auditIPField],
+		Outcome: entry.Fields[auditOutcomeField],
+		Detail:  entry.Fields[auditDetailField],
+	}
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+)
+
+func TestAuditLog(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	adminUsername := testUserNamePrefix + "AUDITADMIN"
+	playerUsername := testUserNamePrefix + "AUDITPLAYER"
+	password := "SomeP@ssword123"
+	DeleteUser(adminUsername)
+	DeleteUser(playerUsername)
+
+	createUserSuccess(t, adminUsername, password)
+	createUserSuccess(t, playerUsername, password)
+	adminID := getUserTestHelper(t, adminUsername)
+	playerID := getUserTestHelper(t, playerUsername)
+
+	err := SetRole(adminID, RoleAdmin)
+	if err != nil {
+		t.Fatalf("Error Setting Role! Err: %v\n", err)
+	}
+
+	before := time.Now().UTC().UnixNano() / int64(time.Millisecond)
+	RecordAudit(AuditEvent{Event: AuditTokenRevoked, Actor: playerID, Target: playerID, Outcome: AuditSuccess})
+	RecordAudit(AuditEvent{Event: AuditGameDeleted, Actor: playerID, Target: "someGame", Outcome: AuditSuccess})
+
+	t.Run("Players Can Not Query", func(t *testing.T) {
+		log := auditQueryTestHelper(t, playerID, AuditQueryCommandBody{UserID: playerID})
+		if len(log.Events) != 0 {
+			t.Errorf("Player Read the Audit Log!\n")
+		}
+	})
+
+	t.Run("Queries Filter By User", func(t *testing.T) {
+		log := auditQueryTestHelper(t, adminID, AuditQueryCommandBody{UserID: playerID, Since: before})
+		if len(log.Events) != 2 {
+			t.Fatalf("Expected 2 Events but got %d! Events: %v\n", len(log.Events), log.Events)
+		} else if log.Events[0].Event != AuditGameDeleted {
+			t.Errorf("Events were not newest first! Events: %v\n", log.Events)
+		}
+	})
+
+	t.Run("Queries Filter By Event", func(t *testing.T) {
+		log := auditQueryTestHelper(t, adminID, AuditQueryCommandBody{UserID: playerID, Event: AuditTokenRevoked, Since: before})
+		if len(log.Events) != 1 || log.Events[0].Event != AuditTokenRevoked {
+			t.Errorf("Expected 1 %s Event! Events: %v\n", AuditTokenRevoked, log.Events)
+		}
+	})
+
+	t.Run("Queries Filter By Time", func(t *testing.T) {
+		log := auditQueryTestHelper(t, adminID, AuditQueryCommandBody{UserID: playerID, Until: before - 1})
+		for _, event := range log.Events {
+			if event.Time >= before {
+				t.Errorf("Event After Until was Returned! Event: %v\n", event)
+			}
+		}
+	})
+
+	t.Run("Admin Actions Are Recorded", func(t *testing.T) {
+		setRoleTestHelper(t, adminID, playerID, RoleModerator)
+
+		log := auditQueryTestHelper(t, adminID, AuditQueryCommandBody{UserID: playerID, Event: AuditAdminAction, Since: before})
+		if len(log.Events) != 1 || log.Events[0].Actor != adminID {
+			t.Errorf("Set Role was not Recorded! Events: %v\n", log.Events)
+		}
+	})
+
+	t.Run("Old Events Are Trimmed", func(t *testing.T) {
+		oldRetention := AuditLogRetention
+		AuditLogRetention = 0
+		defer func() { AuditLogRetention = oldRetention }()
+
+		_, err := TrimAuditLog()
+		if err != nil {
+			t.Fatalf("Error Trimming Audit Log! Err: %v\n", err)
+		}
+
+		log := auditQueryTestHelper(t, adminID, AuditQueryCommandBody{UserID: playerID})
+		if len(log.Events) != 0 {
+			t.Errorf("Old Events were not Trimmed! Events: %v\n", log.Events)
+		}
+	})
+
+	DeleteUser(adminUsername)
+	DeleteUser(playerUsername)
+}
+
+func auditQueryTestHelper(t *testing.T, userID string, body AuditQueryCommandBody) AuditLog {
+	var log AuditLog
+	endpointTestHelper(t, userID, policy.CmdAuditQuery, QueryAuditLog, body, &log)
+	return log
+}
@@ -1,10 +1,13 @@
 package data
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
 )
 
 var (
@@ -21,3 +24,41 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+// Sends a request from a user to an endpoint and unmarshals the response
+// into result (see requestTestHelper)
+func endpointTestHelper(t *testing.T, userID string, cmd policy.ClientCmd, endpoint func(policy.RequestHeader, policy.RequestBodyFactories, bool) policy.CommandResponse, body interface{}, result interface{}) {
+	request, err := policy.RequestWithUserForTesting(userID, false, cmd, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	requestTestHelper(t, request, endpoint, result)
+}
+
+// Sends a request to an endpoint and unmarshals the response into
+// result. Raw responses which are not JSON (i.e. sessions) leave
+// result empty.
+func requestTestHelper(t *testing.T, request policy.InternalUserRequest, endpoint func(policy.RequestHeader, policy.RequestBodyFactories, bool) policy.CommandResponse, result interface{}) {
+	response := endpoint(request.Header, request.BodyFactories, request.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure in Command %d! Err: %v\n", request.Header.Command, response.ServerError)
+	} else if response.UseRaw {
+		json.Unmarshal(response.Raw, result)
+		return
+	}
+
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, result)
+}
+
+// Sends a request from a user to an endpoint which responds with
+// policy.SuccessfulData (see endpointTestHelper)
+func commandTestHelper(t *testing.T, userID string, cmd policy.ClientCmd, endpoint func(policy.RequestHeader, policy.RequestBodyFactories, bool) policy.CommandResponse, body interface{}) policy.SuccessfulData {
+	var success policy.SuccessfulData
+	endpointTestHelper(t, userID, cmd, endpoint, body, &success)
+	return success
+}
@@ -0,0 +1,440 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Friends Table
+
+// Redis Set Key Prefix for a user's Friends. Concatenated with a UserID
+const FriendSetPrefix string = "friends:"
+
+// Redis Set Key Prefix for the Friend Requests a user has received.
+// Concatenated with a UserID
+const FriendRequestSetPrefix string = "friendRequests:"
+
+// Maximum Number of Friends (and pending requests) a user can have
+const MaxFriends int = 256
+
+//
+// Presence
+
+// Redis Key for the Sorted Set of when users were last seen
+// (number of seconds since epoch)
+const PresenceSetName string = "presence"
+
+// Redis Set Key Prefix for the Games a user is in. Concatenated with
+// a UserID. The reverse of the roster sets (see PlayerSetPrefix)
+const PlayerGamesSetPrefix string = "playerGames:"
+
+// A user is online if they made an authenticated request within this
+// long
+const PresenceOnlineWindow time.Duration = 2 * time.Minute
+
+// Least time between recording activity for the same user. Keeps
+// authenticated requests from writing to the database every time.
+const PresenceWriteInterval time.Duration = 30 * time.Second
+
+// Presence Statuses
+const (
+	PresenceOffline string = "offline"
+	PresenceOnline  string = "online"
+	PresenceInGame  string = "inGame"
+)
+
+//// Global Variables | Singletons
+
+// When activity was last written for each user by this server
+// (see RecordActivity). Entries older than PresenceWriteInterval are
+// pruned once every PresenceWriteInterval.
+var activityWritten = struct {
+	sync.Mutex
+	times  map[string]time.Time
+	pruned time.Time
+}{times: map[string]time.Time{}}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Friends
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Friend Endpoints/Commands
+type FriendCommandBody struct {
+	UserID string
+}
+
+// A Friend with their presence. GameIDs is only filled
+// when the friend is in a game.
+type FriendInfo struct {
+	AuthID   string
+	Username string
+	Presence string
+	LastSeen int64
+	GameIDs  []string `json:",omitempty"`
+}
+
+// JSON Response for the Friend List Endpoint/Command
+type FriendList struct {
+	Friends []FriendInfo
+
+	// UserIDs of users waiting for a response to their request
+	Requests []string
+}
+
+// Friend Request Endpoint. Sends a friend request to another user. If
+// that user already sent a request to the request's user they become
+// friends right away.
+func SendFriendRequest(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := FriendCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.UserID == header.UserID {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	username, err := getUsername(rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	isFriend, err := IsFriend(header.UserID, rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if isFriend {
+		return policy.UnSuccessfulResponse("Already Friends!")
+	}
+
+	var wasRequested int
+	err = redis.MainRedis.Do(radix.Cmd(&wasRequested, "SISMEMBER", FriendRequestSetPrefix+header.UserID, rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if wasRequested > 0 {
+		return acceptFriendRequest(header.UserID, rqBody.UserID)
+	}
+
+	var pending int
+	err = redis.MainRedis.Do(radix.Cmd(&pending, "SCARD", FriendRequestSetPrefix+rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if pending >= MaxFriends {
+		return policy.UnSuccessfulResponse("Too Many Friend Requests!")
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendRequestSetPrefix+rqBody.UserID, header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Accept Friend Endpoint. Accepts a pending friend request.
+func AcceptFriendRequest(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := FriendCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	return acceptFriendRequest(header.UserID, rqBody.UserID)
+}
+
+// Decline Friend Endpoint. Removes a pending friend request.
+func DeclineFriendRequest(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := FriendCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var removed int
+	err = redis.MainRedis.Do(radix.Cmd(&removed, "SREM", FriendRequestSetPrefix+header.UserID, rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if removed == 0 {
+		return policy.UnSuccessfulResponse("No Friend Request!")
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Remove Friend Endpoint. Both users are removed from each other's
+// friends.
+func RemoveFriend(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := FriendCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var removed int
+	err = redis.MainRedis.Do(radix.Cmd(&removed, "SREM", FriendSetPrefix+header.UserID, rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if removed == 0 {
+		return policy.UnSuccessfulResponse("Not Friends!")
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", FriendSetPrefix+rqBody.UserID, header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Friend List Endpoint. Returns the request's user's friends with their
+// presence and the pending friend requests.
+func GetFriendList(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	var friendIDs []string
+	err = redis.MainRedis.Do(radix.Cmd(&friendIDs, "SMEMBERS", FriendSetPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	list := FriendList{Friends: make([]FriendInfo, 0, len(friendIDs))}
+
+	err = redis.MainRedis.Do(radix.Cmd(&list.Requests, "SMEMBERS", FriendRequestSetPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	for _, friendID := range friendIDs {
+		username, err := getUsername(friendID)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		friend := FriendInfo{AuthID: friendID, Username: username}
+		friend.Presence, friend.LastSeen, friend.GameIDs, err = GetPresence(friendID)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		// Private games are only shown to players in them
+		friend.GameIDs, err = visibleGameIDs(header.UserID, friend.GameIDs)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		list.Friends = append(list.Friends, friend)
+	}
+
+	return policy.CommandResponse{
+		Data:   list,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns whether two users are friends.
+//
+// authID   :: Unique Identifier for a user
+// friendID :: Unique Identifier for the other user
+func IsFriend(authID string, friendID string) (bool, error) {
+	var isFriend int
+	err := redis.MainRedis.Do(radix.Cmd(&isFriend, "SISMEMBER", FriendSetPrefix+authID, friendID))
+	if err != nil {
+		return false, err
+	}
+
+	return isFriend > 0, nil
+}
+
+// Accepts a friend request sent to authID by requesterID.
+func acceptFriendRequest(authID string, requesterID string) policy.CommandResponse {
+	var removed int
+	err := redis.MainRedis.Do(radix.Cmd(&removed, "SREM", FriendRequestSetPrefix+authID, requesterID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if removed == 0 {
+		return policy.UnSuccessfulResponse("No Friend Request!")
+	}
+
+	// The requester may have deleted their account since
+	username, err := getUsername(requesterID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	var friends int
+	err = redis.MainRedis.Do(radix.Cmd(&friends, "SCARD", FriendSetPrefix+authID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if friends >= MaxFriends {
+		return policy.UnSuccessfulResponse("Too Many Friends!")
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendSetPrefix+authID, requesterID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendSetPrefix+requesterID, authID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Removes a user from their friends' lists and deletes their friends
+// and friend requests. Used when an account is deleted.
+//
+// authID :: Unique Identifier for a user
+func deleteFriends(authID string) error {
+	var friendIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&friendIDs, "SMEMBERS", FriendSetPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	for _, friendID := range friendIDs {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", FriendSetPrefix+friendID, authID))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", PresenceSetName, authID))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", FriendSetPrefix+authID, FriendRequestSetPrefix+authID))
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Presence
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Records that a user made an authenticated request. Activity is only
+// written once every PresenceWriteInterval for each user. Errors are
+// logged since presence should never reject a request.
+//
+// authID :: Unique Identifier for a user
+func RecordActivity(authID string) {
+	now := time.Now().UTC()
+
+	activityWritten.Lock()
+	if now.Sub(activityWritten.pruned) >= PresenceWriteInterval {
+		pruneActivityWritten(now)
+	}
+
+	lastWritten, exists := activityWritten.times[authID]
+	if exists && now.Sub(lastWritten) < PresenceWriteInterval {
+		activityWritten.Unlock()
+		return
+	}
+	activityWritten.times[authID] = now
+	activityWritten.Unlock()
+
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", PresenceSetName, fmt.Sprintf("%d", now.Unix()), authID))
+	if err != nil {
+		log.Printf("Error Recording Activity! AuthID: %s\tErr: %v\n", authID, err)
+	}
+}
+
+// Forgets when activity was written for users who have not been active
+// within PresenceWriteInterval. activityWritten must be locked.
+func pruneActivityWritten(now time.Time) {
+	for authID, lastWritten := range activityWritten.times {
+		if now.Sub(lastWritten) >= PresenceWriteInterval {
+			delete(activityWritten.times, authID)
+		}
+	}
+
+	activityWritten.pruned = now
+}
+
+// Returns the presence of a user. A user is online if they were seen
+// within PresenceOnlineWindow and in a game if they are also in a
+// game's roster.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> string   :: presence status (i.e. PresenceOnline)
+//         -> int64    :: when the user was last seen (seconds since epoch)
+//         -> []string :: the games the user is in if they are in a game
+//         -> error    :: non-nil if the database could not be read
+func GetPresence(authID string) (string, int64, []string, error) {
+	var lastSeenStr string
+	err := redis.MainRedis.Do(radix.Cmd(&lastSeenStr, "ZSCORE", PresenceSetName, authID))
+	if err != nil {
+		return PresenceOffline, 0, nil, err
+	} else if lastSeenStr == "" {
+		return PresenceOffline, 0, nil, nil
+	}
+
+	lastSeen, err := strconv.ParseInt(lastSeenStr, 10, 64)
+	if err != nil {
+		return PresenceOffline, 0, nil, err
+	} else if time.Unix(lastSeen, 0).Before(time.Now().UTC().Add(-PresenceOnlineWindow)) {
+		return PresenceOffline, lastSeen, nil, nil
+	}
+
+	var gameIDs []string
+	err = redis.MainRedis.Do(radix.Cmd(&gameIDs, "SMEMBERS", PlayerGamesSetPrefix+authID))
+	if err != nil {
+		return PresenceOffline, lastSeen, nil, err
+	} else if len(gameIDs) > 0 {
+		return PresenceInGame, lastSeen, gameIDs, nil
+	}
+
+	return PresenceOnline, lastSeen, nil, nil
+}
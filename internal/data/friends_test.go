@@ -0,0 +1,128 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestPruneActivityWritten(t *testing.T) {
+	now := time.Now().UTC()
+
+	activityWritten.Lock()
+	activityWritten.times["-1"] = now.Add(-2 * PresenceWriteInterval)
+	activityWritten.times["-2"] = now
+	pruneActivityWritten(now)
+	_, staleExists := activityWritten.times["-1"]
+	_, freshExists := activityWritten.times["-2"]
+	delete(activityWritten.times, "-2")
+	activityWritten.Unlock()
+
+	if staleExists {
+		t.Errorf("Stale Activity was not Pruned!\n")
+	} else if !freshExists {
+		t.Errorf("Recent Activity was Pruned!\n")
+	}
+}
+
+func TestFriends(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartRoomsSystem,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "FRIEND"
+	otherUsername := testUserNamePrefix + "FRIENDOTHER"
+	password := "SomeP@ssword123"
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, otherUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	otherID := getUserTestHelper(t, otherUsername)
+
+	// Declined Requests do not make friends
+	friendTestHelper(t, authID, policy.CmdFriendRequest, otherID, true)
+	friendTestHelper(t, otherID, policy.CmdFriendDecline, authID, true)
+	friendTestHelper(t, otherID, policy.CmdFriendAccept, authID, false)
+
+	// Accepted Requests make friends both ways
+	friendTestHelper(t, authID, policy.CmdFriendRequest, otherID, true)
+	list := friendListTestHelper(t, otherID)
+	if len(list.Requests) != 1 || list.Requests[0] != authID {
+		t.Errorf("Friend Request Was Not Listed! Requests: %v\n", list.Requests)
+	}
+
+	friendTestHelper(t, otherID, policy.CmdFriendAccept, authID, true)
+	friendTestHelper(t, authID, policy.CmdFriendRequest, otherID, false)
+
+	list = friendListTestHelper(t, authID)
+	if len(list.Friends) != 1 || list.Friends[0].AuthID != otherID {
+		t.Fatalf("Friend Was Not Listed! Friends: %v\n", list.Friends)
+	} else if list.Friends[0].Presence != PresenceOffline {
+		t.Errorf("Expected Presence %s but got %s\n", PresenceOffline, list.Friends[0].Presence)
+	}
+
+	// Presence follows activity and rosters
+	RecordActivity(otherID)
+	metadata, _ := createGameForUser(otherID, t)
+
+	list = friendListTestHelper(t, authID)
+	if list.Friends[0].Presence != PresenceInGame {
+		t.Errorf("Expected Presence %s but got %s\n", PresenceInGame, list.Friends[0].Presence)
+	} else if len(list.Friends[0].GameIDs) != 1 || list.Friends[0].GameIDs[0] != metadata.Id {
+		t.Errorf("Friend's Game Was Not Listed! GameIDs: %v\n", list.Friends[0].GameIDs)
+	}
+
+	deleteGamesForUsers([]string{otherID}, t)
+
+	list = friendListTestHelper(t, authID)
+	if list.Friends[0].Presence != PresenceOnline {
+		t.Errorf("Expected Presence %s but got %s\n", PresenceOnline, list.Friends[0].Presence)
+	}
+
+	// Removing a friend removes both ways
+	friendTestHelper(t, otherID, policy.CmdFriendRemove, authID, true)
+
+	isFriend, err := IsFriend(authID, otherID)
+	if err != nil {
+		t.Errorf("Error Checking Friends! Err: %v\n", err)
+	} else if isFriend {
+		t.Errorf("Friend Was Not Removed!\n")
+	}
+
+	redis.MainRedis.Do(radix.Cmd(nil, "ZREM", PresenceSetName, otherID))
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+}
+
+func friendTestHelper(t *testing.T, userID string, cmd policy.ClientCmd, friendID string, expected bool) {
+	endpoint := RemoveFriend
+	switch cmd {
+	case policy.CmdFriendRequest:
+		endpoint = SendFriendRequest
+	case policy.CmdFriendAccept:
+		endpoint = AcceptFriendRequest
+	case policy.CmdFriendDecline:
+		endpoint = DeclineFriendRequest
+	}
+
+	success := commandTestHelper(t, userID, cmd, endpoint, FriendCommandBody{UserID: friendID})
+	if success.Successful != expected {
+		t.Errorf("Friend Command %d was %t instead of %t! Err: %s\n", cmd, success.Successful, expected, success.Err)
+	}
+}
+
+func friendListTestHelper(t *testing.T, userID string) FriendList {
+	var list FriendList
+	endpointTestHelper(t, userID, policy.CmdFriendList, GetFriendList, nil, &list)
+	return list
+}
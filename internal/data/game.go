@@ -25,7 +25,7 @@ const WaitDurationForGameStop time.Duration = 10 * time.Second
 // Time to Wait For Game to Respond to an Action
 const WaitDurationForGameAction time.Duration = 3 * time.Second
 
-// Commands For Initialization
+// Commands For Initialization of DefaultGameType (see GameTypes)
 
 // Shell Command to execute
 const CommandToExec string = "node"
@@ -48,11 +48,28 @@ var commandContext context.Context = nil
 // Context Cancel Function
 var cancelFunc func() = nil
 
-// ServerTask Startup Function for the third-party Game application.
-// Takes care of initialization. returns an error if the
-// game can't be started (i.e. prerequisites are not met)
+// ServerTask Startup Function for the third-party Game applications.
+// Starts the game process of every game type (see GameTypes). returns
+// an error if the games can't be started (i.e. prerequisites are not
+// met)
 func StartGameLogic() (func(), error) {
-	executeCommand()
+	if _, exists := GameTypes[DefaultGameType]; !exists {
+		return nil, errors.New("Default Game Type is not Registered!")
+	}
+
+	for name := range GameTypes {
+		normalized, err := normalizeGameTags([]string{name})
+		if err != nil || normalized[0] != name {
+			return nil, errors.New("Invalid Game Type Name: " + name)
+		}
+	}
+
+	commandContext, cancelFunc = context.WithCancel(context.Background())
+
+	for name, gameType := range GameTypes {
+		executeCommand(name, gameType)
+	}
+
 	return cleanUpGameLogic, nil
 }
 
@@ -79,18 +96,16 @@ func cleanUpGameLogic() {
 }
 
 // Wrapper and secure configuration for os/exec
-func executeCommand() {
-	commandContext, cancelFunc = context.WithCancel(context.Background())
-
+func executeCommand(name string, gameType GameType) {
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Fatalf("Error getting PWD: %v\n", err)
 	}
 
 	log.Printf("Present Working Directory\n%s\n", pwd)
-	log.Printf("Executing Command!\n %s %v\n", CommandToExec, CommandArgs)
+	log.Printf("Executing Command for Game Type %s!\n %s %v\n", name, gameType.Command, gameType.Args)
 
-	cmd := exec.CommandContext(commandContext, CommandToExec, CommandArgs...)
+	cmd := exec.CommandContext(commandContext, gameType.Command, gameType.Args...)
 
 	// Making sure to nil these for security reasons
 	cmd.Stdout = nil
@@ -100,7 +115,7 @@ func executeCommand() {
 	go func() {
 		err := cmd.Run()
 		if err != nil {
-			log.Printf("Error Recieved From Game %v\n", err)
+			log.Printf("Error Recieved From Game Type %s %v\n", name, err)
 		}
 	}()
 }
@@ -110,12 +125,24 @@ func executeCommand() {
 // communication. We just connect and send a string, waiting for a
 // a response). Thread Safe with ZeroMQ!
 //
-// dataIn :: string to sent to game (usually a JSON.)
+// gameType :: name of the game type whose process gets the data
+//             (see GameTypes)
+// dataIn   :: string to sent to game (usually a JSON.)
 //
 // returns -> string :: response from third-party game
 //         -> error :: non-nil if it couldn't send data
 //                to the game.
-func BytesToGame(dataIn string) (string, error) {
+func BytesToGame(gameType string, dataIn string) (string, error) {
+	settings, exists := GameTypes[gameType]
+	if !exists {
+		return "", errors.New("Unknown Game Type: " + gameType)
+	}
+
+	timeout := settings.ActionTimeout
+	if timeout <= 0 {
+		timeout = WaitDurationForGameAction
+	}
+
 	// Create a Zeromq Request Port
 	req, err := zeromq.MainZeroMQ.NewSocket(zmq4.Type(zmq4.REQ))
 	if err != nil {
@@ -125,7 +152,7 @@ func BytesToGame(dataIn string) (string, error) {
 	// Not necessary, but good practice
 	defer req.Close()
 
-	err = req.Connect(zeromq.ZeromqHost + GamePort)
+	err = req.Connect(settings.Endpoint)
 	if err != nil {
 		return "", err
 	}
@@ -137,23 +164,24 @@ func BytesToGame(dataIn string) (string, error) {
 		return "", errors.New("ZeroMQ did not Accept Full Job! Characters Accepted:" + fmt.Sprintf("%d", num))
 	}
 
-	return BytesFromGame(req)
+	return BytesFromGame(req, timeout)
 }
 
 // Receive a string of bytes from the game.(This is
 // used with BytesToGame and there should not be a
 // need to call this function)
 //
-// req :: ZeroMQ Request Socket
+// req     :: ZeroMQ Request Socket
+// timeout :: time to wait for the response
 //
 // returns -> string :: response from third-party game
 //         -> error :: non-nil if it couldn't receive
 //                data from game
-func BytesFromGame(req *zmq4.Socket) (string, error) {
+func BytesFromGame(req *zmq4.Socket, timeout time.Duration) (string, error) {
 	poller := zmq4.NewPoller()
 
 	poller.Add(req, zmq4.POLLIN)
-	sockets, err := poller.Poll(WaitDurationForGameAction)
+	sockets, err := poller.Poll(timeout)
 	if err != nil {
 		log.Println("It seems Response Wait Was Interrupted")
 		return "", err
@@ -185,6 +213,9 @@ type applyActionRequest struct {
 type actionServerPayload struct {
 	State map[string]interface{}
 	Relay map[string]interface{}
+
+	// Only set by the server (see gameServerEvent)
+	ServerEvent *gameServerEvent `json:",omitempty"`
 }
 
 // The Apply Action Endpoint sends the payload to the game.
@@ -192,9 +223,14 @@ type actionServerPayload struct {
 // the main transport method to games. The Game actually runs
 // the code, but the application loads the data for the
 // game from the database.
+//
+// The game finishes by adding a "Result" field to its
+// response (see GameResultReport and FinishGame). It may
+// also update leaderboards with a "Leaderboard" field
+// (see LeaderboardUpdate)
 func ApplyAction(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
 	// 1. Verify Request
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
@@ -208,23 +244,51 @@ func ApplyAction(header policy.RequestHeader, bodyFactories policy.RequestBodyFa
 		return policy.UnSuccessfulResponse("Bad Arguments!")
 	}
 
+	if _, exists := args.Relay[reservedRelayKey]; exists {
+		log.Printf("Bad Argument! Relay has the Reserved Key %s\n", reservedRelayKey)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
 	// 3. Verify User is In Game
 	isInGame, err := IsUserInGame(header.UserID, args.GameID)
 	if err != nil {
 		log.Printf("Error Verifying User is in game: %v\n", err)
 		return policy.UnSuccessfulResponse("User Not In Game")
 	} else if !isInGame {
+		wasKicked, err := wasKickedFromGame(header.UserID, args.GameID)
+		if err != nil {
+			log.Printf("Error Verifying User was kicked from game: %v\n", err)
+		} else if wasKicked {
+			return policy.UnSuccessfulResponseWithCode("Kicked From Game!", policy.CodeKickedFromGame)
+		}
+
 		return policy.UnSuccessfulResponse("User Not In Game")
 	}
 
-	// 4. Load Game State Data
+	// 4. Record Activity and Pass On the Game of an Idle Owner
+	err = recordPlayerActivity(args.GameID, header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	_, err = migrateIdleOwner(args.GameID)
+	if err != nil {
+		log.Printf("Error Passing On Game %s from an Idle Owner: %v\n", args.GameID, err)
+	}
+
+	// 5. Load Game State Data and Type
 	var state string
 	err = redis.MainRedis.Do(radix.Cmd(&state, "HGET", GameHashSetName, args.GameID))
 	if err != nil || len(state) <= 0 {
 		return policy.RespWithError(err)
 	}
 
-	// 5. Send to Server Application
+	gameType, err := GetGameType(args.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	// 6. Send to Server Application
 	payload := actionServerPayload{
 		Relay: args.Relay,
 	}
@@ -240,19 +304,24 @@ func ApplyAction(header policy.RequestHeader, bodyFactories policy.RequestBodyFa
 		return policy.RespWithError(err)
 	}
 
-	response, err := BytesToGame(string(payloadBytes))
+	response, err := BytesToGame(gameType, string(payloadBytes))
 	if err != nil {
 		log.Printf("A Server Error Occurred: %v\n", err)
 		return policy.RawUnsuccessfulResponse("Could Not Upload State to Server!")
 	}
 
-	// 6. On Success update metadata
-	milli := fmt.Sprintf("%d", time.Now().UTC().Unix())
-	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+args.GameID, MetadataSetLastUsed, milli))
+	// 7. On Success update metadata
+	err = touchGame(args.GameID)
 	if err != nil {
 		log.Printf("A Server Error Occurred: %v\n", err)
 	}
 
+	// 8. Apply Leaderboard Updates and Results the Game Reported
+	err = handleGameResponse(args.GameID, response)
+	if err != nil {
+		log.Printf("Error Handling Game Response %s: %v\n", args.GameID, err)
+	}
+
 	// Response should already be in JSON format... Let's not marshall again pls.
 	return policy.RawSuccessfulResponse(response)
 }
@@ -264,14 +333,16 @@ type getGameDataRequest struct {
 
 // The Get Game Data Endpoint gathers all the data
 // in the database for a game. The Games are public
-// by default so anyone should be able to observe
+// by default so anyone should be able to observe.
+// Owners may limit observers to the roster or their
+// friends (see UpdateGameSettings)
 //
 // However, observers cannot change the game in
 // any way. You have to be on the roster to apply
 // an action
 func GetGameData(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
 	// 1. Get Game Info From Request
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
@@ -285,7 +356,7 @@ func GetGameData(header policy.RequestHeader, bodyFactories policy.RequestBodyFa
 		return policy.UnSuccessfulResponse("Bad Arguments!")
 	}
 
-	// 3. Load Game State Data
+	// 3. Load Game State Data and Type
 	var state string
 	err = redis.MainRedis.Do(radix.Cmd(&state, "HGET", GameHashSetName, args.GameID))
 	if err != nil {
@@ -294,7 +365,20 @@ func GetGameData(header policy.RequestHeader, bodyFactories policy.RequestBodyFa
 		return policy.UnSuccessfulResponse("Game Does Not Exist")
 	}
 
-	// 4. Send to Server Application
+	gameType, err := GetGameType(args.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	// 4. Verify User May Observe
+	canObserve, err := canObserveGame(header.UserID, args.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !canObserve {
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	// 5. Send to Server Application
 	payload := actionServerPayload{
 		Relay: map[string]interface{}{}, // Empty JSON Object
 	}
@@ -310,7 +394,7 @@ func GetGameData(header policy.RequestHeader, bodyFactories policy.RequestBodyFa
 		return policy.RespWithError(err)
 	}
 
-	response, err := BytesToGame(string(payloadBytes))
+	response, err := BytesToGame(gameType, string(payloadBytes))
 
 	// Response should already be in JSON format... Let's not marshall again pls.
 	return policy.RawSuccessfulResponse(response)
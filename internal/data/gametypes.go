@@ -0,0 +1,104 @@
+package data
+
+import (
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+// Redis Field/Key for Game Metadata Game Type
+//    (see GameTypes, missing for games of DefaultGameType)
+const MetadataSetGameType string = "gameType"
+
+// Game type of games created without one and of games created
+// before game types existed
+const DefaultGameType string = "default"
+
+// Settings for a type of game. Each type runs its own game process
+// which the server talks to over ZeroMQ.
+type GameType struct {
+	// Shell Command to execute
+	Command string
+
+	// Shell Command Args
+	Args []string
+
+	// ZeroMQ URI the game process listens on
+	Endpoint string
+
+	// Most players a game of this type may have (0 for no maximum).
+	// Games created without a maximum get this maximum.
+	MaxPlayers uint16
+
+	// Time to Wait For the Game to Respond to an Action
+	// (0 for WaitDurationForGameAction)
+	ActionTimeout time.Duration
+}
+
+// Registry of game types by name. Names may only have lowercase
+// letters, numbers, and dashes (like game tags) so matchmaking queues
+// and leaderboards can use them.
+//
+// This should never change during runtime!
+var GameTypes map[string]GameType = map[string]GameType{
+	DefaultGameType: {
+		Command:  CommandToExec,
+		Args:     CommandArgs,
+		Endpoint: zeromq.ZeromqHost + GamePort,
+	},
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Game Types
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Returns the type of a game (DefaultGameType for games created before
+// game types existed)
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> string :: name of the game type (see GameTypes)
+//         -> error  :: non-nil if the database could not be read
+func GetGameType(gameID string) (string, error) {
+	var gameType string
+	err := redis.MainRedis.Do(radix.Cmd(&gameType, "HGET", MetadataSetPrefix+gameID, MetadataSetGameType))
+	if err != nil {
+		return "", err
+	} else if gameType == "" {
+		return DefaultGameType, nil
+	}
+
+	return gameType, nil
+}
+
+// Applies a game type's settings to Create Game arguments. Games
+// without a type get DefaultGameType.
+//
+// args :: Create Game arguments to change
+//
+// returns -> bool :: false if the game type does not exist or the
+//                    game would have too many players for its type
+func applyGameTypeSettings(args *CreateGameCommandBody) bool {
+	if args.GameType == "" {
+		args.GameType = DefaultGameType
+	}
+
+	gameType, exists := GameTypes[args.GameType]
+	if !exists {
+		return false
+	} else if gameType.MaxPlayers == 0 {
+		return true
+	}
+
+	if args.MaxPlayers == 0 {
+		args.MaxPlayers = gameType.MaxPlayers
+	}
+
+	return args.MaxPlayers <= gameType.MaxPlayers
+}
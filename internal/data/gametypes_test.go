@@ -0,0 +1,105 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+)
+
+const testGameType string = "typetest"
+
+func TestGameTypeSettings(t *testing.T) {
+	GameTypes[testGameType] = GameType{Command: "true", Endpoint: "tcp://127.0.0.1:5099", MaxPlayers: 4}
+	defer delete(GameTypes, testGameType)
+
+	args := CreateGameCommandBody{}
+	if !applyGameTypeSettings(&args) || args.GameType != DefaultGameType || args.MaxPlayers != 0 {
+		t.Errorf("Games without a Type did not get the Default Type! Args: %v\n", args)
+	}
+
+	args = CreateGameCommandBody{GameType: testGameType}
+	if !applyGameTypeSettings(&args) || args.MaxPlayers != 4 {
+		t.Errorf("Games without a Maximum did not get their Type's Maximum! Args: %v\n", args)
+	}
+
+	args = CreateGameCommandBody{GameType: testGameType, MaxPlayers: 5}
+	if applyGameTypeSettings(&args) {
+		t.Errorf("Game was allowed more Players than its Type!\n")
+	}
+
+	args = CreateGameCommandBody{GameType: "missing"}
+	if applyGameTypeSettings(&args) {
+		t.Errorf("Game was allowed an Unknown Type!\n")
+	}
+}
+
+func TestCreateGameOfType(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	GameTypes[testGameType] = GameType{Command: "true", Endpoint: "tcp://127.0.0.1:5099", MaxPlayers: 4}
+	defer delete(GameTypes, testGameType)
+
+	ownerID := "-1500"
+	deleteGamesForUsers([]string{ownerID}, t)
+
+	t.Run("Unknown Game Types", func(t *testing.T) {
+		metadata, jsonResponse := gameTypeTestHelper(t, ownerID, CreateGameCommandBody{GameType: "missing"})
+		if metadata.Id != "" {
+			t.Errorf("Game was Created with an Unknown Type! Response: %s\n", jsonResponse)
+		}
+	})
+
+	t.Run("Game Type is Stored", func(t *testing.T) {
+		metadata, jsonResponse := gameTypeTestHelper(t, ownerID, CreateGameCommandBody{GameType: testGameType})
+		if metadata.Id == "" {
+			t.Fatalf("Game was not created! Response: %s\n", jsonResponse)
+		}
+
+		gameType, err := GetGameType(metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Game Type! Err: %v\n", err)
+		} else if gameType != testGameType {
+			t.Errorf("Expected Game Type %s but got %s!\n", testGameType, gameType)
+		}
+
+		stored, err := GetGameMetadata(metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Metadata! Err: %v\n", err)
+		} else if stored.GameType != testGameType || stored.MaxPlayers != 4 {
+			t.Errorf("Metadata does not have the Game Type's Settings! Metadata: %v\n", stored)
+		}
+	})
+
+	deleteGamesForUsers([]string{ownerID}, t)
+}
+
+func gameTypeTestHelper(t *testing.T, userID string, body CreateGameCommandBody) (GameMetadata, []byte) {
+	request, err := policy.RequestWithUserForTesting(userID, false, policy.CmdGameCreate, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response := CreateGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure to Create Game! Err: %v\n", response.ServerError)
+	}
+
+	jsonResponse, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+
+	var metadata GameMetadata
+	json.Unmarshal(jsonResponse, &metadata)
+
+	return metadata, jsonResponse
+}
@@ -0,0 +1,333 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/util"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Guest Accounts
+
+// Redis Key for the Sorted Set of Guest AuthIDs. The score is the last
+// time (seconds since epoch) the guest was known to be active.
+const GuestSetName string = "guests"
+
+// Prefix for the usernames of guests. Users can not register or
+// rename to a username with this prefix.
+const GuestUsernamePrefix string = "guest_"
+
+// Number of random bytes in a guest's username
+const guestUsernameLen int = 12
+
+// Time without activity before a guest account is deleted
+const GuestInactivityLimit time.Duration = 7 * 24 * time.Hour
+
+// Number of guests checked at a time when expiring guests
+const GuestExpireBatchSize int = 100
+
+//
+// Guest Login Limits
+
+// Redis Key Prefix for Guest Login Counters. Concatenated with an
+// IP Address
+const GuestLoginPrefix string = "guestLogins:"
+
+// Guest accounts that can be made from an IP Address within
+// GuestLoginWindow
+const GuestLoginsPerIP int = 10
+
+// Time before the Guest Login Counter for an IP Address resets
+const GuestLoginWindow time.Duration = time.Hour
+
+// Script for atomically upgrading a guest. Renames the guest, sets the
+// password checksum, and removes the guest from the Guest Set. Returns 1
+// if upgraded, 0 if the new username is taken, and -1 if the user is
+// not a guest.
+//
+// KEYS[1] :: UserPass Table
+// KEYS[2] :: UserAuthID Table
+// KEYS[3] :: authID HashTable
+// KEYS[4] :: Guest Set
+// ARGV[1] :: current username
+// ARGV[2] :: new username
+// ARGV[3] :: password checksum
+// ARGV[4] :: authID
+var upgradeGuestScript = radix.NewEvalScript(4, `
+if not redis.call('ZSCORE', KEYS[4], ARGV[4]) then
+	return -1
+elseif redis.call('HEXISTS', KEYS[1], ARGV[2]) == 1 or redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+	return 0
+end
+
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[4])
+redis.call('HSET', KEYS[3], '`+AuthIDSetUsernameField+`', ARGV[2])
+redis.call('ZREM', KEYS[4], ARGV[4])
+return 1
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Guest Accounts
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Upgrade Guest Endpoint/Command
+type UpgradeGuestCommandBody struct {
+	Username string
+	Password string
+}
+
+// Session given to a new guest. Guests did not choose a username, so
+// the AuthID and Username are sent with the session.
+type GuestSession struct {
+	AuthID   string
+	Username string
+
+	// The base64 session token (or the Stateless Token when
+	// UseStatelessTokens is set)
+	Token string
+
+	// Session Secret for Stateless Tokens
+	Secret string `json:",omitempty"`
+}
+
+// Guest Login Endpoint. Creates a temporary account without a password
+// and starts a session for it. The account is deleted after
+// GuestInactivityLimit without activity unless it is upgraded.
+func LoginGuest(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	allowed, err := allowGuestLogin(header.RemoteAddr)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !allowed {
+		return policy.UnSuccessfulResponseWithCode("Too Many Attempts! Try Again Later!", policy.CodeLoginBackoff)
+	}
+
+	authID, username, err := createGuest()
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	RecordAudit(AuditEvent{Event: AuditLogin, Actor: authID, Target: username, IP: header.RemoteAddr, Outcome: AuditSuccess, Detail: "Guest"})
+
+	session := GuestSession{AuthID: authID, Username: username}
+	if UseStatelessTokens {
+		stateless, err := IssueStatelessToken(authID)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		session.Token = stateless.Token
+		session.Secret = stateless.Secret
+	} else {
+		token, _, err := ConstructNewToken(authID)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		session.Token = string(util.Base64Encode(&token))
+	}
+
+	return policy.CommandResponse{Data: session, Digest: json.Marshal}
+}
+
+// Upgrade Guest Endpoint. Gives a guest a username and password, making
+// the account permanent. The user ID does not change, so sessions,
+// games, and friends are kept.
+func UpgradeGuest(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := UpgradeGuestCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.Username == "" || len(rqBody.Username) > redis.RedisKeyMax || usernameIsReserved(rqBody.Username) {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	} else if !passwordIsStrong(rqBody.Password) {
+		return policy.UnSuccessfulResponse("Weak Password!")
+	}
+
+	username, err := getUsername(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	var result int
+	checksum := sha512.Sum512([]byte(passHashSalt + rqBody.Password))
+	err = redis.MainRedis.Do(upgradeGuestScript.Cmd(&result, UserPassTable, UserAuthIDTable, AuthIDSetPrefix+header.UserID, GuestSetName,
+		username, rqBody.Username, hex.EncodeToString(checksum[:]), header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if result < 0 {
+		return policy.UnSuccessfulResponse("User Is Not a Guest!")
+	} else if result == 0 {
+		return policy.UnSuccessfulResponse("Username Already Exists!")
+	}
+
+	return policy.CommandResponse{
+		Data:   UserInfo{AuthID: header.UserID, Username: rqBody.Username},
+		Digest: json.Marshal,
+	}
+}
+
+// Returns whether a user is a guest.
+//
+// authID :: Unique Identifier for a user
+func IsGuest(authID string) (bool, error) {
+	var lastActive string
+	err := redis.MainRedis.Do(radix.Cmd(&lastActive, "ZSCORE", GuestSetName, authID))
+	return lastActive != "", err
+}
+
+// Deletes guests who have not been active within GuestInactivityLimit.
+// Activity is read from the Presence Set (see RecordActivity). Meant to
+// be run periodically by the scheduler.
+//
+// returns -> int   :: number of guests deleted
+//         -> error :: non-nil if the database could not be read/written
+func ExpireGuests() (int, error) {
+	cutoff := time.Now().UTC().Add(-GuestInactivityLimit).Unix()
+	expired := 0
+
+	for {
+		var candidates []string
+		err := redis.MainRedis.Do(radix.Cmd(&candidates, "ZRANGEBYSCORE", GuestSetName, "-inf", fmt.Sprintf("%d", cutoff),
+			"LIMIT", "0", fmt.Sprintf("%d", GuestExpireBatchSize)))
+		if err != nil {
+			return expired, err
+		} else if len(candidates) == 0 {
+			return expired, nil
+		}
+
+		for _, authID := range candidates {
+			var lastSeenStr string
+			err = redis.MainRedis.Do(radix.Cmd(&lastSeenStr, "ZSCORE", PresenceSetName, authID))
+			if err != nil {
+				return expired, err
+			}
+
+			lastSeen, _ := strconv.ParseInt(lastSeenStr, 10, 64)
+			if lastSeen > cutoff {
+				// Still active, check again once it could have expired
+				err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GuestSetName, "XX", lastSeenStr, authID))
+				if err != nil {
+					return expired, err
+				}
+
+				continue
+			}
+
+			username, err := getUsername(authID)
+			if err != nil {
+				return expired, err
+			}
+
+			if username != "" {
+				_, err = removeAccount(authID, username)
+				if err != nil {
+					return expired, err
+				}
+
+				expired++
+			}
+
+			err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GuestSetName, authID))
+			if err != nil {
+				return expired, err
+			}
+		}
+	}
+}
+
+// Creates a guest account with a random username and no password.
+//
+// returns -> string :: the guest's AuthID
+//         -> string :: the guest's username
+//         -> error  :: non-nil if the database could not be read/written
+func createGuest() (string, string, error) {
+	byteTemp := make([]byte, guestUsernameLen)
+	n, err := rand.Read(byteTemp)
+	if err != nil {
+		return "", "", err
+	} else if n < guestUsernameLen {
+		return "", "", errors.New("rand.Read did not return full Guest Username!")
+	}
+
+	username := GuestUsernamePrefix + hex.EncodeToString(byteTemp)
+	success, err := createAccountWithChecksum(username, "")
+	if err != nil {
+		return "", "", err
+	} else if !success {
+		return "", "", errors.New("Guest Username Already Exists: " + username)
+	}
+
+	authID, err := getAuthID(username)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GuestSetName, fmt.Sprintf("%d", time.Now().UTC().Unix()), authID))
+	if err != nil {
+		return "", "", err
+	}
+
+	return authID, username, nil
+}
+
+// Counts a guest login from an IP Address and returns whether it is
+// within GuestLoginsPerIP. Logins without an IP Address are not limited.
+//
+// ip :: IP Address the login came from
+func allowGuestLogin(ip string) (bool, error) {
+	if ip == "" {
+		return true, nil
+	}
+
+	var count int
+	err := redis.MainRedis.Do(radix.Cmd(&count, "INCR", GuestLoginPrefix+ip))
+	if err != nil {
+		return false, err
+	}
+
+	if count == 1 {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "PEXPIRE", GuestLoginPrefix+ip, fmt.Sprintf("%d", GuestLoginWindow.Milliseconds())))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return count <= GuestLoginsPerIP, nil
+}
@@ -0,0 +1,175 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestUpgradeGuest(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartRoomsSystem,
+		})
+	defer cleanup()
+
+	upgradedUsername := testUserNamePrefix + "GUEST"
+	takenUsername := testUserNamePrefix + "GUESTTAKEN"
+	password := "SomeP@ssword123"
+	DeleteUser(upgradedUsername)
+	DeleteUser(takenUsername)
+
+	createUserSuccess(t, takenUsername, password)
+
+	session := loginGuestTestHelper(t)
+	if session.AuthID == "" || session.Token == "" {
+		t.Fatalf("Guest Login did not return a session! Session: %v\n", session)
+	}
+
+	isGuest, err := IsGuest(session.AuthID)
+	if err != nil {
+		t.Errorf("Error Checking Guest! Err: %v\n", err)
+	} else if !isGuest {
+		t.Errorf("Guest Login did not make a guest!\n")
+	}
+
+	metadata, _ := createGameForUser(session.AuthID, t)
+
+	t.Run("Guests Need Strong Passwords", func(t *testing.T) {
+		success := upgradeGuestTestHelper(t, session.AuthID, upgradedUsername, "weak")
+		if success.Successful {
+			t.Errorf("Guest Upgraded With a Weak Password!\n")
+		}
+	})
+
+	t.Run("Guests Can Not Take Usernames", func(t *testing.T) {
+		success := upgradeGuestTestHelper(t, session.AuthID, takenUsername, password)
+		if success.Successful {
+			t.Errorf("Guest Upgraded to a Taken Username!\n")
+		}
+	})
+
+	t.Run("Guests Can Upgrade", func(t *testing.T) {
+		success := upgradeGuestTestHelper(t, session.AuthID, upgradedUsername, password)
+		if !success.Successful {
+			t.Fatalf("Guest Could Not Upgrade! Err: %s\n", success.Err)
+		}
+
+		if getUserTestHelper(t, upgradedUsername) != session.AuthID {
+			t.Errorf("Upgraded Guest has a different AuthID!\n")
+		}
+
+		var isOwner bool
+		err := redis.MainRedis.Do(radix.Cmd(&isOwner, "SISMEMBER", OwnerGamesSetPrefix+session.AuthID, metadata.Id))
+		if err != nil {
+			t.Errorf("Error Getting Game! Err: %v\n", err)
+		} else if !isOwner {
+			t.Errorf("Upgraded Guest Lost Their Game!\n")
+		}
+
+		isGuest, err := IsGuest(session.AuthID)
+		if err != nil {
+			t.Errorf("Error Checking Guest! Err: %v\n", err)
+		} else if isGuest {
+			t.Errorf("Upgraded User is still a guest!\n")
+		}
+
+		loginUserSuccess(t, upgradedUsername, password)
+	})
+
+	t.Run("Users Can Not Upgrade Twice", func(t *testing.T) {
+		success := upgradeGuestTestHelper(t, session.AuthID, upgradedUsername+"2", password)
+		if success.Successful {
+			t.Errorf("User Upgraded Twice!\n")
+		}
+	})
+
+	deleteGamesForUsers([]string{session.AuthID}, t)
+	DeleteUser(upgradedUsername)
+	DeleteUser(takenUsername)
+}
+
+func TestExpireGuests(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartRoomsSystem,
+		})
+	defer cleanup()
+
+	active := loginGuestTestHelper(t)
+	inactive := loginGuestTestHelper(t)
+
+	old := time.Now().UTC().Add(-2 * GuestInactivityLimit).Unix()
+	for _, authID := range []string{active.AuthID, inactive.AuthID} {
+		err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GuestSetName, fmt.Sprintf("%d", old), authID))
+		if err != nil {
+			t.Fatalf("Error Setting Guest Activity! Err: %v\n", err)
+		}
+	}
+
+	redis.MainRedis.Do(radix.Cmd(nil, "ZADD", PresenceSetName, fmt.Sprintf("%d", time.Now().UTC().Unix()), active.AuthID))
+	redis.MainRedis.Do(radix.Cmd(nil, "ZREM", PresenceSetName, inactive.AuthID))
+
+	_, err := ExpireGuests()
+	if err != nil {
+		t.Fatalf("Error Expiring Guests! Err: %v\n", err)
+	}
+
+	username, _ := getUsername(inactive.AuthID)
+	if username != "" {
+		t.Errorf("Inactive Guest was not deleted!\n")
+	}
+
+	username, _ = getUsername(active.AuthID)
+	if username != active.Username {
+		t.Errorf("Active Guest was deleted!\n")
+	}
+
+	removeAccount(active.AuthID, active.Username)
+	redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GuestSetName, active.AuthID))
+}
+
+func loginGuestTestHelper(t *testing.T) GuestSession {
+	var session GuestSession
+	endpointTestHelper(t, "", policy.CmdLoginGuest, LoginGuest, nil, &session)
+	return session
+}
+
+func upgradeGuestTestHelper(t *testing.T, userID string, username string, password string) policy.SuccessfulData {
+	body := UpgradeGuestCommandBody{Username: username, Password: password}
+	req, err := policy.RequestWithUserForTesting(userID, false, policy.CmdUpgrade, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response := UpgradeGuest(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure to Upgrade Guest! Err: %v\n", response.ServerError)
+	}
+
+	var success policy.SuccessfulData
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &success)
+
+	// Successful upgrades respond with the UserInfo
+	var info UserInfo
+	json.Unmarshal(bytes, &info)
+	if info.AuthID != "" {
+		success.Successful = true
+	}
+
+	return success
+}
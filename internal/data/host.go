@@ -0,0 +1,380 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+// Redis Sorted Set Key Prefix for when each player joined a game's
+// roster (milliseconds since epoch). Concatenated with GameID
+const RosterJoinedPrefix string = "rosterJoined:"
+
+// Redis Sorted Set Key Prefix for each player's last action in a game
+// (milliseconds since epoch). Concatenated with GameID
+const RosterActivityPrefix string = "rosterActivity:"
+
+// Time without an action before an owner is idle. The game is passed
+// on when another player takes an action.
+var OwnerIdleTimeout time.Duration = 10 * time.Minute
+
+// Server Event sent to the game when its owner changes
+// (see gameServerEvent)
+const GameEventOwnerChanged string = "ownerChanged"
+
+// Key clients may not put in a relay (see ApplyAction) so games can not
+// mistake a relay for a server event (see gameServerEvent)
+const reservedRelayKey string = "ServerEvent"
+
+// Script for atomically moving a game between owners. Updates the
+// metadata and both owned games Sets together. Returns 1 if the game
+// moved, 0 if the new owner is at their quota, -1 if the game changed
+// owners already, and -2 if the new owner is not on the roster.
+//
+// KEYS[1] :: metadata HashTable
+// KEYS[2] :: current owner's owned games Set
+// KEYS[3] :: new owner's owned games Set
+// KEYS[4] :: roster Set
+// ARGV[1] :: current owner
+// ARGV[2] :: new owner
+// ARGV[3] :: GameID
+// ARGV[4] :: new owner's quota (GameQuotaUnlimited for no limit)
+var transferGameScript = radix.NewEvalScript(4, `
+if redis.call('HGET', KEYS[1], '`+MetadataSetOwner+`') ~= ARGV[1] then
+	return -1
+end
+
+if redis.call('SISMEMBER', KEYS[4], ARGV[2]) == 0 then
+	return -2
+end
+
+local quota = tonumber(ARGV[4])
+if quota >= 0 and redis.call('SISMEMBER', KEYS[3], ARGV[3]) == 0 and redis.call('SCARD', KEYS[3]) >= quota then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], '`+MetadataSetOwner+`', ARGV[2])
+redis.call('SREM', KEYS[2], ARGV[3])
+redis.call('SADD', KEYS[3], ARGV[3])
+return 1
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Ownership Transfer
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Event the server sends to a game in the ServerEvent field of its
+// payload (see actionServerPayload). Clients can not set it.
+type gameServerEvent struct {
+	Event         string
+	GameID        string
+	Owner         string
+	PreviousOwner string
+}
+
+// JSON Fields for the Transfer Game Endpoint/Command
+type TransferGameCommandBody struct {
+	GameID string
+
+	// Player on the roster to give the game to
+	UserID string
+}
+
+// Transfer Game Endpoint. Owners may give their game to another player
+// on its roster. The game is told about its new owner.
+func TransferGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := TransferGameCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if rqBody.UserID == "" || rqBody.UserID == header.UserID {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	owner, err := getGameOwner(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if owner == "" {
+		return policy.UnSuccessfulResponse("Game Does Not Exist!")
+	} else if owner != header.UserID {
+		log.Printf("Unauthorized Attempt! User %s does not own game %s\n", header.UserID, rqBody.GameID)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	result, err := transferGame(rqBody.GameID, header.UserID, rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if result == -2 {
+		return policy.UnSuccessfulResponse("User Not In Game")
+	} else if result == 0 {
+		return policy.UnSuccessfulResponse("User is at their Game Quota!")
+	} else if result != 1 {
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	// The game has moved already, so the request succeeds either way
+	err = notifyOwnerChanged(rqBody.GameID, header.UserID, rqBody.UserID)
+	if err != nil {
+		log.Printf("Could Not Tell Game %s about its new Owner: %v\n", rqBody.GameID, err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Gives ownership of a game to the player who has been on its roster
+// the longest. Players who already own as many games as their quota
+// allows are skipped. Used when the owner leaves or is removed.
+//
+// gameID  :: Unique Identifier for game in string form
+// ownerID :: Unique Identifier for the user currently owning the game
+//
+// returns -> string :: the new owner or "" if no player could take over
+//         -> error  :: non-nil if the database could not be read/written
+func handOverGame(gameID string, ownerID string) (string, error) {
+	return migrateHost(gameID, ownerID, 0)
+}
+
+// Passes a game on if its owner is idle or no longer on the roster.
+// Only players who have been active since the owner became idle may
+// take over (see OwnerIdleTimeout). Called when a player takes an
+// action.
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> string :: the new owner or "" if the game was not passed on
+//         -> error  :: non-nil if the database could not be read/written
+func migrateIdleOwner(gameID string) (string, error) {
+	owner, err := getGameOwner(gameID)
+	if err != nil || owner == "" {
+		return "", err
+	}
+
+	cutoff := (time.Now().UTC().UnixNano() - OwnerIdleTimeout.Nanoseconds()) / int64(time.Millisecond)
+
+	isInGame, err := IsUserInGame(owner, gameID)
+	if err != nil {
+		return "", err
+	} else if isInGame {
+		lastActive, err := playerLastActive(gameID, owner)
+		if err != nil || lastActive >= cutoff {
+			return "", err
+		}
+	}
+
+	return migrateHost(gameID, owner, cutoff)
+}
+
+// Gives ownership of a game to the longest present player on its
+// roster who has been active since activeSince (0 for any player).
+// The game is told about its new owner.
+func migrateHost(gameID string, ownerID string, activeSince int64) (string, error) {
+	candidates, err := hostCandidates(gameID, ownerID, activeSince)
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range candidates {
+		result, err := transferGame(gameID, ownerID, candidate)
+		if err != nil {
+			return "", err
+		} else if result == -1 {
+			// Someone else moved the game first
+			return "", nil
+		} else if result != 1 {
+			continue
+		}
+
+		err = notifyOwnerChanged(gameID, ownerID, candidate)
+		if err != nil {
+			log.Printf("Could Not Tell Game %s about its new Owner: %v\n", gameID, err)
+		}
+
+		return candidate, nil
+	}
+
+	return "", nil
+}
+
+// Moves a game between owners if the new owner is on the roster and
+// under their quota (see transferGameScript for the results)
+func transferGame(gameID string, ownerID string, newOwnerID string) (int, error) {
+	quota, err := UserGameQuota(newOwnerID)
+	if err != nil {
+		return 0, err
+	}
+
+	var result int
+	err = redis.MainRedis.Do(transferGameScript.Cmd(&result,
+		MetadataSetPrefix+gameID, OwnerGamesSetPrefix+ownerID, OwnerGamesSetPrefix+newOwnerID, PlayerSetPrefix+gameID,
+		ownerID, newOwnerID, gameID, fmt.Sprintf("%d", quota)))
+	return result, err
+}
+
+// Returns the players on a game's roster (except the owner) from the
+// longest present. Players who joined before join times were recorded
+// come first.
+func hostCandidates(gameID string, ownerID string, activeSince int64) ([]string, error) {
+	var roster []string
+	err := redis.MainRedis.Do(radix.Cmd(&roster, "SMEMBERS", PlayerSetPrefix+gameID))
+	if err != nil {
+		return nil, err
+	}
+
+	var joined []string
+	err = redis.MainRedis.Do(radix.Cmd(&joined, "ZRANGE", RosterJoinedPrefix+gameID, "0", "-1"))
+	if err != nil {
+		return nil, err
+	}
+
+	onRoster := make(map[string]bool, len(roster))
+	for _, player := range roster {
+		onRoster[player] = true
+	}
+
+	hasJoinTime := make(map[string]bool, len(joined))
+	for _, player := range joined {
+		hasJoinTime[player] = true
+	}
+
+	ordered := make([]string, 0, len(roster))
+	for _, player := range roster {
+		if !hasJoinTime[player] {
+			ordered = append(ordered, player)
+		}
+	}
+
+	for _, player := range joined {
+		if onRoster[player] {
+			ordered = append(ordered, player)
+		}
+	}
+
+	candidates := make([]string, 0, len(ordered))
+	for _, player := range ordered {
+		if player == ownerID {
+			continue
+		}
+
+		if activeSince > 0 {
+			lastActive, err := playerLastActive(gameID, player)
+			if err != nil {
+				return nil, err
+			} else if lastActive < activeSince {
+				continue
+			}
+		}
+
+		candidates = append(candidates, player)
+	}
+
+	return candidates, nil
+}
+
+// Tells the game about its new owner. The game's process is sent its
+// state with a GameEventOwnerChanged Server Event.
+//
+// gameID        :: Unique Identifier for game in string form
+// previousOwner :: Unique Identifier for the user who owned the game
+// owner         :: Unique Identifier for the user now owning the game
+//
+// returns -> error :: non-nil if the game could not be told
+func notifyOwnerChanged(gameID string, previousOwner string, owner string) error {
+	var state string
+	err := redis.MainRedis.Do(radix.Cmd(&state, "HGET", GameHashSetName, gameID))
+	if err != nil || len(state) == 0 {
+		return err
+	}
+
+	payload := actionServerPayload{
+		Relay: map[string]interface{}{}, // Empty JSON Object
+		ServerEvent: &gameServerEvent{
+			Event:         GameEventOwnerChanged,
+			GameID:        gameID,
+			Owner:         owner,
+			PreviousOwner: previousOwner,
+		},
+	}
+
+	err = json.Unmarshal([]byte(state), &payload.State)
+	if err != nil {
+		return err
+	}
+
+	gameType, err := GetGameType(gameID)
+	if err != nil {
+		return err
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = BytesToGame(gameType, string(payloadBytes))
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Roster Presence
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Records when a player joined a game's roster. Players who are already
+// recorded keep their join time.
+func recordRosterJoin(gameID string, authID string) error {
+	now := fmt.Sprintf("%d", time.Now().UTC().UnixNano()/int64(time.Millisecond))
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RosterJoinedPrefix+gameID, "NX", now, authID))
+}
+
+// Records a player's action in a game
+func recordPlayerActivity(gameID string, authID string) error {
+	now := fmt.Sprintf("%d", time.Now().UTC().UnixNano()/int64(time.Millisecond))
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RosterActivityPrefix+gameID, now, authID))
+}
+
+// Removes a player's join time and activity from a game
+func forgetRosterMember(gameID string, authID string) error {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZREM", RosterJoinedPrefix+gameID, authID))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZREM", RosterActivityPrefix+gameID, authID))
+}
+
+// Returns a player's last action in a game or when they joined if they
+// have not acted (milliseconds since epoch, 0 if neither is recorded)
+func playerLastActive(gameID string, authID string) (int64, error) {
+	for _, prefix := range []string{RosterActivityPrefix, RosterJoinedPrefix} {
+		var score string
+		err := redis.MainRedis.Do(radix.Cmd(&score, "ZSCORE", prefix+gameID, authID))
+		if err != nil {
+			return 0, err
+		} else if score == "" {
+			continue
+		}
+
+		lastActive, err := strconv.ParseFloat(score, 64)
+		return int64(lastActive), err
+	}
+
+	return 0, nil
+}
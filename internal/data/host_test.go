@@ -0,0 +1,121 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestHostMigration(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-1300"
+	playerIDs := []string{"-1301", "-1302", "-1303"}
+	allIDs := append([]string{ownerID}, playerIDs...)
+	deleteGamesForUsers(allIDs, t)
+
+	metadata, jsonResponse := createGameForUser(ownerID, t)
+	if metadata.Id == "" {
+		t.Fatalf("Game was not created! Response: %s\n", jsonResponse)
+	}
+
+	for _, playerID := range playerIDs {
+		welcome, jsonResponse := joinGameForUser(playerID, metadata.Id, t)
+		if welcome.Id != metadata.Id {
+			t.Fatalf("Could not Join Game! Response: %s\n", jsonResponse)
+		}
+	}
+
+	t.Run("Only Owners Transfer", func(t *testing.T) {
+		success := transferGameTestHelper(t, playerIDs[0], TransferGameCommandBody{GameID: metadata.Id, UserID: playerIDs[1]})
+		if success.Successful {
+			t.Errorf("Player Transferred a Game they do not Own!\n")
+		}
+
+		success = transferGameTestHelper(t, ownerID, TransferGameCommandBody{GameID: metadata.Id, UserID: "-1399"})
+		if success.Successful {
+			t.Errorf("Game was Transferred to a Player not on the Roster!\n")
+		}
+	})
+
+	t.Run("Players Can Not Fake Server Events", func(t *testing.T) {
+		relay := map[string]interface{}{reservedRelayKey: map[string]interface{}{"Event": GameEventOwnerChanged, "Owner": playerIDs[0]}}
+		success := commandTestHelper(t, playerIDs[0], policy.CmdAction, ApplyAction, applyActionRequest{GameID: metadata.Id, Relay: relay})
+		if success.Successful || success.Err == "" {
+			t.Errorf("Relay with the Reserved Key was Sent to the Game!\n")
+		}
+	})
+
+	t.Run("Owners Transfer To Roster", func(t *testing.T) {
+		success := transferGameTestHelper(t, ownerID, TransferGameCommandBody{GameID: metadata.Id, UserID: playerIDs[2]})
+		if !success.Successful {
+			t.Fatalf("Could not Transfer Game! Err: %s\n", success.Err)
+		}
+
+		hostTestHelper(t, metadata.Id, playerIDs[2], ownerID)
+	})
+
+	t.Run("Leaving Passes To Longest Present", func(t *testing.T) {
+		success, jsonResponse := leaveGameForUser(playerIDs[2], metadata.Id, t)
+		if !success.Successful {
+			t.Fatalf("Could not Leave Game! Response: %s\n", jsonResponse)
+		}
+
+		hostTestHelper(t, metadata.Id, ownerID, playerIDs[2])
+	})
+
+	t.Run("Idle Owners Pass The Game On", func(t *testing.T) {
+		// The owner has not acted since long ago
+		redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RosterActivityPrefix+metadata.Id, "0", ownerID))
+		redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RosterJoinedPrefix+metadata.Id, "0", playerIDs[0]))
+		recordPlayerActivity(metadata.Id, playerIDs[1])
+
+		newOwner, err := migrateIdleOwner(metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Passing On Game! Err: %v\n", err)
+		} else if newOwner != playerIDs[1] {
+			t.Errorf("Game was not Passed to the Active Player! New Owner: %s\n", newOwner)
+		}
+
+		hostTestHelper(t, metadata.Id, playerIDs[1], ownerID)
+
+		newOwner, err = migrateIdleOwner(metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Passing On Game! Err: %v\n", err)
+		} else if newOwner != "" {
+			t.Errorf("Game of an Active Owner was Passed On! New Owner: %s\n", newOwner)
+		}
+	})
+
+	deleteGamesForUsers(allIDs, t)
+}
+
+func transferGameTestHelper(t *testing.T, userID string, body TransferGameCommandBody) policy.SuccessfulData {
+	return commandTestHelper(t, userID, policy.CmdGameOwner, TransferGame, body)
+}
+
+// Checks the metadata and owned games Sets agree on the owner
+func hostTestHelper(t *testing.T, gameID string, ownerID string, previousOwnerID string) {
+	owner, err := getGameOwner(gameID)
+	if err != nil {
+		t.Fatalf("Error Reading Owner! Err: %v\n", err)
+	} else if owner != ownerID {
+		t.Errorf("Expected Owner %s but got %s!\n", ownerID, owner)
+	}
+
+	var isOwner, wasOwner bool
+	redis.MainRedis.Do(radix.Cmd(&isOwner, "SISMEMBER", OwnerGamesSetPrefix+ownerID, gameID))
+	redis.MainRedis.Do(radix.Cmd(&wasOwner, "SISMEMBER", OwnerGamesSetPrefix+previousOwnerID, gameID))
+	if !isOwner || wasOwner {
+		t.Errorf("Owned Games do not match the Metadata!\n")
+	}
+}
@@ -0,0 +1,501 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Leaderboard Tables
+
+// Redis Sorted Set Key Prefix for leaderboards. Concatenated with
+// <season>:<gameType>:<metric>. Scored by the metric's value.
+const LeaderboardPrefix string = "leaderboard:"
+
+// Redis Sorted Set Key Prefix for the leaderboards a user is on.
+// Concatenated with a UserID. Scored by the leaderboard's season.
+const UserLeaderboardsPrefix string = "userLeaderboards:"
+
+// Redis Key for the current leaderboard season
+const LeaderboardSeasonName string = "leaderboardSeason"
+
+// Redis HashTable Key for the start of each leaderboard season
+// (season -> seconds since epoch)
+const LeaderboardSeasonsName string = "leaderboardSeasons"
+
+//
+// Leaderboard Settings
+
+// Number of seasons kept (including the current season). Older seasons
+// are deleted when a new season starts.
+const LeaderboardSeasonsKept int = 12
+
+// Minimum length of a season. Keeps several servers from starting more
+// than one season on the same schedule.
+const LeaderboardMinSeasonLength time.Duration = time.Hour
+
+// Default and Maximum number of entries returned by the Leaderboard
+// Endpoint/Command
+const (
+	LeaderboardDefaultLimit int = 10
+	LeaderboardMaxLimit     int = 100
+)
+
+// Maximum number of custom stats from a game result added to the
+// leaderboards
+const MaxLeaderboardStats int = 16
+
+// Metrics updated from reported game results (see FinishGame). Numeric
+// custom stats of each player are added to a metric of the same name.
+const (
+	LeaderboardMetricWins   string = "wins"
+	LeaderboardMetricGames  string = "games"
+	LeaderboardMetricScore  string = "score"
+	LeaderboardMetricRating string = "rating"
+)
+
+// How an update changes a leaderboard value
+const (
+	// Adds to the value
+	LeaderboardModeAdd string = "add"
+
+	// Keeps the higher value
+	LeaderboardModeBest string = "best"
+
+	// Replaces the value
+	LeaderboardModeSet string = "set"
+)
+
+// Leaderboard Query Views
+const (
+	LeaderboardViewTop     string = "top"
+	LeaderboardViewAround  string = "around"
+	LeaderboardViewFriends string = "friends"
+)
+
+// Game types and metrics are used in Redis keys
+var leaderboardNameExpr *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Script for keeping the higher of two leaderboard values.
+//
+// KEYS[1] :: leaderboard Sorted Set
+// ARGV[1] :: authID
+// ARGV[2] :: value
+var bestLeaderboardScript = radix.NewEvalScript(1, `
+local current = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if current and tonumber(current) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// Script for starting a new season. Returns the new season or 0 if
+// the current season started too recently.
+//
+// KEYS[1] :: season key
+// KEYS[2] :: season start HashTable
+// ARGV[1] :: now (seconds since epoch)
+// ARGV[2] :: minimum season length (seconds)
+var startSeasonScript = radix.NewEvalScript(2, `
+local season = tonumber(redis.call('GET', KEYS[1]) or '1')
+local started = tonumber(redis.call('HGET', KEYS[2], season) or '0')
+if started > 0 and tonumber(ARGV[1]) - started < tonumber(ARGV[2]) then
+	return 0
+end
+
+season = season + 1
+redis.call('SET', KEYS[1], season)
+redis.call('HSET', KEYS[2], season, ARGV[1])
+return season
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Leaderboard Commands
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A change to a user's leaderboard value. Trusted game processes may
+// send these in the "Leaderboard" field of their response to an action
+// (see ApplyAction). The GameType of these is always the game's type.
+type LeaderboardUpdate struct {
+	UserID   string
+	GameType string
+	Metric   string
+	Value    float64
+
+	// LeaderboardModeAdd (default), LeaderboardModeBest, or
+	// LeaderboardModeSet
+	Mode string
+}
+
+// JSON Fields for the Leaderboard Endpoint/Command
+type LeaderboardCommandBody struct {
+	GameType string
+	Metric   string
+
+	// Season to look up (0 for the current season)
+	Season int
+
+	// LeaderboardViewTop (default), LeaderboardViewAround (entries
+	// around the request's user), or LeaderboardViewFriends (the
+	// request's user and their friends)
+	View  string
+	Limit int
+}
+
+// A user's place on a leaderboard
+type LeaderboardEntry struct {
+	UserID string
+
+	// Place on the leaderboard starting at 1
+	Rank  int
+	Value float64
+}
+
+// Response to the Leaderboard Endpoint/Command
+type Leaderboard struct {
+	GameType      string
+	Metric        string
+	Season        int
+	CurrentSeason int
+	Entries       []LeaderboardEntry
+}
+
+// Leaderboard Endpoint. Returns the top of a leaderboard, the entries
+// around the request's user, or the request's user and their friends.
+// Earlier seasons can be looked up until they are deleted (see
+// LeaderboardSeasonsKept).
+func GetLeaderboard(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := LeaderboardCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if !leaderboardNameExpr.MatchString(rqBody.GameType) || !leaderboardNameExpr.MatchString(rqBody.Metric) || rqBody.Season < 0 {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	limit := rqBody.Limit
+	if limit <= 0 {
+		limit = LeaderboardDefaultLimit
+	} else if limit > LeaderboardMaxLimit {
+		limit = LeaderboardMaxLimit
+	}
+
+	current, err := CurrentLeaderboardSeason()
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	season := rqBody.Season
+	if season == 0 {
+		season = current
+	} else if season > current {
+		return policy.UnSuccessfulResponse("Season Does Not Exist!")
+	}
+
+	board := Leaderboard{
+		GameType:      rqBody.GameType,
+		Metric:        rqBody.Metric,
+		Season:        season,
+		CurrentSeason: current,
+	}
+
+	key := leaderboardKey(season, rqBody.GameType, rqBody.Metric)
+	switch rqBody.View {
+	case "", LeaderboardViewTop:
+		board.Entries, err = leaderboardRange(key, 0, limit)
+
+	case LeaderboardViewAround:
+		var rank *int
+		err = redis.MainRedis.Do(radix.Cmd(&rank, "ZREVRANK", key, header.UserID))
+		if err != nil || rank == nil {
+			board.Entries = []LeaderboardEntry{}
+			break
+		}
+
+		start := *rank - limit/2
+		if start < 0 {
+			start = 0
+		}
+
+		board.Entries, err = leaderboardRange(key, start, limit)
+
+	case LeaderboardViewFriends:
+		board.Entries, err = leaderboardFriends(key, header.UserID, limit)
+
+	default:
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   board,
+		Digest: json.Marshal,
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Leaderboard Functions
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Changes a user's value on a leaderboard in the current season.
+//
+// update :: the change to make
+//
+// returns -> error :: non-nil if the update is malformed or the
+//                     database could not be read/written
+func UpdateLeaderboard(update LeaderboardUpdate) error {
+	if update.UserID == "" || !leaderboardNameExpr.MatchString(update.GameType) || !leaderboardNameExpr.MatchString(update.Metric) {
+		return errors.New("Malformed Leaderboard Update!")
+	}
+
+	season, err := CurrentLeaderboardSeason()
+	if err != nil {
+		return err
+	}
+
+	key := leaderboardKey(season, update.GameType, update.Metric)
+	value := strconv.FormatFloat(update.Value, 'f', -1, 64)
+
+	switch update.Mode {
+	case "", LeaderboardModeAdd:
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZINCRBY", key, value, update.UserID))
+
+	case LeaderboardModeBest:
+		err = redis.MainRedis.Do(bestLeaderboardScript.Cmd(nil, key, update.UserID, value))
+
+	case LeaderboardModeSet:
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", key, value, update.UserID))
+
+	default:
+		return errors.New("Unknown Leaderboard Mode: " + update.Mode)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return indexUserLeaderboard(update.UserID, season, key)
+}
+
+// Records that a user is on a leaderboard. Leaderboards of deleted
+// seasons are dropped from the user's index.
+func indexUserLeaderboard(authID string, season int, key string) error {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", UserLeaderboardsPrefix+authID, fmt.Sprintf("%d", season), key))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZREMRANGEBYSCORE", UserLeaderboardsPrefix+authID,
+		"-inf", fmt.Sprintf("%d", season-LeaderboardSeasonsKept)))
+}
+
+// Returns the current leaderboard season (starting at 1)
+func CurrentLeaderboardSeason() (int, error) {
+	var season string
+	err := redis.MainRedis.Do(radix.Cmd(&season, "GET", LeaderboardSeasonName))
+	if err != nil || season == "" {
+		return 1, err
+	}
+
+	return strconv.Atoi(season)
+}
+
+// Archives the current leaderboard season and starts a new one with
+// empty leaderboards. Earlier seasons stay queryable until more than
+// LeaderboardSeasonsKept seasons exist. Used by the cron scheduler.
+//
+// returns -> int   :: the new season (0 if the current season started
+//                     less than LeaderboardMinSeasonLength ago)
+//         -> error :: non-nil if the database could not be read/written
+func StartLeaderboardSeason() (int, error) {
+	var season int
+	err := redis.MainRedis.Do(startSeasonScript.Cmd(&season, LeaderboardSeasonName, LeaderboardSeasonsName,
+		fmt.Sprintf("%d", time.Now().UTC().Unix()), fmt.Sprintf("%d", int64(LeaderboardMinSeasonLength.Seconds()))))
+	if err != nil || season == 0 {
+		return 0, err
+	}
+
+	expired := season - LeaderboardSeasonsKept
+	if expired <= 0 {
+		return season, nil
+	}
+
+	scanner := radix.NewScanner(redis.MainRedis, radix.ScanOpts{Command: "SCAN", Pattern: fmt.Sprintf("%s%d:*", LeaderboardPrefix, expired)})
+
+	var key string
+	for scanner.Next(&key) {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", key))
+		if err != nil {
+			return season, err
+		}
+	}
+
+	err = scanner.Close()
+	if err != nil {
+		return season, err
+	}
+
+	return season, redis.MainRedis.Do(radix.Cmd(nil, "HDEL", LeaderboardSeasonsName, fmt.Sprintf("%d", expired)))
+}
+
+// Updates the leaderboards of a finished game's type from its results
+func recordLeaderboardResults(summary GameSummary, ratings map[string]Rating) error {
+	if summary.GameType == "" {
+		return nil
+	}
+
+	for _, result := range summary.Players {
+		updates := []LeaderboardUpdate{
+			{Metric: LeaderboardMetricGames, Value: 1, Mode: LeaderboardModeAdd},
+			{Metric: LeaderboardMetricScore, Value: result.Score, Mode: LeaderboardModeBest},
+		}
+
+		if result.Placement == 1 {
+			updates = append(updates, LeaderboardUpdate{Metric: LeaderboardMetricWins, Value: 1, Mode: LeaderboardModeAdd})
+		}
+
+		if rating, ok := ratings[result.UserID]; ok {
+			updates = append(updates, LeaderboardUpdate{Metric: LeaderboardMetricRating, Value: rating.Rating, Mode: LeaderboardModeSet})
+		}
+
+		stats := 0
+		for stat, value := range result.Stats {
+			number, ok := value.(float64)
+			if !ok || stats >= MaxLeaderboardStats || !leaderboardNameExpr.MatchString(stat) {
+				continue
+			}
+
+			stats++
+			updates = append(updates, LeaderboardUpdate{Metric: stat, Value: number, Mode: LeaderboardModeAdd})
+		}
+
+		for _, update := range updates {
+			update.UserID = result.UserID
+			update.GameType = summary.GameType
+
+			err := UpdateLeaderboard(update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns a page of leaderboard entries from the highest value down
+func leaderboardRange(key string, start int, limit int) ([]LeaderboardEntry, error) {
+	var values []string
+	err := redis.MainRedis.Do(radix.Cmd(&values, "ZREVRANGE", key,
+		fmt.Sprintf("%d", start), fmt.Sprintf("%d", start+limit-1), "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		value, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, LeaderboardEntry{
+			UserID: values[i],
+			Rank:   start + len(entries) + 1,
+			Value:  value,
+		})
+	}
+
+	return entries, nil
+}
+
+// Returns the leaderboard entries of a user and their friends from the
+// highest value down
+func leaderboardFriends(key string, authID string, limit int) ([]LeaderboardEntry, error) {
+	var friendIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&friendIDs, "SMEMBERS", FriendSetPrefix+authID))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []LeaderboardEntry{}
+	for _, userID := range append(friendIDs, authID) {
+		var rank *int
+		err = redis.MainRedis.Do(radix.Cmd(&rank, "ZREVRANK", key, userID))
+		if err != nil {
+			return nil, err
+		} else if rank == nil {
+			continue
+		}
+
+		var value float64
+		err = redis.MainRedis.Do(radix.Cmd(&value, "ZSCORE", key, userID))
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, LeaderboardEntry{UserID: userID, Rank: *rank + 1, Value: value})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rank < entries[j].Rank })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+// Removes a user from every leaderboard in every season. The
+// leaderboards are found with the user's index (see
+// UserLeaderboardsPrefix).
+func removeUserFromLeaderboards(authID string) error {
+	var keys []string
+	err := redis.MainRedis.Do(radix.Cmd(&keys, "ZRANGE", UserLeaderboardsPrefix+authID, "0", "-1"))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", key, authID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", UserLeaderboardsPrefix+authID))
+}
+
+// Key for a leaderboard (LeaderboardPrefix<season>:<gameType>:<metric>)
+func leaderboardKey(season int, gameType string, metric string) string {
+	return fmt.Sprintf("%s%d:%s:%s", LeaderboardPrefix, season, gameType, metric)
+}
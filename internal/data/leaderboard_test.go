@@ -0,0 +1,158 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const testBoardGameType string = "boardtest"
+
+func TestLeaderboards(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+		})
+	defer cleanup()
+
+	playerIDs := []string{"-1100", "-1101", "-1102", "-1103", "-1104"}
+	for _, playerID := range playerIDs {
+		removeUserFromLeaderboards(playerID)
+		deleteFriends(playerID)
+	}
+
+	for i, playerID := range playerIDs {
+		err := UpdateLeaderboard(LeaderboardUpdate{UserID: playerID, GameType: testBoardGameType, Metric: "points", Value: float64(10 * (i + 1))})
+		if err != nil {
+			t.Fatalf("Error Updating Leaderboard! Err: %v\n", err)
+		}
+	}
+
+	t.Run("Update Modes", func(t *testing.T) {
+		updates := []LeaderboardUpdate{
+			{Value: 5, Mode: LeaderboardModeAdd},
+			{Value: 12, Mode: LeaderboardModeBest},
+			{Value: 1, Mode: LeaderboardModeBest},
+		}
+
+		for _, update := range updates {
+			update.UserID = playerIDs[0]
+			update.GameType = testBoardGameType
+			update.Metric = "modes"
+
+			err := UpdateLeaderboard(update)
+			if err != nil {
+				t.Fatalf("Error Updating Leaderboard! Err: %v\n", err)
+			}
+		}
+
+		board := leaderboardTestHelper(t, playerIDs[0], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "modes"})
+		if len(board.Entries) != 1 || board.Entries[0].Value != 12 {
+			t.Errorf("Best Mode did not keep the higher Value! Leaderboard: %v\n", board)
+		}
+
+		err := UpdateLeaderboard(LeaderboardUpdate{UserID: playerIDs[0], GameType: testBoardGameType, Metric: "bad:metric", Value: 1})
+		if err == nil {
+			t.Errorf("Malformed Metric was Accepted!\n")
+		}
+	})
+
+	t.Run("Top Entries", func(t *testing.T) {
+		board := leaderboardTestHelper(t, playerIDs[0], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points", Limit: 2})
+		if len(board.Entries) != 2 {
+			t.Fatalf("Expected 2 Entries! Leaderboard: %v\n", board)
+		} else if board.Entries[0].UserID != playerIDs[4] || board.Entries[0].Rank != 1 || board.Entries[1].UserID != playerIDs[3] {
+			t.Errorf("Entries are out of Order! Leaderboard: %v\n", board)
+		}
+	})
+
+	t.Run("Entries Around Me", func(t *testing.T) {
+		board := leaderboardTestHelper(t, playerIDs[2], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points", View: LeaderboardViewAround, Limit: 3})
+		if len(board.Entries) != 3 {
+			t.Fatalf("Expected 3 Entries! Leaderboard: %v\n", board)
+		} else if board.Entries[1].UserID != playerIDs[2] || board.Entries[1].Rank != 3 {
+			t.Errorf("User is not in the Middle! Leaderboard: %v\n", board)
+		}
+	})
+
+	t.Run("Friend Entries", func(t *testing.T) {
+		for _, friendID := range []string{playerIDs[1], playerIDs[4]} {
+			redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendSetPrefix+playerIDs[0], friendID))
+			redis.MainRedis.Do(radix.Cmd(nil, "SADD", FriendSetPrefix+friendID, playerIDs[0]))
+		}
+
+		board := leaderboardTestHelper(t, playerIDs[0], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points", View: LeaderboardViewFriends})
+		if len(board.Entries) != 3 {
+			t.Fatalf("Expected 3 Entries! Leaderboard: %v\n", board)
+		} else if board.Entries[0].UserID != playerIDs[4] || board.Entries[0].Rank != 1 || board.Entries[2].UserID != playerIDs[0] || board.Entries[2].Rank != 5 {
+			t.Errorf("Friend Entries are wrong! Leaderboard: %v\n", board)
+		}
+	})
+
+	t.Run("Seasons Reset And Stay Queryable", func(t *testing.T) {
+		oldSeason, err := CurrentLeaderboardSeason()
+		if err != nil {
+			t.Fatalf("Error Reading Season! Err: %v\n", err)
+		}
+
+		// Let the season end early
+		redis.MainRedis.Do(radix.Cmd(nil, "HDEL", LeaderboardSeasonsName, fmt.Sprintf("%d", oldSeason)))
+		newSeason, err := StartLeaderboardSeason()
+		if err != nil {
+			t.Fatalf("Error Starting Season! Err: %v\n", err)
+		} else if newSeason != oldSeason+1 {
+			t.Fatalf("Expected Season %d but got %d!\n", oldSeason+1, newSeason)
+		}
+
+		defer func() {
+			redis.MainRedis.Do(radix.Cmd(nil, "SET", LeaderboardSeasonName, fmt.Sprintf("%d", oldSeason)))
+			redis.MainRedis.Do(radix.Cmd(nil, "HDEL", LeaderboardSeasonsName, fmt.Sprintf("%d", newSeason)))
+		}()
+
+		again, err := StartLeaderboardSeason()
+		if err != nil {
+			t.Fatalf("Error Starting Season! Err: %v\n", err)
+		} else if again != 0 {
+			t.Errorf("Season was Started Twice! Season: %d\n", again)
+		}
+
+		board := leaderboardTestHelper(t, playerIDs[0], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points"})
+		if board.Season != newSeason || len(board.Entries) != 0 {
+			t.Errorf("New Season was not Empty! Leaderboard: %v\n", board)
+		}
+
+		board = leaderboardTestHelper(t, playerIDs[0], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points", Season: oldSeason})
+		if board.CurrentSeason != newSeason || len(board.Entries) != len(playerIDs) {
+			t.Errorf("Earlier Season was not Queryable! Leaderboard: %v\n", board)
+		}
+	})
+
+	t.Run("Deleting Removes Every Entry", func(t *testing.T) {
+		err := removeUserFromLeaderboards(playerIDs[0])
+		if err != nil {
+			t.Fatalf("Error Removing User! Err: %v\n", err)
+		}
+
+		board := leaderboardTestHelper(t, playerIDs[1], LeaderboardCommandBody{GameType: testBoardGameType, Metric: "points"})
+		for _, entry := range board.Entries {
+			if entry.UserID == playerIDs[0] {
+				t.Errorf("User was not Removed from the Leaderboard!\n")
+			}
+		}
+	})
+
+	for _, playerID := range playerIDs {
+		removeUserFromLeaderboards(playerID)
+		deleteFriends(playerID)
+	}
+}
+
+func leaderboardTestHelper(t *testing.T, userID string, body LeaderboardCommandBody) Leaderboard {
+	var board Leaderboard
+	endpointTestHelper(t, userID, policy.CmdLeaderboard, GetLeaderboard, body, &board)
+	return board
+}
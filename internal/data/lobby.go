@@ -0,0 +1,456 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Lobby Indexes
+
+// Redis Key for the Sorted Set of Games by Creation DateTime
+// (number of seconds since epoch)
+const GameCreatedSetName string = "gamesByCreation"
+
+// Redis Key for the Sorted Set of Games by Last Used DateTime
+// (number of seconds since epoch)
+const GameActivitySetName string = "gamesByActivity"
+
+//
+// Game Tags
+
+// Maximum Number of Tags on a Game
+const MaxGameTags int = 8
+
+// Maximum Length of a Game Tag
+const GameTagMax int = 32
+
+//
+// Listing Games
+
+// Ways to sort the List Games Endpoint/Command. Both are newest first.
+const (
+	GameSortActivity string = "activity"
+	GameSortAge      string = "age"
+)
+
+// Default and Maximum number of games returned by the List Games
+// Endpoint/Command
+const (
+	GameListDefaultLimit int = 20
+	GameListMaxLimit     int = 100
+)
+
+// Number of games read at a time from the indexes when listing games
+const GameListBatchSize int = 100
+
+// Maximum number of games looked at by one List Games request. When
+// filters match few games a cursor is returned before the limit is
+// reached so a request never walks every game.
+const GameListMaxScanned int = 1000
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Lobby
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the List Games Endpoint/Command. Empty fields are not
+// filtered on. Times are the number of seconds since epoch.
+type ListGamesCommandBody struct {
+	// GameSortActivity (default) or GameSortAge
+	Sort string
+
+	// Cursor from the previous page ("" for the first page)
+	Cursor string
+
+	// Maximum number of games (see GameListMaxLimit)
+	Limit int
+
+	// Only games with fewer players than their MaxPlayers
+	OpenSlots bool
+
+	// Only games owned by this UserID
+	Owner string
+
+	CreatedAfter  int64
+	CreatedBefore int64
+	ActiveAfter   int64
+	ActiveBefore  int64
+
+	// Only games with every one of these tags
+	Tags []string
+}
+
+// A Game in the Lobby
+type GameListing struct {
+	GameMetadata
+	NumPlayers uint16
+}
+
+// Response to the List Games Endpoint/Command. Cursor is "" when there
+// are no more games.
+type GameList struct {
+	Games  []GameListing
+	Cursor string
+}
+
+// List Games Endpoint. Players may page through existing public games
+// sorted by last activity or creation time. Games are filtered by open
+// slots, owner, creation time, last activity, and tags.
+//
+// Games sorted by activity move to the front when they are used, so a
+// game may be skipped or seen twice across pages.
+func ListGames(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := ListGamesCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	tags, err := normalizeGameTags(rqBody.Tags)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	limit := rqBody.Limit
+	if limit <= 0 {
+		limit = GameListDefaultLimit
+	} else if limit > GameListMaxLimit {
+		limit = GameListMaxLimit
+	}
+
+	// Bounds on the index being sorted by are given to Redis. The
+	// others are filtered below.
+	index := GameActivitySetName
+	after, before := rqBody.ActiveAfter, rqBody.ActiveBefore
+	if rqBody.Sort == GameSortAge {
+		index = GameCreatedSetName
+		after, before = rqBody.CreatedAfter, rqBody.CreatedBefore
+	} else if rqBody.Sort != "" && rqBody.Sort != GameSortActivity {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	max := "+inf"
+	if before > 0 {
+		max = fmt.Sprintf("%d", before)
+	}
+
+	min := "-inf"
+	if after > 0 {
+		min = fmt.Sprintf("%d", after)
+	}
+
+	var cursorScore int64
+	var cursorID string
+	if rqBody.Cursor != "" {
+		cursorScore, cursorID, err = parseGameCursor(rqBody.Cursor)
+		if err != nil {
+			log.Printf("Bad Argument! Error: %v\n", err)
+			return policy.UnSuccessfulResponse("Bad Arguments!")
+		}
+
+		if before <= 0 || cursorScore < before {
+			max = fmt.Sprintf("%d", cursorScore)
+		}
+	}
+
+	result := GameList{Games: make([]GameListing, 0)}
+	stale := make([]string, 0)
+	scanned := 0
+	exhausted := false
+
+	var lastScore int64
+	var lastID string
+
+	for offset := 0; !exhausted && len(result.Games) < limit && scanned < GameListMaxScanned; offset += GameListBatchSize {
+		var entries []string
+		err = redis.MainRedis.Do(radix.Cmd(&entries, "ZREVRANGEBYSCORE", index, max, min, "WITHSCORES",
+			"LIMIT", fmt.Sprintf("%d", offset), fmt.Sprintf("%d", GameListBatchSize)))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		exhausted = len(entries)/2 < GameListBatchSize
+
+		for i := 0; i+1 < len(entries); i += 2 {
+			// Entries are left in this batch, so the list is not exhausted
+			if len(result.Games) >= limit || scanned >= GameListMaxScanned {
+				exhausted = false
+				break
+			}
+
+			gameID := entries[i]
+			score, err := strconv.ParseFloat(entries[i+1], 64)
+			if err != nil {
+				return policy.RespWithError(err)
+			}
+
+			// Games tied with the cursor come after it when their ID is smaller
+			if cursorID != "" && int64(score) == cursorScore && gameID >= cursorID {
+				continue
+			}
+
+			scanned++
+			lastScore, lastID = int64(score), gameID
+
+			listing, exists, err := getGameListing(gameID)
+			if err != nil {
+				return policy.RespWithError(err)
+			} else if !exists {
+				stale = append(stale, gameID)
+				continue
+			} else if listing.Visibility != GameVisibilityPublic && listing.Owner != header.UserID {
+				// Unlisted and Private games are only listed for their owner
+				continue
+			}
+
+			if gameListingMatches(listing, rqBody, tags) {
+				result.Games = append(result.Games, listing)
+			}
+		}
+	}
+
+	if !exhausted && lastID != "" {
+		result.Cursor = fmt.Sprintf("%d:%s", lastScore, lastID)
+	}
+
+	for _, gameID := range stale {
+		err = unindexGame(gameID)
+		if err != nil {
+			log.Printf("Error Removing Stale Game %s from the Lobby! Err: %v\n", gameID, err)
+		}
+	}
+
+	return policy.CommandResponse{
+		Data:   result,
+		Digest: json.Marshal,
+	}
+}
+
+// Adds a new game to the lobby indexes (see ListGames)
+//
+// metadata :: metadata of the created game
+//
+// returns -> error :: non-nil if the database could not be written to
+func indexGame(metadata GameMetadata) error {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameCreatedSetName, fmt.Sprintf("%d", metadata.CreatedAt), metadata.Id))
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameActivitySetName, fmt.Sprintf("%d", metadata.LastUsed), metadata.Id))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "RPUSH", GameListName, metadata.Id))
+}
+
+// Removes a game from the lobby indexes and the game list
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> error :: non-nil if the database could not be written to
+func unindexGame(gameID string) error {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GameCreatedSetName, gameID))
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GameActivitySetName, gameID))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "LREM", GameListName, "0", gameID))
+}
+
+// Records that a game was just used. Updates the Last Used metadata
+// and moves the game to the front of the activity index.
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> error :: non-nil if the database could not be written to
+func touchGame(gameID string) error {
+	now := fmt.Sprintf("%d", time.Now().UTC().Unix())
+	err := redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+gameID, MetadataSetLastUsed, now))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameActivitySetName, "XX", now, gameID))
+}
+
+// Adds games created before the lobby indexes existed to them. Only
+// runs when the indexes are empty.
+//
+// returns -> error :: non-nil if the database could not be read/written
+func backfillGameIndexes() error {
+	var indexed int
+	err := redis.MainRedis.Do(radix.Cmd(&indexed, "ZCARD", GameCreatedSetName))
+	if err != nil || indexed > 0 {
+		return err
+	}
+
+	var gameIDs []string
+	err = redis.MainRedis.Do(radix.Cmd(&gameIDs, "HKEYS", GameHashSetName))
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		metadata, err := GetGameMetadata(gameID)
+		if err != nil {
+			log.Printf("Could Not Index Game %s! Err: %v\n", gameID, err)
+			continue
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameCreatedSetName, fmt.Sprintf("%d", metadata.CreatedAt), gameID))
+		if err != nil {
+			return err
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameActivitySetName, fmt.Sprintf("%d", metadata.LastUsed), gameID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Loads a game for the lobby
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> GameListing :: metadata and number of players of the game
+//         -> bool        :: false if the game no longer exists
+//         -> error       :: non-nil if the database could not be read
+func getGameListing(gameID string) (GameListing, bool, error) {
+	var exists bool
+	err := redis.MainRedis.Do(radix.Cmd(&exists, "EXISTS", MetadataSetPrefix+gameID))
+	if err != nil || !exists {
+		return GameListing{}, false, err
+	}
+
+	metadata, err := GetGameMetadata(gameID)
+	if err != nil {
+		return GameListing{}, false, err
+	}
+
+	listing := GameListing{GameMetadata: metadata}
+	err = redis.MainRedis.Do(radix.Cmd(&listing.NumPlayers, "SCARD", PlayerSetPrefix+gameID))
+	if err != nil {
+		return GameListing{}, false, err
+	}
+
+	return listing, true, nil
+}
+
+// Returns whether a game passes the filters of a List Games request
+//
+// listing :: the game
+// filters :: the List Games request
+// tags    :: the request's tags (see normalizeGameTags)
+func gameListingMatches(listing GameListing, filters ListGamesCommandBody, tags []string) bool {
+	if filters.OpenSlots && listing.MaxPlayers > 0 && listing.NumPlayers >= listing.MaxPlayers {
+		return false
+	} else if filters.Owner != "" && listing.Owner != filters.Owner {
+		return false
+	} else if filters.CreatedAfter > 0 && listing.CreatedAt < filters.CreatedAfter {
+		return false
+	} else if filters.CreatedBefore > 0 && listing.CreatedAt > filters.CreatedBefore {
+		return false
+	} else if filters.ActiveAfter > 0 && listing.LastUsed < filters.ActiveAfter {
+		return false
+	} else if filters.ActiveBefore > 0 && listing.LastUsed > filters.ActiveBefore {
+		return false
+	}
+
+	for _, tag := range tags {
+		found := false
+		for _, gameTag := range listing.Tags {
+			if gameTag == tag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Lowercases and removes duplicate game tags. Tags may only have
+// letters, numbers, and dashes.
+//
+// tags :: tags from a request
+//
+// returns -> []string :: the normalized tags
+//         -> error    :: non-nil if a tag is invalid or there are too many
+func normalizeGameTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if len(tag) == 0 || len(tag) > GameTagMax {
+			return nil, errors.New("Game Tag has an Invalid Length!")
+		}
+
+		for _, c := range tag {
+			if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+				return nil, errors.New("Game Tag has an Invalid Character!")
+			}
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	if len(result) > MaxGameTags {
+		return nil, errors.New("Too Many Game Tags!")
+	}
+
+	return result, nil
+}
+
+// Parses a List Games cursor of the form <score>:<gameID>
+func parseGameCursor(cursor string) (int64, string, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", errors.New("Malformed Cursor!")
+	}
+
+	score, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return score, parts[1], nil
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestListGames(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerIDs := []string{"-400", "-401", "-402"}
+	deleteGamesForUsers(ownerIDs, t)
+
+	since := time.Now().UTC().Unix()
+	full := createGameWithArgsForUser(t, ownerIDs[0], CreateGameCommandBody{MaxPlayers: 1, Tags: []string{"LobbyTest", "ranked"}})
+	open := createGameWithArgsForUser(t, ownerIDs[1], CreateGameCommandBody{MaxPlayers: 4, Tags: []string{"lobbytest"}})
+	unlimited := createGameWithArgsForUser(t, ownerIDs[2], CreateGameCommandBody{Tags: []string{"lobbytest", "casual"}})
+	if full.Id == "" || open.Id == "" || unlimited.Id == "" {
+		t.Fatalf("Games were not created!\n")
+	}
+
+	if len(full.Tags) != 2 || full.Tags[0] != "lobbytest" {
+		t.Errorf("Tags were not normalized! Tags: %v\n", full.Tags)
+	}
+
+	filterTests := []struct {
+		name     string
+		body     ListGamesCommandBody
+		expected []string
+	}{
+		{"Tags", ListGamesCommandBody{Tags: []string{"lobbytest"}}, []string{full.Id, open.Id, unlimited.Id}},
+		{"Every Tag", ListGamesCommandBody{Tags: []string{"lobbytest", "ranked"}}, []string{full.Id}},
+		{"Open Slots", ListGamesCommandBody{Tags: []string{"lobbytest"}, OpenSlots: true}, []string{open.Id, unlimited.Id}},
+		{"Owner", ListGamesCommandBody{Owner: ownerIDs[1], CreatedAfter: since}, []string{open.Id}},
+		{"Created Before", ListGamesCommandBody{Tags: []string{"lobbytest"}, CreatedBefore: since - 1}, []string{}},
+	}
+
+	for _, test := range filterTests {
+		t.Run(test.name, func(t *testing.T) {
+			list := listGamesTestHelper(t, ownerIDs[0], test.body)
+			if !sameGameIDs(list.Games, test.expected) {
+				t.Errorf("Expected Games %v but got %v\n", test.expected, list.Games)
+			}
+		})
+	}
+
+	t.Run("Pages Follow The Cursor", func(t *testing.T) {
+		seen := make([]GameListing, 0)
+		body := ListGamesCommandBody{Sort: GameSortAge, Tags: []string{"lobbytest"}, Limit: 1}
+
+		for page := 0; page < 5; page++ {
+			list := listGamesTestHelper(t, ownerIDs[0], body)
+			seen = append(seen, list.Games...)
+			if list.Cursor == "" {
+				break
+			}
+			body.Cursor = list.Cursor
+		}
+
+		if !sameGameIDs(seen, []string{full.Id, open.Id, unlimited.Id}) {
+			t.Errorf("Pages did not return every game once! Games: %v\n", seen)
+		}
+	})
+
+	t.Run("Deleted Games Are Not Listed", func(t *testing.T) {
+		deleteGamesForUsers([]string{ownerIDs[2]}, t)
+
+		list := listGamesTestHelper(t, ownerIDs[0], ListGamesCommandBody{Tags: []string{"lobbytest"}})
+		if !sameGameIDs(list.Games, []string{full.Id, open.Id}) {
+			t.Errorf("Deleted Game was Listed! Games: %v\n", list.Games)
+		}
+
+		var gameList []string
+		err := redis.MainRedis.Do(radix.Cmd(&gameList, "LRANGE", GameListName, "0", "-1"))
+		if err != nil {
+			t.Fatalf("Error Reading Game List! Err: %v\n", err)
+		}
+
+		for _, gameID := range gameList {
+			if gameID == unlimited.Id {
+				t.Errorf("Deleted Game was left in the Game List!\n")
+			}
+		}
+	})
+
+	t.Run("Stale Games Are Removed", func(t *testing.T) {
+		staleID := "staleLobbyGame"
+		err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameActivitySetName, fmt.Sprintf("%d", time.Now().UTC().Unix()), staleID))
+		if err != nil {
+			t.Fatalf("Error Adding Stale Game! Err: %v\n", err)
+		}
+
+		listGamesTestHelper(t, ownerIDs[0], ListGamesCommandBody{ActiveAfter: since})
+
+		var score string
+		err = redis.MainRedis.Do(radix.Cmd(&score, "ZSCORE", GameActivitySetName, staleID))
+		if err != nil {
+			t.Fatalf("Error Reading Activity Index! Err: %v\n", err)
+		} else if score != "" {
+			t.Errorf("Stale Game was not removed from the Activity Index!\n")
+		}
+	})
+
+	t.Run("Invalid Tags Are Rejected", func(t *testing.T) {
+		_, err := normalizeGameTags([]string{"no spaces"})
+		if err == nil {
+			t.Errorf("Invalid Tag was Accepted!\n")
+		}
+	})
+
+	deleteGamesForUsers(ownerIDs, t)
+}
+
+func createGameWithArgsForUser(t *testing.T, userID string, body CreateGameCommandBody) GameMetadata {
+	request, err := policy.RequestWithUserForTesting(userID, false, policy.CmdGameCreate, body)
+	if err != nil {
+		t.Errorf("Error Creating Request Payload for creating Game!")
+	}
+
+	response := CreateGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Got Error From Create Game Request! Err: %v\n", response.ServerError)
+	}
+
+	var metadata GameMetadata
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response From Create Game! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &metadata)
+
+	return metadata
+}
+
+func listGamesTestHelper(t *testing.T, userID string, body ListGamesCommandBody) GameList {
+	var list GameList
+	endpointTestHelper(t, userID, policy.CmdGameList, ListGames, body, &list)
+	return list
+}
+
+func sameGameIDs(games []GameListing, expected []string) bool {
+	if len(games) != len(expected) {
+		return false
+	}
+
+	remaining := make(map[string]int, len(expected))
+	for _, gameID := range expected {
+		remaining[gameID]++
+	}
+
+	for _, game := range games {
+		if remaining[game.Id] == 0 {
+			return false
+		}
+		remaining[game.Id]--
+	}
+
+	return true
+}
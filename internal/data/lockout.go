@@ -0,0 +1,219 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Login Failure Tables
+
+// Redis Key Prefix for Failed Login Counters. Concatenated with
+// "user:" and a username or "ip:" and an IP Address
+const LoginFailurePrefix string = "loginFailures:"
+
+// Redis Key Prefix for Login Backoff. The key exists (with a TTL)
+// while logins are being slowed down.
+const LoginBackoffPrefix string = "loginBackoff:"
+
+// Redis Key Prefix for Login Lockout. The key exists (with a TTL)
+// while logins are locked.
+const LoginLockPrefix string = "loginLock:"
+
+//
+// Login Failure Limits
+
+// Time without a failed login before the failure counter is forgotten
+const LoginFailureDecay time.Duration = 15 * time.Minute
+
+// Failed logins before logins are slowed down
+const LoginBackoffThreshold int = 3
+
+// Delay after reaching LoginBackoffThreshold. The delay doubles with
+// each failure after that.
+const LoginBackoffBase time.Duration = time.Second
+
+// Longest delay between logins before the lockout
+const LoginBackoffMax time.Duration = time.Minute
+
+// Failed logins for a username before it is locked
+const LoginLockoutThreshold int = 10
+
+// Failed logins from an IP Address before it is locked. Higher than
+// LoginLockoutThreshold since many users may share an address.
+const LoginIPLockoutThreshold int = 50
+
+// Time logins stay locked for (unless unlocked by an administrator)
+const LoginLockoutDuration time.Duration = 15 * time.Minute
+
+// Script for atomically recording a failed login. The counter decays
+// after LoginFailureDecay without failures. Returns the new count.
+//
+// KEYS[1] :: failure counter
+// KEYS[2] :: backoff key
+// KEYS[3] :: lock key
+// ARGV[1] :: decay (milliseconds)
+// ARGV[2] :: backoff threshold
+// ARGV[3] :: backoff base (milliseconds)
+// ARGV[4] :: backoff max (milliseconds)
+// ARGV[5] :: lockout threshold
+// ARGV[6] :: lockout duration (milliseconds)
+var recordLoginFailureScript = radix.NewEvalScript(3, `
+local count = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+
+if count >= tonumber(ARGV[5]) then
+	redis.call('SET', KEYS[3], '1', 'PX', ARGV[6])
+elseif count >= tonumber(ARGV[2]) then
+	local delay = tonumber(ARGV[3]) * 2 ^ (count - tonumber(ARGV[2]))
+	delay = math.min(delay, tonumber(ARGV[4]))
+	redis.call('SET', KEYS[2], '1', 'PX', math.floor(delay))
+end
+
+return count
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Login Lockout
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Unlock Login Endpoint/Command. Either field may
+// be left empty.
+type UnlockLoginCommandBody struct {
+	Username string
+	IP       string
+}
+
+// Unlock Login Endpoint. Administrators may clear the failed logins,
+// backoff, and lockout for a username and/or IP Address.
+func UnlockLogin(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := UnlockLoginCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.Username == "" && rqBody.IP == "" {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	err = ClearLoginFailures(rqBody.Username, rqBody.IP)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditAdminAction, rqBody.Username, AuditSuccess, "Unlock Login "+rqBody.IP)
+	return policy.SuccessfulResponse()
+}
+
+// Returns whether a login may be attempted for the username from the IP
+// Address.
+//
+// username :: username being logged into
+// ip       :: IP Address the login came from (may be empty)
+//
+// returns -> string :: "" if the login may be attempted otherwise
+//                      the response code (i.e. policy.CodeAccountLocked)
+//         -> error  :: non-nil if the database could not be read
+func CheckLoginAllowed(username string, ip string) (string, error) {
+	keys := loginFailureKeys(username, ip)
+
+	for _, key := range keys {
+		var locked int
+		err := redis.MainRedis.Do(radix.Cmd(&locked, "EXISTS", LoginLockPrefix+key))
+		if err != nil {
+			return "", err
+		} else if locked > 0 {
+			return policy.CodeAccountLocked, nil
+		}
+	}
+
+	for _, key := range keys {
+		var backoff int
+		err := redis.MainRedis.Do(radix.Cmd(&backoff, "EXISTS", LoginBackoffPrefix+key))
+		if err != nil {
+			return "", err
+		} else if backoff > 0 {
+			return policy.CodeLoginBackoff, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Records a failed login for the username and the IP Address. Enough
+// failures start the backoff and then the lockout.
+//
+// username :: username being logged into
+// ip       :: IP Address the login came from (may be empty)
+func RecordLoginFailure(username string, ip string) error {
+	for _, key := range loginFailureKeys(username, ip) {
+		lockoutThreshold := LoginLockoutThreshold
+		if key == "ip:"+ip {
+			lockoutThreshold = LoginIPLockoutThreshold
+		}
+
+		err := redis.MainRedis.Do(recordLoginFailureScript.Cmd(nil,
+			LoginFailurePrefix+key, LoginBackoffPrefix+key, LoginLockPrefix+key,
+			fmt.Sprintf("%d", LoginFailureDecay.Milliseconds()),
+			fmt.Sprintf("%d", LoginBackoffThreshold),
+			fmt.Sprintf("%d", LoginBackoffBase.Milliseconds()),
+			fmt.Sprintf("%d", LoginBackoffMax.Milliseconds()),
+			fmt.Sprintf("%d", lockoutThreshold),
+			fmt.Sprintf("%d", LoginLockoutDuration.Milliseconds())))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clears the failed logins, backoff, and lockout for a username and
+// IP Address. Used after a successful login (for the username only)
+// and to unlock.
+//
+// username :: username to clear (may be empty)
+// ip       :: IP Address to clear (may be empty)
+func ClearLoginFailures(username string, ip string) error {
+	for _, key := range loginFailureKeys(username, ip) {
+		err := redis.MainRedis.Do(radix.Cmd(nil, "DEL", LoginFailurePrefix+key, LoginBackoffPrefix+key, LoginLockPrefix+key))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the key suffixes for the username and IP Address counters.
+// Empty values and usernames too large to be stored are skipped.
+func loginFailureKeys(username string, ip string) []string {
+	keys := make([]string, 0, 2)
+
+	if username != "" && len(username) <= redis.RedisKeyMax {
+		keys = append(keys, "user:"+username)
+	}
+
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+
+	return keys
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+)
+
+func TestLoginLockout(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "LOCKOUT"
+	adminUsername := testUserNamePrefix + "LOCKOUTADMIN"
+	password := "SomeP@ssword123"
+	ip := "192.0.2.1"
+	otherIP := "192.0.2.2"
+	DeleteUser(validUsername)
+	DeleteUser(adminUsername)
+	ClearLoginFailures(validUsername, ip)
+	ClearLoginFailures("", otherIP)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, adminUsername, password)
+	adminID := getUserTestHelper(t, adminUsername)
+
+	// Failures below the threshold do not slow down logins
+	for i := 1; i < LoginBackoffThreshold; i++ {
+		loginLockoutTestHelper(t, validUsername, "NOTtheRightPassword", otherIP)
+	}
+	lockoutCodeTestHelper(t, validUsername, otherIP, "")
+
+	// A successful login clears the failures
+	loginUserSuccess(t, validUsername, password)
+
+	// Reaching the threshold slows down logins
+	for i := 0; i < LoginBackoffThreshold; i++ {
+		loginLockoutTestHelper(t, validUsername, "NOTtheRightPassword", ip)
+	}
+	lockoutCodeTestHelper(t, validUsername, ip, policy.CodeLoginBackoff)
+
+	// Even correct logins are rejected with the code
+	success := loginLockoutTestHelper(t, validUsername, password, ip)
+	if success.Code != policy.CodeLoginBackoff {
+		t.Errorf("Expected Code %s but got %s\n", policy.CodeLoginBackoff, success.Code)
+	}
+
+	// Reaching the lockout threshold locks logins
+	for i := LoginBackoffThreshold; i < LoginLockoutThreshold; i++ {
+		err := RecordLoginFailure(validUsername, ip)
+		if err != nil {
+			t.Fatalf("Error Recording Login Failure! Err: %v\n", err)
+		}
+	}
+	lockoutCodeTestHelper(t, validUsername, ip, policy.CodeAccountLocked)
+
+	// Only administrators can unlock
+	req, err := policy.RequestWithUserForTesting(adminID, false, policy.CmdUnlockUser, UnlockLoginCommandBody{Username: validUsername, IP: ip})
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	UnlockLogin(req.Header, req.BodyFactories, req.IsSecureConnection)
+	lockoutCodeTestHelper(t, validUsername, ip, policy.CodeAccountLocked)
+
+	err = SetRole(adminID, RoleAdmin)
+	if err != nil {
+		t.Fatalf("Error Setting Role! Err: %v\n", err)
+	}
+
+	UnlockLogin(req.Header, req.BodyFactories, req.IsSecureConnection)
+	lockoutCodeTestHelper(t, validUsername, ip, "")
+	loginUserSuccess(t, validUsername, password)
+
+	ClearLoginFailures("", otherIP)
+	DeleteUser(validUsername)
+	DeleteUser(adminUsername)
+}
+
+func loginLockoutTestHelper(t *testing.T, username string, password string, ip string) policy.SuccessfulData {
+	body := LoginCommandBody{Username: username, Password: password}
+	req, err := policy.RequestWithUserForTesting("", false, policy.CmdLogin, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+	req.Header.RemoteAddr = ip
+
+	// Sessions are raw tokens, so successful logins leave success empty
+	var success policy.SuccessfulData
+	requestTestHelper(t, req, Login, &success)
+	return success
+}
+
+func lockoutCodeTestHelper(t *testing.T, username string, ip string, expected string) {
+	code, err := CheckLoginAllowed(username, ip)
+	if err != nil {
+		t.Errorf("Error Checking Login! Err: %v\n", err)
+	} else if code != expected {
+		t.Errorf("Expected Code \"%s\" but got \"%s\"\n", expected, code)
+	}
+}
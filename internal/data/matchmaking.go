@@ -0,0 +1,629 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Matchmaking Tables
+
+// Redis Sorted Set Key Prefix for a matchmaking queue. Concatenated with
+// a queue name (<gameType>:<partySize>). Scores are when each user
+// queued (milliseconds since epoch)
+const MatchQueuePrefix string = "matchQueue:"
+
+// Redis Hash Key Prefix for a user's matchmaking ticket. Concatenated
+// with a UserID
+const MatchTicketPrefix string = "matchTicket:"
+
+// Redis Key Prefix for the lock held while matching a queue.
+// Concatenated with a queue name. The value is a random token only the
+// holder knows (see releaseMatchLockScript)
+const MatchLockPrefix string = "matchLock:"
+
+// Number of random bytes in a Match Lock token
+const matchLockTokenBytes int = 16
+
+// Fields for the Redis Matchmaking Ticket Hash
+const (
+	matchTicketGameType  string = "gameType"
+	matchTicketPartySize string = "partySize"
+	matchTicketRating    string = "rating"
+	matchTicketQueuedAt  string = "queuedAt"
+	matchTicketStatus    string = "status"
+	matchTicketGameID    string = "gameID"
+)
+
+//
+// Matchmaking Settings
+
+// Smallest and largest number of players matched into one game
+const (
+	MinMatchPartySize int = 2
+	MaxMatchPartySize int = 16
+)
+
+// Time a user can wait in a queue before their ticket times out
+var MatchTimeout time.Duration = 5 * time.Minute
+
+// Time a finished ticket (matched, cancelled, timed out) can be polled
+const MatchStatusLifetime time.Duration = 10 * time.Minute
+
+// Time a matcher holds the lock on a queue. Longer than a matching
+// run should ever take.
+const MatchLockDuration time.Duration = 30 * time.Second
+
+// Script for atomically releasing a Match Lock. The lock is only
+// deleted if it still holds the token, so a matcher whose lock expired
+// never releases the lock of the next matcher.
+//
+// KEYS[1] :: Match Lock Key
+// ARGV[1] :: token the lock was taken with
+var releaseMatchLockScript = radix.NewEvalScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+
+return 0
+`)
+
+// Rating used for tickets without a readable rating
+const MatchDefaultRating float64 = DefaultRating
+
+// Largest difference in rating between players in a match. The
+// difference grows by MatchSpreadGrowth for every MatchSpreadInterval
+// the longest waiting player has been queued.
+const (
+	MatchRatingSpread   float64       = 100
+	MatchSpreadGrowth   float64       = 50
+	MatchSpreadInterval time.Duration = 15 * time.Second
+)
+
+// Maximum number of users looked at by one matching run of a queue
+const MatchBatchSize int = 1000
+
+// Statuses of a Matchmaking Ticket
+const (
+	MatchStatusNone      string = "none"
+	MatchStatusQueued    string = "queued"
+	MatchStatusMatched   string = "matched"
+	MatchStatusCancelled string = "cancelled"
+	MatchStatusTimedOut  string = "timedOut"
+)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Matchmaking
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Queue for Match Endpoint/Command
+type MatchQueueCommandBody struct {
+	// Type of game to play (letters, numbers, and dashes). Matches
+	// are created with the registered game type of the same name
+	// (see GameTypes)
+	GameType string
+
+	// Number of players to match into one game
+	PartySize int
+}
+
+// Response to the Matchmaking Endpoints/Commands
+type MatchStatus struct {
+	Status    string
+	GameType  string `json:",omitempty"`
+	PartySize int    `json:",omitempty"`
+	Rating    float64
+
+	// When the user queued (milliseconds since epoch)
+	QueuedAt int64 `json:",omitempty"`
+
+	// Game the user was matched into
+	GameID string `json:",omitempty"`
+}
+
+// A user waiting in a matchmaking queue
+type matchTicket struct {
+	AuthID   string
+	Rating   float64
+	QueuedAt int64
+}
+
+// Queue for Match Endpoint. Adds the user to the matchmaking queue for a
+// game type and party size. The scheduler matches users periodically
+// (see RunMatchmaking). Users poll their status to find their game.
+func QueueForMatch(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := MatchQueueCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	gameType, err := normalizeGameTags([]string{rqBody.GameType})
+	if err != nil || rqBody.PartySize < MinMatchPartySize || rqBody.PartySize > MaxMatchPartySize {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if _, exists := GameTypes[gameType[0]]; !exists {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	args := CreateGameCommandBody{GameType: gameType[0], MaxPlayers: uint16(rqBody.PartySize)}
+	if !applyGameTypeSettings(&args) {
+		return policy.UnSuccessfulResponse("Too Many Players for the Game Type!")
+	}
+
+	// Players are matched by their own rating in the game type
+	rating, err := GetRating(header.UserID, gameType[0])
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	status, err := getMatchStatus(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if status.Status == MatchStatusQueued {
+		return policy.UnSuccessfulResponse("Already Queued!")
+	}
+
+	status = MatchStatus{
+		Status:    MatchStatusQueued,
+		GameType:  gameType[0],
+		PartySize: rqBody.PartySize,
+		Rating:    rating.Rating,
+		QueuedAt:  time.Now().UTC().UnixNano() / int64(time.Millisecond),
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchTicketPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MatchTicketPrefix+header.UserID,
+		matchTicketGameType, status.GameType,
+		matchTicketPartySize, fmt.Sprintf("%d", status.PartySize),
+		matchTicketRating, strconv.FormatFloat(status.Rating, 'f', -1, 64),
+		matchTicketQueuedAt, fmt.Sprintf("%d", status.QueuedAt),
+		matchTicketStatus, status.Status))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", MatchQueuePrefix+matchQueueName(status.GameType, status.PartySize),
+		fmt.Sprintf("%d", status.QueuedAt), header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   status,
+		Digest: json.Marshal,
+	}
+}
+
+// Cancel Match Endpoint. Removes the user from their matchmaking queue.
+// Returns the user's status which is "matched" if they were matched
+// before they could cancel.
+func CancelMatch(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	status, err := getMatchStatus(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if status.Status != MatchStatusQueued {
+		return policy.UnSuccessfulResponse("Not Queued!")
+	}
+
+	status, err = dequeueMatchTicket(header.UserID, status, MatchStatusCancelled)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   status,
+		Digest: json.Marshal,
+	}
+}
+
+// Match Status Endpoint. Returns the user's matchmaking status and their
+// game once they are matched.
+func GetMatchStatus(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	status, err := getMatchStatus(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	// Tickets also time out here in case the matcher is not running
+	if status.Status == MatchStatusQueued && time.Now().UTC().Add(-MatchTimeout).UnixNano()/int64(time.Millisecond) > status.QueuedAt {
+		status, err = dequeueMatchTicket(header.UserID, status, MatchStatusTimedOut)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+	}
+
+	return policy.CommandResponse{
+		Data:   status,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns the names of the matchmaking queues with users waiting. Each
+// queue is found by scanning for keys with MatchQueuePrefix.
+//
+// returns -> []string :: queue names (see RunMatchmaking)
+//         -> error    :: non-nil if the database could not be read
+func MatchQueues() ([]string, error) {
+	scanner := radix.NewScanner(redis.MainRedis, radix.ScanOpts{Command: "SCAN", Pattern: MatchQueuePrefix + "*"})
+
+	queues := make([]string, 0)
+	var key string
+	for scanner.Next(&key) {
+		queues = append(queues, key[len(MatchQueuePrefix):])
+	}
+
+	return queues, scanner.Close()
+}
+
+// Matches users waiting in a queue. Tickets waiting longer than
+// MatchTimeout time out. Users are sorted by rating and grouped with
+// users close to their rating. Each group gets a private game owned by
+// one of its players with everyone in the roster. Meant to be run
+// periodically by the scheduler.
+//
+// queue :: name of the queue (see MatchQueues)
+//
+// returns -> int   :: number of games created
+//         -> error :: non-nil if the database could not be read/written
+func RunMatchmaking(queue string) (int, error) {
+	gameType, partySize, err := parseMatchQueueName(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	token, locked, err := takeMatchLock(queue)
+	if err != nil || !locked {
+		// Another matcher is already working on this queue
+		return 0, err
+	}
+	defer releaseMatchLock(queue, token)
+
+	err = timeOutMatchTickets(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	tickets, err := loadMatchTickets(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	sort.SliceStable(tickets, func(i, j int) bool {
+		return tickets[i].Rating < tickets[j].Rating
+	})
+
+	now := time.Now().UTC().UnixNano() / int64(time.Millisecond)
+	matches := 0
+
+	for i := 0; i+partySize <= len(tickets); {
+		group := tickets[i : i+partySize]
+
+		oldest := group[0].QueuedAt
+		for _, ticket := range group {
+			if ticket.QueuedAt < oldest {
+				oldest = ticket.QueuedAt
+			}
+		}
+
+		waited := time.Duration(now-oldest) * time.Millisecond
+		spread := MatchRatingSpread + MatchSpreadGrowth*float64(waited/MatchSpreadInterval)
+		if group[partySize-1].Rating-group[0].Rating > spread {
+			i++
+			continue
+		}
+
+		matched, err := createMatch(queue, gameType, partySize, group)
+		if err != nil {
+			return matches, err
+		} else if !matched {
+			i++
+			continue
+		}
+
+		matches++
+		i += partySize
+	}
+
+	return matches, nil
+}
+
+// Creates a game for a group of tickets. The tickets are taken off of
+// the queue first so cancelled tickets are not matched. Tickets are put
+// back if the group could not be matched.
+//
+// returns -> bool  :: true if the group was matched
+//         -> error :: non-nil if the database could not be read/written
+func createMatch(queue string, gameType string, partySize int, group []matchTicket) (bool, error) {
+	claimed := make([]matchTicket, 0, len(group))
+	for _, ticket := range group {
+		var removed int
+		err := redis.MainRedis.Do(radix.Cmd(&removed, "ZREM", MatchQueuePrefix+queue, ticket.AuthID))
+		if err != nil {
+			return false, err
+		} else if removed > 0 {
+			claimed = append(claimed, ticket)
+		}
+	}
+
+	var metadata GameMetadata
+	var err error
+	if len(claimed) == len(group) {
+		args := CreateGameCommandBody{
+			GameType:   gameType,
+			MaxPlayers: uint16(partySize),
+			Visibility: GameVisibilityPrivate,
+			Observers:  GameObserversRoster,
+		}
+
+		// Players at their game quota cannot own the match
+		for _, ticket := range claimed {
+			metadata, err = createGame(ticket.AuthID, args, []string{gameType})
+			if err != nil || metadata.Id != "" {
+				break
+			}
+		}
+	}
+
+	if err != nil || metadata.Id == "" {
+		if len(claimed) == len(group) && err == nil {
+			log.Printf("Could Not Create a Game for Match in %s! No Player can Own a Game.\n", queue)
+		}
+
+		for _, ticket := range claimed {
+			putErr := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", MatchQueuePrefix+queue, "NX", fmt.Sprintf("%d", ticket.QueuedAt), ticket.AuthID))
+			if putErr != nil {
+				return false, putErr
+			}
+		}
+
+		return false, err
+	}
+
+	for _, ticket := range claimed {
+		if ticket.AuthID != metadata.Owner {
+			_, err = joinRoster(ticket.AuthID, metadata.Id)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MatchTicketPrefix+ticket.AuthID,
+			matchTicketStatus, MatchStatusMatched,
+			matchTicketGameID, metadata.Id))
+		if err != nil {
+			return false, err
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "EXPIRE", MatchTicketPrefix+ticket.AuthID, fmt.Sprintf("%d", int64(MatchStatusLifetime.Seconds()))))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Removes a user from the matchmaking queue they are waiting in
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be read/written
+func removeUserFromMatchmaking(authID string) error {
+	status, err := getMatchStatus(authID)
+	if err != nil {
+		return err
+	} else if status.Status == MatchStatusQueued {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", MatchQueuePrefix+matchQueueName(status.GameType, status.PartySize), authID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchTicketPrefix+authID))
+}
+
+// Takes a queued ticket off of its queue and gives it a final status.
+// If the matcher took the ticket first the current status is returned
+// instead.
+//
+// authID :: Unique Identifier for a user
+// status :: the user's queued ticket
+// final  :: status to give the ticket (i.e. MatchStatusCancelled)
+//
+// returns -> MatchStatus :: the ticket afterwards
+//         -> error       :: non-nil if the database could not be read/written
+func dequeueMatchTicket(authID string, status MatchStatus, final string) (MatchStatus, error) {
+	var removed int
+	err := redis.MainRedis.Do(radix.Cmd(&removed, "ZREM", MatchQueuePrefix+matchQueueName(status.GameType, status.PartySize), authID))
+	if err != nil {
+		return status, err
+	} else if removed == 0 {
+		return getMatchStatus(authID)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MatchTicketPrefix+authID, matchTicketStatus, final))
+	if err != nil {
+		return status, err
+	}
+
+	status.Status = final
+	return status, redis.MainRedis.Do(radix.Cmd(nil, "EXPIRE", MatchTicketPrefix+authID, fmt.Sprintf("%d", int64(MatchStatusLifetime.Seconds()))))
+}
+
+// Times out every ticket in a queue waiting longer than MatchTimeout
+func timeOutMatchTickets(queue string) error {
+	cutoff := time.Now().UTC().Add(-MatchTimeout).UnixNano() / int64(time.Millisecond)
+
+	var authIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&authIDs, "ZRANGEBYSCORE", MatchQueuePrefix+queue, "-inf", fmt.Sprintf("(%d", cutoff)))
+	if err != nil {
+		return err
+	}
+
+	for _, authID := range authIDs {
+		status, err := getMatchStatus(authID)
+		if err != nil {
+			return err
+		}
+
+		_, err = dequeueMatchTicket(authID, status, MatchStatusTimedOut)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Loads the oldest MatchBatchSize tickets in a queue
+func loadMatchTickets(queue string) ([]matchTicket, error) {
+	var entries []string
+	err := redis.MainRedis.Do(radix.Cmd(&entries, "ZRANGE", MatchQueuePrefix+queue,
+		"0", fmt.Sprintf("%d", MatchBatchSize-1), "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := make([]matchTicket, 0, len(entries)/2)
+	for i := 0; i+1 < len(entries); i += 2 {
+		queuedAt, err := strconv.ParseInt(entries[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		var ratingStr string
+		err = redis.MainRedis.Do(radix.Cmd(&ratingStr, "HGET", MatchTicketPrefix+entries[i], matchTicketRating))
+		if err != nil {
+			return nil, err
+		}
+
+		rating, err := strconv.ParseFloat(ratingStr, 64)
+		if err != nil {
+			rating = MatchDefaultRating
+		}
+
+		tickets = append(tickets, matchTicket{AuthID: entries[i], Rating: rating, QueuedAt: queuedAt})
+	}
+
+	return tickets, nil
+}
+
+// Loads a user's matchmaking ticket
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> MatchStatus :: the ticket (Status is MatchStatusNone if
+//                           the user has no ticket)
+//         -> error       :: non-nil if the database could not be read
+func getMatchStatus(authID string) (MatchStatus, error) {
+	var fields map[string]string
+	err := redis.MainRedis.Do(radix.Cmd(&fields, "HGETALL", MatchTicketPrefix+authID))
+	if err != nil {
+		return MatchStatus{Status: MatchStatusNone}, err
+	} else if fields[matchTicketStatus] == "" {
+		return MatchStatus{Status: MatchStatusNone}, nil
+	}
+
+	status := MatchStatus{
+		Status:   fields[matchTicketStatus],
+		GameType: fields[matchTicketGameType],
+		GameID:   fields[matchTicketGameID],
+	}
+
+	status.PartySize, _ = strconv.Atoi(fields[matchTicketPartySize])
+	status.Rating, _ = strconv.ParseFloat(fields[matchTicketRating], 64)
+	status.QueuedAt, _ = strconv.ParseInt(fields[matchTicketQueuedAt], 10, 64)
+
+	return status, nil
+}
+
+// Name of the queue for a game type and party size
+func matchQueueName(gameType string, partySize int) string {
+	return fmt.Sprintf("%s:%d", gameType, partySize)
+}
+
+// Parses a queue name of the form <gameType>:<partySize>
+func parseMatchQueueName(queue string) (string, int, error) {
+	parts := strings.SplitN(queue, ":", 2)
+	if len(parts) != 2 {
+		return "", 0, errors.New("Malformed Match Queue! Queue: " + queue)
+	}
+
+	partySize, err := strconv.Atoi(parts[1])
+	if err != nil || partySize < MinMatchPartySize || partySize > MaxMatchPartySize {
+		return "", 0, errors.New("Malformed Match Queue! Queue: " + queue)
+	}
+
+	return parts[0], partySize, nil
+}
+
+// Takes the lock on a queue for MatchLockDuration with a new random
+// token.
+//
+// queue :: name of the queue (see MatchQueues)
+//
+// returns -> string :: token to release the lock with
+//         -> bool   :: false if another matcher holds the lock
+//         -> error  :: non-nil if the database could not be written to
+func takeMatchLock(queue string) (string, bool, error) {
+	tokenBytes := make([]byte, matchLockTokenBytes)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", false, err
+	}
+
+	token := hex.EncodeToString(tokenBytes)
+
+	var locked string
+	err = redis.MainRedis.Do(radix.Cmd(&locked, "SET", MatchLockPrefix+queue, token,
+		"NX", "PX", fmt.Sprintf("%d", MatchLockDuration.Milliseconds())))
+	return token, locked != "", err
+}
+
+// Releases the lock on a queue if it is still held with the token.
+// Errors are logged since the lock expires on its own.
+func releaseMatchLock(queue string, token string) {
+	err := redis.MainRedis.Do(releaseMatchLockScript.Cmd(nil, MatchLockPrefix+queue, token))
+	if err != nil {
+		log.Printf("Error Releasing Match Lock! Queue: %s\tErr: %v\n", queue, err)
+	}
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const testMatchGameType string = "matchtest"
+
+func TestMatchmaking(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	GameTypes[testMatchGameType] = GameTypes[DefaultGameType]
+	defer delete(GameTypes, testMatchGameType)
+
+	players := []struct {
+		id     string
+		rating float64
+	}{
+		{"-800", 1000},
+		{"-801", 1050},
+		{"-802", 2000},
+		{"-803", 2600},
+	}
+
+	playerIDs := make([]string, len(players))
+	for i, player := range players {
+		playerIDs[i] = player.id
+		removeUserFromMatchmaking(player.id)
+	}
+	deleteGamesForUsers(playerIDs, t)
+
+	// Players are matched by their stored rating
+	for _, player := range players {
+		err := setRating(player.id, testMatchGameType, Rating{Rating: player.rating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}, RatingHistoryEntry{})
+		if err != nil {
+			t.Fatalf("Error Setting Rating! Err: %v\n", err)
+		}
+	}
+
+	for _, player := range players {
+		status := matchTestHelper(t, player.id, policy.CmdMatchQueue, QueueForMatch,
+			MatchQueueCommandBody{GameType: testMatchGameType, PartySize: 2})
+		if status.Status != MatchStatusQueued {
+			t.Fatalf("Player %s was not Queued! Status: %v\n", player.id, status)
+		} else if status.Rating != player.rating {
+			t.Errorf("Player %s was Queued with Rating %f instead of their Rating %f!\n", player.id, status.Rating, player.rating)
+		}
+	}
+
+	t.Run("Unknown Game Types Are Rejected", func(t *testing.T) {
+		status := matchTestHelper(t, players[0].id, policy.CmdMatchQueue, QueueForMatch,
+			MatchQueueCommandBody{GameType: "missing", PartySize: 2})
+		if status.Status != "" {
+			t.Errorf("Player was Queued for an Unknown Game Type! Status: %v\n", status)
+		}
+	})
+
+	t.Run("Queueing Twice Fails", func(t *testing.T) {
+		status := matchTestHelper(t, players[0].id, policy.CmdMatchQueue, QueueForMatch,
+			MatchQueueCommandBody{GameType: testMatchGameType, PartySize: 2})
+		if status.Status != "" {
+			t.Errorf("Player was Queued Twice! Status: %v\n", status)
+		}
+	})
+
+	t.Run("Similar Ratings Are Matched", func(t *testing.T) {
+		matches, err := RunMatchmaking(matchQueueName(testMatchGameType, 2))
+		if err != nil {
+			t.Fatalf("Error Running Matchmaking! Err: %v\n", err)
+		} else if matches != 1 {
+			t.Fatalf("Expected 1 Match but got %d!\n", matches)
+		}
+
+		first := matchTestHelper(t, players[0].id, policy.CmdMatchStatus, GetMatchStatus, nil)
+		second := matchTestHelper(t, players[1].id, policy.CmdMatchStatus, GetMatchStatus, nil)
+		if first.Status != MatchStatusMatched || first.GameID == "" || first.GameID != second.GameID {
+			t.Fatalf("Players were not Matched Together! Statuses: %v %v\n", first, second)
+		}
+
+		isInGame, err := IsUserInGame(players[1].id, first.GameID)
+		if err != nil {
+			t.Fatalf("Error Reading Roster! Err: %v\n", err)
+		} else if !isInGame {
+			t.Errorf("Matched Player was not added to the Roster!\n")
+		}
+
+		far := matchTestHelper(t, players[2].id, policy.CmdMatchStatus, GetMatchStatus, nil)
+		if far.Status != MatchStatusQueued {
+			t.Errorf("Players with distant Ratings were Matched! Status: %v\n", far)
+		}
+	})
+
+	t.Run("Cancelled Players Leave The Queue", func(t *testing.T) {
+		status := matchTestHelper(t, players[2].id, policy.CmdMatchCancel, CancelMatch, nil)
+		if status.Status != MatchStatusCancelled {
+			t.Errorf("Player was not Cancelled! Status: %v\n", status)
+		}
+	})
+
+	t.Run("Old Tickets Time Out", func(t *testing.T) {
+		oldTimeout := MatchTimeout
+		MatchTimeout = 0
+		defer func() { MatchTimeout = oldTimeout }()
+
+		_, err := RunMatchmaking(matchQueueName(testMatchGameType, 2))
+		if err != nil {
+			t.Fatalf("Error Running Matchmaking! Err: %v\n", err)
+		}
+
+		status := matchTestHelper(t, players[3].id, policy.CmdMatchStatus, GetMatchStatus, nil)
+		if status.Status != MatchStatusTimedOut {
+			t.Errorf("Ticket did not Time Out! Status: %v\n", status)
+		}
+	})
+
+	t.Run("Only The Holder Releases The Lock", func(t *testing.T) {
+		queue := matchQueueName(testMatchGameType, 2)
+		token, locked, err := takeMatchLock(queue)
+		if err != nil || !locked {
+			t.Fatalf("Could not take the Match Lock! Err: %v\n", err)
+		}
+
+		_, locked, err = takeMatchLock(queue)
+		if err != nil || locked {
+			t.Errorf("Match Lock was taken Twice! Err: %v\n", err)
+		}
+
+		releaseMatchLock(queue, "someone-else")
+		var holder string
+		err = redis.MainRedis.Do(radix.Cmd(&holder, "GET", MatchLockPrefix+queue))
+		if err != nil || holder != token {
+			t.Errorf("Match Lock was released with the Wrong Token! Err: %v\n", err)
+		}
+
+		releaseMatchLock(queue, token)
+		_, locked, err = takeMatchLock(queue)
+		if err != nil || !locked {
+			t.Errorf("Match Lock was not Released! Err: %v\n", err)
+		}
+		redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchLockPrefix+queue))
+	})
+
+	for _, player := range players {
+		removeUserFromMatchmaking(player.id)
+		deleteRatings(player.id)
+	}
+	deleteGamesForUsers(playerIDs, t)
+}
+
+func matchTestHelper(t *testing.T, userID string, cmd policy.ClientCmd, endpoint func(policy.RequestHeader, policy.RequestBodyFactories, bool) policy.CommandResponse, body interface{}) MatchStatus {
+	var status MatchStatus
+	endpointTestHelper(t, userID, cmd, endpoint, body, &status)
+	return status
+}
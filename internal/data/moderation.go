@@ -0,0 +1,238 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+// Redis Sorted Set Key Prefix for the users banned from a game. Scored by
+// when the ban ends (milliseconds since epoch, +inf for permanent bans).
+// Concatenated with GameID
+const GameBanPrefix string = "gameBans:"
+
+// Redis Sorted Set Key Prefix for the players kicked from a game. Scored
+// by when they were kicked (milliseconds since epoch). Players are
+// removed when they join again. Concatenated with GameID
+const GameKickedPrefix string = "gameKicked:"
+
+// Maximum Number of users banned from a game
+const MaxGameBans int = 1000
+
+// Longest ban with a duration. Longer bans should be permanent.
+const MaxGameBanDuration time.Duration = 365 * 24 * time.Hour
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Game Moderation
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Kick Player Endpoint/Command
+type KickPlayerCommandBody struct {
+	GameID string
+	UserID string
+}
+
+// JSON Fields for the Ban Player Endpoint/Command
+type BanPlayerCommandBody struct {
+	GameID string
+	UserID string
+
+	// Length of the ban in seconds (0 for a permanent ban)
+	Duration int64
+
+	// Lifts the user's ban instead
+	Unban bool
+}
+
+// Kick Player Endpoint. Owners may remove a player from their game's
+// roster or waitlist. Kicked players may join again unless they are
+// banned (see BanPlayer).
+func KickPlayer(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := KickPlayerCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if rqBody.UserID == "" || rqBody.UserID == header.UserID {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	response := verifyGameOwner(header.UserID, rqBody.GameID)
+	if response != nil {
+		return *response
+	}
+
+	wasInGame, err := kickPlayer(rqBody.GameID, rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !wasInGame {
+		return policy.UnSuccessfulResponse("User Not In Game")
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Ban Player Endpoint. Owners may ban a user from joining their game
+// for a number of seconds or for good. Banned players in the game are
+// kicked.
+func BanPlayer(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := BanPlayerCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	duration := time.Duration(rqBody.Duration) * time.Second
+	if rqBody.UserID == "" || rqBody.UserID == header.UserID || rqBody.Duration < 0 || duration > MaxGameBanDuration {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	response := verifyGameOwner(header.UserID, rqBody.GameID)
+	if response != nil {
+		return *response
+	}
+
+	if rqBody.Unban {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GameBanPrefix+rqBody.GameID, rqBody.UserID))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		return policy.SuccessfulResponse()
+	}
+
+	err = pruneGameBans(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	var bans int
+	err = redis.MainRedis.Do(radix.Cmd(&bans, "ZCARD", GameBanPrefix+rqBody.GameID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if bans >= MaxGameBans {
+		return policy.UnSuccessfulResponse("Too Many Bans!")
+	}
+
+	expiry := "+inf"
+	if duration > 0 {
+		expiry = fmt.Sprintf("%d", time.Now().UTC().Add(duration).UnixNano()/int64(time.Millisecond))
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameBanPrefix+rqBody.GameID, expiry, rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	_, err = kickPlayer(rqBody.GameID, rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Returns whether a user is banned from a game. Ended bans are removed.
+//
+// authID :: Unique Identifier for a user
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> bool  :: true if the user may not join the game
+//         -> error :: non-nil if the database could not be read/written
+func IsBannedFromGame(authID string, gameID string) (bool, error) {
+	var expiry string
+	err := redis.MainRedis.Do(radix.Cmd(&expiry, "ZSCORE", GameBanPrefix+gameID, authID))
+	if err != nil || expiry == "" {
+		return false, err
+	} else if expiry == "inf" {
+		return true, nil
+	}
+
+	ends, err := strconv.ParseFloat(expiry, 64)
+	if err != nil {
+		return false, err
+	}
+
+	if int64(ends) > time.Now().UTC().UnixNano()/int64(time.Millisecond) {
+		return true, nil
+	}
+
+	return false, redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GameBanPrefix+gameID, authID))
+}
+
+// Returns whether a user was kicked from a game and has not joined
+// again since
+func wasKickedFromGame(authID string, gameID string) (bool, error) {
+	var kickedAt string
+	err := redis.MainRedis.Do(radix.Cmd(&kickedAt, "ZSCORE", GameKickedPrefix+gameID, authID))
+	return kickedAt != "", err
+}
+
+// Removes a player from a game's roster or waitlist and remembers they
+// were kicked (see wasKickedFromGame).
+//
+// returns -> bool  :: true if the player was on the roster or waitlist
+//         -> error :: non-nil if the database could not be read/written
+func kickPlayer(gameID string, authID string) (bool, error) {
+	wasInGame, err := leaveRoster(authID, gameID)
+	if err != nil {
+		return false, err
+	}
+
+	wasWaiting, err := leaveWaitlist(authID, gameID)
+	if err != nil {
+		return false, err
+	} else if !wasInGame && !wasWaiting {
+		return false, nil
+	}
+
+	now := fmt.Sprintf("%d", time.Now().UTC().UnixNano()/int64(time.Millisecond))
+	return true, redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameKickedPrefix+gameID, now, authID))
+}
+
+// Removes bans which have ended
+func pruneGameBans(gameID string) error {
+	now := fmt.Sprintf("%d", time.Now().UTC().UnixNano()/int64(time.Millisecond))
+	return redis.MainRedis.Do(radix.Cmd(nil, "ZREMRANGEBYSCORE", GameBanPrefix+gameID, "-inf", "("+now))
+}
+
+// Returns a response to send if the user does not own the game or nil
+// if they do
+func verifyGameOwner(authID string, gameID string) *policy.CommandResponse {
+	owner, err := getGameOwner(gameID)
+	if err != nil {
+		response := policy.RespWithError(err)
+		return &response
+	} else if owner == "" {
+		response := policy.UnSuccessfulResponse("Game Does Not Exist!")
+		return &response
+	} else if owner != authID {
+		log.Printf("Unauthorized Attempt! User %s does not own game %s\n", authID, gameID)
+		response := policy.UnSuccessfulResponse("Unauthorized!")
+		return &response
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestGameModeration(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-1400"
+	playerIDs := []string{"-1401", "-1402"}
+	allIDs := append([]string{ownerID}, playerIDs...)
+	deleteGamesForUsers(allIDs, t)
+
+	metadata, jsonResponse := createGameForUser(ownerID, t)
+	if metadata.Id == "" {
+		t.Fatalf("Game was not created! Response: %s\n", jsonResponse)
+	}
+
+	for _, playerID := range playerIDs {
+		welcome, jsonResponse := joinGameForUser(playerID, metadata.Id, t)
+		if welcome.Id != metadata.Id {
+			t.Fatalf("Could not Join Game! Response: %s\n", jsonResponse)
+		}
+	}
+
+	t.Run("Only Owners Kick", func(t *testing.T) {
+		success := commandTestHelper(t, playerIDs[0], policy.CmdGameKick, KickPlayer, KickPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[1]})
+		if success.Successful {
+			t.Errorf("Player Kicked from a Game they do not Own!\n")
+		}
+
+		success = commandTestHelper(t, playerIDs[0], policy.CmdGameBan, BanPlayer, BanPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[1]})
+		if success.Successful {
+			t.Errorf("Player Banned from a Game they do not Own!\n")
+		}
+	})
+
+	t.Run("Kicked Players Cannot Act", func(t *testing.T) {
+		success := commandTestHelper(t, ownerID, policy.CmdGameKick, KickPlayer, KickPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[0]})
+		if !success.Successful {
+			t.Fatalf("Could not Kick Player! Err: %s\n", success.Err)
+		}
+
+		isInGame, err := IsUserInGame(playerIDs[0], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Roster! Err: %v\n", err)
+		} else if isInGame {
+			t.Errorf("Kicked Player is still on the Roster!\n")
+		}
+
+		success = commandTestHelper(t, playerIDs[0], policy.CmdAction, ApplyAction, applyActionRequest{GameID: metadata.Id})
+		if success.Successful || success.Code != policy.CodeKickedFromGame {
+			t.Errorf("Expected Code %s but got %v!\n", policy.CodeKickedFromGame, success)
+		}
+
+		welcome, jsonResponse := joinGameForUser(playerIDs[0], metadata.Id, t)
+		if welcome.Id != metadata.Id {
+			t.Fatalf("Kicked Player could not Join Again! Response: %s\n", jsonResponse)
+		}
+
+		wasKicked, err := wasKickedFromGame(playerIDs[0], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Kicked Players! Err: %v\n", err)
+		} else if wasKicked {
+			t.Errorf("Player is still Kicked after Joining Again!\n")
+		}
+	})
+
+	t.Run("Banned Players Cannot Join", func(t *testing.T) {
+		success := commandTestHelper(t, ownerID, policy.CmdGameBan, BanPlayer, BanPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[1]})
+		if !success.Successful {
+			t.Fatalf("Could not Ban Player! Err: %s\n", success.Err)
+		}
+
+		isInGame, err := IsUserInGame(playerIDs[1], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Roster! Err: %v\n", err)
+		} else if isInGame {
+			t.Errorf("Banned Player is still on the Roster!\n")
+		}
+
+		_, jsonResponse := joinGameForUser(playerIDs[1], metadata.Id, t)
+		var rejected policy.SuccessfulData
+		json.Unmarshal(jsonResponse, &rejected)
+		if rejected.Code != policy.CodeBannedFromGame {
+			t.Errorf("Banned Player Joined the Game! Response: %s\n", jsonResponse)
+		}
+
+		success = commandTestHelper(t, ownerID, policy.CmdGameBan, BanPlayer, BanPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[1], Unban: true})
+		if !success.Successful {
+			t.Fatalf("Could not Lift Ban! Err: %s\n", success.Err)
+		}
+
+		welcome, jsonResponse := joinGameForUser(playerIDs[1], metadata.Id, t)
+		if welcome.Id != metadata.Id {
+			t.Errorf("Player could not Join after their Ban was Lifted! Response: %s\n", jsonResponse)
+		}
+	})
+
+	t.Run("Temporary Bans End", func(t *testing.T) {
+		success := commandTestHelper(t, ownerID, policy.CmdGameBan, BanPlayer, BanPlayerCommandBody{GameID: metadata.Id, UserID: playerIDs[1], Duration: 60})
+		if !success.Successful {
+			t.Fatalf("Could not Ban Player! Err: %s\n", success.Err)
+		}
+
+		isBanned, err := IsBannedFromGame(playerIDs[1], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Bans! Err: %v\n", err)
+		} else if !isBanned {
+			t.Errorf("Player was not Banned!\n")
+		}
+
+		// The ban ended long ago
+		redis.MainRedis.Do(radix.Cmd(nil, "ZADD", GameBanPrefix+metadata.Id, "0", playerIDs[1]))
+
+		isBanned, err = IsBannedFromGame(playerIDs[1], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Bans! Err: %v\n", err)
+		} else if isBanned {
+			t.Errorf("Player is still Banned after their Ban Ended!\n")
+		}
+	})
+
+	deleteGamesForUsers(allIDs, t)
+}
@@ -0,0 +1,463 @@
+package data
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Identity Provider Configurables
+
+// Issuer ("iss" claim) ID Tokens must have. OIDC Login is disabled
+// while this is empty.
+var OIDCIssuer string = ""
+
+// Audience ("aud" claim) ID Tokens must be issued for. Typically the
+// Client ID given by the Identity Provider.
+var OIDCAudience string = ""
+
+// Location of the Identity Provider's JSON Web Key Set. Either a file
+// path or an http(s) URL.
+var OIDCJWKSLocation string = ""
+
+// Shortest time between reloading the JSON Web Key Set when a token
+// is signed with an unknown key.
+const OIDCJWKSRefreshInterval time.Duration = time.Minute
+
+// Time allowed for fetching the JSON Web Key Set from a URL
+const OIDCJWKSFetchTimeout time.Duration = 10 * time.Second
+
+// Difference allowed between our clock and the Identity Provider's
+// when checking "exp", "nbf", and "iat"
+const OIDCClockSkew time.Duration = time.Minute
+
+//
+// Identity Provider Users
+
+// Redis Key for the HashTable of Identity Provider Subjects to AuthIDs.
+// The field is the issuer and subject separated by a "|".
+const OIDCSubjectTable string = "oidcSubjects"
+
+// Prefix for the usernames of users created by OIDC Login. Users
+// can not register or rename to a username with this prefix.
+const OIDCUsernamePrefix string = "oidc_"
+
+// Number of hex characters of the subject hash used in usernames
+const oidcUsernameHashLen int = 24
+
+//// Global Variables | Singletons
+
+// Identity Provider Signing Keys by Key ID. Loaded on Startup
+var oidcKeys = struct {
+	sync.RWMutex
+	keys   map[string]*rsa.PublicKey
+	loaded time.Time
+}{keys: map[string]*rsa.PublicKey{}}
+
+// ServerTask Startup Function for OIDC Login. Loads the JSON Web Key
+// Set when OIDCIssuer is set.
+func StartOIDC() (func(), error) {
+	if OIDCIssuer == "" {
+		log.Println("OIDC Login Is Disabled")
+		return cleanUpOIDC, nil
+	}
+
+	err := loadJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	return cleanUpOIDC, nil
+}
+
+// CleanUp Function returned by Startup function. Doesn't do anything, but here
+// for consistency.
+func cleanUpOIDC() {
+	log.Println("Cleaning Up OIDC Logic")
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// OIDC Login
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the OIDC Login Endpoint/Command
+type OIDCLoginCommandBody struct {
+	IDToken string
+}
+
+// Claims of an ID Token checked by OIDC Login
+type IDTokenClaims struct {
+	Issuer   string       `json:"iss"`
+	Subject  string       `json:"sub"`
+	Audience oidcAudience `json:"aud"`
+
+	// Unix times (seconds)
+	Expiry    int64 `json:"exp"`
+	NotBefore int64 `json:"nbf"`
+	IssuedAt  int64 `json:"iat"`
+}
+
+// The "aud" claim may be a single string or a list of strings
+type oidcAudience []string
+
+// JSON Web Key Set, only the fields needed for RSA keys
+type jsonWebKeySet struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// Header of a JSON Web Token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// OIDC Login Endpoint. Logs in with an ID Token from the configured
+// Identity Provider, creating a user on the first login. Responds the
+// same as Login.
+func LoginOIDC(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	} else if OIDCIssuer == "" {
+		return policy.UnSuccessfulResponse("OIDC Login Is Disabled!")
+	}
+
+	rqBody := OIDCLoginCommandBody{}
+	err := bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	code, err := CheckLoginAllowed("", header.RemoteAddr)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if code == policy.CodeAccountLocked {
+		return policy.UnSuccessfulResponseWithCode("Account Is Locked!", code)
+	} else if code == policy.CodeLoginBackoff {
+		return policy.UnSuccessfulResponseWithCode("Too Many Attempts! Try Again Later!", code)
+	}
+
+	claims, err := VerifyIDToken(rqBody.IDToken)
+	if err != nil {
+		log.Printf("Invalid ID Token! Error: %v\n", err)
+		auditRequest(header, AuditLogin, "", AuditFailure, "Invalid ID Token")
+		err = RecordLoginFailure("", header.RemoteAddr)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		return policy.RawUnsuccessfulResponse("Illegal Input!")
+	}
+
+	authID, err := getOIDCUser(claims.Issuer, claims.Subject)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	RecordAudit(AuditEvent{Event: AuditLogin, Actor: authID, Target: authID, IP: header.RemoteAddr, Outcome: AuditSuccess, Detail: "OIDC"})
+
+	return newSessionResponse(authID)
+}
+
+// Verifies the signature and claims of an ID Token. Only RS256 signed
+// tokens are accepted.
+//
+// token :: compact serialized JSON Web Token
+//
+// returns -> IDTokenClaims :: the claims of the token
+//         -> error         :: non-nil if the token must be rejected
+func VerifyIDToken(token string) (IDTokenClaims, error) {
+	claims := IDTokenClaims{}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("ID Token is Malformed!")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, err
+	}
+
+	jwtHead := jwtHeader{}
+	err = json.Unmarshal(headerBytes, &jwtHead)
+	if err != nil {
+		return claims, err
+	} else if jwtHead.Alg != "RS256" {
+		return claims, errors.New("Unsupported ID Token Algorithm: " + jwtHead.Alg)
+	}
+
+	key, err := getOIDCKey(jwtHead.Kid)
+	if err != nil {
+		return claims, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, err
+	}
+
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig)
+	if err != nil {
+		return claims, err
+	}
+
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, err
+	}
+
+	err = json.Unmarshal(claimBytes, &claims)
+	if err != nil {
+		return claims, err
+	}
+
+	now := time.Now()
+	if claims.Issuer != OIDCIssuer {
+		return claims, errors.New("ID Token has the wrong Issuer: " + claims.Issuer)
+	} else if !claims.Audience.contains(OIDCAudience) {
+		return claims, errors.New("ID Token has the wrong Audience!")
+	} else if claims.Subject == "" {
+		return claims, errors.New("ID Token has no Subject!")
+	} else if now.Add(-OIDCClockSkew).After(time.Unix(claims.Expiry, 0)) {
+		return claims, errors.New("ID Token is Expired!")
+	} else if claims.NotBefore > 0 && now.Add(OIDCClockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return claims, errors.New("ID Token is Not Valid Yet!")
+	} else if claims.IssuedAt > 0 && now.Add(OIDCClockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return claims, errors.New("ID Token was Issued in the Future!")
+	}
+
+	return claims, nil
+}
+
+// Returns the AuthID for an Identity Provider Subject, creating a user
+// if this is the subject's first login. The user has no password, so
+// it can only login with OIDC Login.
+//
+// issuer  :: "iss" claim of the ID Token
+// subject :: "sub" claim of the ID Token
+func getOIDCUser(issuer string, subject string) (string, error) {
+	subjectKey := issuer + "|" + subject
+
+	var authID string
+	err := redis.MainRedis.Do(radix.Cmd(&authID, "HGET", OIDCSubjectTable, subjectKey))
+	if err != nil {
+		return "", err
+	}
+
+	if authID != "" {
+		username, err := getUsername(authID)
+		if err != nil {
+			return "", err
+		} else if username != "" {
+			return authID, nil
+		}
+
+		// The user was deleted, make a new one
+	}
+
+	hashed := sha256.Sum256([]byte(subjectKey))
+	username := OIDCUsernamePrefix + hex.EncodeToString(hashed[:])[:oidcUsernameHashLen]
+
+	success, err := createAccountWithChecksum(username, "")
+	if err != nil {
+		return "", err
+	} else if !success {
+		// Another login may have made the user first. Never take over
+		// a user with a password.
+		var checksum string
+		err = redis.MainRedis.Do(radix.Cmd(&checksum, "HGET", UserPassTable, username))
+		if err != nil {
+			return "", err
+		} else if checksum != "" {
+			return "", errors.New("OIDC Username Belongs to a Password User: " + username)
+		}
+	}
+
+	authID, err = getAuthID(username)
+	if err != nil {
+		return "", err
+	} else if authID == "" {
+		return "", errors.New("OIDC User Was Not Created: " + username)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", OIDCSubjectTable, subjectKey, authID))
+	if err != nil {
+		return "", err
+	}
+
+	return authID, nil
+}
+
+// Returns the Identity Provider key with the Key ID. Reloads the JSON
+// Web Key Set (at most once every OIDCJWKSRefreshInterval) if the key
+// is unknown, since providers rotate their keys.
+//
+// kid :: Key ID from the token header (may be empty if the set has
+//        only one key)
+func getOIDCKey(kid string) (*rsa.PublicKey, error) {
+	key, refresh := lookupOIDCKey(kid)
+	if key != nil {
+		return key, nil
+	} else if !refresh {
+		return nil, errors.New("Unknown ID Token Key: " + kid)
+	}
+
+	err := loadJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	key, _ = lookupOIDCKey(kid)
+	if key == nil {
+		return nil, errors.New("Unknown ID Token Key: " + kid)
+	}
+
+	return key, nil
+}
+
+// Returns the loaded key with the Key ID and whether the JSON Web Key
+// Set may be reloaded.
+func lookupOIDCKey(kid string) (*rsa.PublicKey, bool) {
+	oidcKeys.RLock()
+	defer oidcKeys.RUnlock()
+
+	var key *rsa.PublicKey
+	if kid == "" && len(oidcKeys.keys) == 1 {
+		for _, only := range oidcKeys.keys {
+			key = only
+		}
+	} else {
+		key = oidcKeys.keys[kid]
+	}
+
+	return key, time.Since(oidcKeys.loaded) >= OIDCJWKSRefreshInterval
+}
+
+// Loads the JSON Web Key Set from OIDCJWKSLocation replacing the
+// loaded keys. Keys which are not RSA signing keys are skipped.
+func loadJWKS() error {
+	var raw []byte
+	var err error
+
+	if strings.HasPrefix(OIDCJWKSLocation, "http://") || strings.HasPrefix(OIDCJWKSLocation, "https://") {
+		client := http.Client{Timeout: OIDCJWKSFetchTimeout}
+		resp, err := client.Get(OIDCJWKSLocation)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Fetching JWKS returned status %d", resp.StatusCode)
+		}
+
+		raw, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+	} else {
+		raw, err = ioutil.ReadFile(OIDCJWKSLocation)
+		if err != nil {
+			return err
+		}
+	}
+
+	jwks := jsonWebKeySet{}
+	err = json.Unmarshal(raw, &jwks)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.N, "="))
+		if err != nil {
+			return err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.E, "="))
+		if err != nil {
+			return err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return errors.New("JWKS Key has an Invalid Exponent: " + jwk.Kid)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("JWKS has no RSA Signing Keys: " + OIDCJWKSLocation)
+	}
+
+	oidcKeys.Lock()
+	oidcKeys.keys = keys
+	oidcKeys.loaded = time.Now()
+	oidcKeys.Unlock()
+
+	return nil
+}
+
+// Unmarshals an "aud" claim from a string or a list of strings
+func (aud *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*aud = oidcAudience{single}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+
+	*aud = oidcAudience(list)
+	return nil
+}
+
+// Returns whether the audience has the value
+func (aud oidcAudience) contains(value string) bool {
+	for _, entry := range aud {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+package data
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const testOIDCIssuer string = "https://issuer.example.com"
+const testOIDCAudience string = "laplace-test-client"
+const testOIDCKeyID string = "test-key"
+
+func TestVerifyIDToken(t *testing.T) {
+	key := startOIDCTestHelper(t)
+	defer os.Remove(OIDCJWKSLocation)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error Generating Key! Err: %v\n", err)
+	}
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{
+		"iss": testOIDCIssuer,
+		"aud": testOIDCAudience,
+		"sub": "subject",
+		"iat": now,
+		"exp": now + 300,
+	}
+
+	tokenTests := []struct {
+		name      string
+		key       *rsa.PrivateKey
+		overrides map[string]interface{}
+		expected  bool
+	}{
+		{"Valid Token", key, nil, true},
+		{"Audience List", key, map[string]interface{}{"aud": []string{"other", testOIDCAudience}}, true},
+		{"Wrong Issuer", key, map[string]interface{}{"iss": "https://evil.example.com"}, false},
+		{"Wrong Audience", key, map[string]interface{}{"aud": "other"}, false},
+		{"Expired", key, map[string]interface{}{"exp": now - 600}, false},
+		{"Not Valid Yet", key, map[string]interface{}{"nbf": now + 600}, false},
+		{"No Subject", key, map[string]interface{}{"sub": ""}, false},
+		{"Wrong Key", otherKey, nil, false},
+	}
+
+	for _, test := range tokenTests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := map[string]interface{}{}
+			for k, v := range valid {
+				claims[k] = v
+			}
+			for k, v := range test.overrides {
+				claims[k] = v
+			}
+
+			_, err := VerifyIDToken(signIDTokenTestHelper(t, test.key, claims))
+			if test.expected && err != nil {
+				t.Errorf("Valid Token was Rejected! Err: %v\n", err)
+			} else if !test.expected && err == nil {
+				t.Errorf("Invalid Token was Accepted!\n")
+			}
+		})
+	}
+}
+
+func TestLoginOIDC(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	key := startOIDCTestHelper(t)
+	defer os.Remove(OIDCJWKSLocation)
+
+	subject := "laplace-test-subject"
+	redis.MainRedis.Do(radix.Cmd(nil, "HDEL", OIDCSubjectTable, testOIDCIssuer+"|"+subject))
+
+	now := time.Now().Unix()
+	token := signIDTokenTestHelper(t, key, map[string]interface{}{
+		"iss": testOIDCIssuer,
+		"aud": testOIDCAudience,
+		"sub": subject,
+		"exp": now + 300,
+	})
+
+	// The first login creates the user
+	loginOIDCTestHelper(t, token, true)
+	authID := oidcSubjectTestHelper(t, subject)
+	if authID == "" {
+		t.Fatalf("OIDC Login did not create a user!\n")
+	}
+
+	username, err := getUsername(authID)
+	if err != nil {
+		t.Errorf("Error Getting Username! Err: %v\n", err)
+	}
+	defer DeleteUser(username)
+
+	// Later logins use the same user
+	loginOIDCTestHelper(t, token, true)
+	if oidcSubjectTestHelper(t, subject) != authID {
+		t.Errorf("Second OIDC Login Used a Different User!\n")
+	}
+
+	// The user has no password
+	if IsValidLogin(username, "") {
+		t.Errorf("OIDC User Can Login With an Empty Password!\n")
+	}
+
+	loginOIDCTestHelper(t, token+"x", false)
+	redis.MainRedis.Do(radix.Cmd(nil, "HDEL", OIDCSubjectTable, testOIDCIssuer+"|"+subject))
+}
+
+func startOIDCTestHelper(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error Generating Key! Err: %v\n", err)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testOIDCKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}},
+	}
+
+	raw, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("Error Marshalling JWKS! Err: %v\n", err)
+	}
+
+	file, err := ioutil.TempFile("", "jwks*.json")
+	if err != nil {
+		t.Fatalf("Error Creating JWKS File! Err: %v\n", err)
+	}
+	file.Write(raw)
+	file.Close()
+
+	OIDCIssuer = testOIDCIssuer
+	OIDCAudience = testOIDCAudience
+	OIDCJWKSLocation = file.Name()
+
+	_, err = StartOIDC()
+	if err != nil {
+		t.Fatalf("Error Starting OIDC! Err: %v\n", err)
+	}
+
+	return key
+}
+
+func signIDTokenTestHelper(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	headerBytes, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testOIDCKeyID, "typ": "JWT"})
+	claimBytes, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Error Marshalling Claims! Err: %v\n", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimBytes)
+	hashed := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("Error Signing Token! Err: %v\n", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func loginOIDCTestHelper(t *testing.T, token string, expected bool) {
+	req, err := policy.RequestWithUserForTesting("", false, policy.CmdLoginOIDC, OIDCLoginCommandBody{IDToken: token})
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response := LoginOIDC(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure to Login! Err: %v\n", response.ServerError)
+	}
+
+	result := string(response.Raw)
+	success := response.UseRaw && result != "Unsecure Connection!" && result != "Illegal Input!"
+	if success != expected {
+		t.Errorf("OIDC Login was %t instead of %t! Response: %s\n", success, expected, result)
+	}
+}
+
+func oidcSubjectTestHelper(t *testing.T, subject string) string {
+	var authID string
+	err := redis.MainRedis.Do(radix.Cmd(&authID, "HGET", OIDCSubjectTable, testOIDCIssuer+"|"+subject))
+	if err != nil {
+		t.Errorf("Error Getting OIDC Subject! Err: %v\n", err)
+	}
+
+	return authID
+}
@@ -0,0 +1,341 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Profile Table
+
+// Redis HashTable Key Prefix for Profiles. Concatenated
+// with a UserID for the profile of that user
+const ProfileSetPrefix string = "profile:"
+
+// Redis Set Key Prefix for the Profile Fields a user marked private.
+// Concatenated with a UserID
+const ProfilePrivateSetPrefix string = "profilePrivate:"
+
+// Display Name Key/Field for Redis Profile HashTable
+const ProfileDisplayNameField string = "displayName"
+
+// Avatar URL Key/Field for Redis Profile HashTable
+const ProfileAvatarURLField string = "avatarURL"
+
+// Bio Key/Field for Redis Profile HashTable
+const ProfileBioField string = "bio"
+
+// Account Creation DateTime Key/Field for Redis Profile HashTable
+//    (number of seconds since epoch)
+const ProfileCreatedAtField string = "createdAt"
+
+// Custom JSON Key/Field for Redis Profile HashTable. Concatenated with
+// ":<gameType>" for the Custom JSON of a game (see profileCustomField)
+const ProfileCustomField string = "custom"
+
+//
+// Profile Limits
+
+// Maximum Length (in bytes) of a Display Name
+const ProfileDisplayNameMax int = 64
+
+// Maximum Length (in bytes) of an Avatar URL
+const ProfileAvatarURLMax int = 2048
+
+// Maximum Length (in bytes) of a Bio
+const ProfileBioMax int = 1024
+
+// Maximum Size (in bytes) of the Custom JSON. Each game decides
+// what it keeps here, so the limit is left to be configured.
+var ProfileCustomMax int = 4096
+
+// Maximum Size (in bytes) of the Custom JSON of each game type. Game
+// types without an entry use ProfileCustomMax.
+//
+// This should never change during runtime!
+var ProfileCustomMaxes map[string]int = map[string]int{}
+
+// Profile Fields which can be marked private
+var profilePrivateFields map[string]bool = map[string]bool{
+	ProfileDisplayNameField: true,
+	ProfileAvatarURLField:   true,
+	ProfileBioField:         true,
+	ProfileCreatedAtField:   true,
+	ProfileCustomField:      true,
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Profiles
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Profile Fields for a user. Private fields are left empty unless the
+// profile is loaded by its owner (see LoadProfile).
+type UserProfile struct {
+	DisplayName string          `json:",omitempty"`
+	AvatarURL   string          `json:",omitempty"`
+	Bio         string          `json:",omitempty"`
+	CreatedAt   int64           `json:",omitempty"`
+	Custom      json.RawMessage `json:",omitempty"`
+
+	// Fields hidden from other users (only sent to the owner)
+	Private []string `json:",omitempty"`
+}
+
+// JSON Fields for the Get Profile Endpoint/Command
+type GetProfileCommandBody struct {
+	UserID string
+
+	// Game whose Custom JSON is returned ("" for the shared Custom JSON)
+	GameType string
+}
+
+// JSON Fields for the Update Profile Endpoint/Command. The whole profile
+// is replaced, so fields which are not sent are cleared.
+type UpdateProfileCommandBody struct {
+	DisplayName string
+	AvatarURL   string
+	Bio         string
+
+	// Custom JSON (as a string so it can be sent over ASN1)
+	Custom string
+
+	// Registered game type the Custom JSON is for (see GameTypes, "" for
+	// the shared Custom JSON). Only the Custom JSON of this game is
+	// replaced and its size is limited per game (see ProfileCustomMaxes)
+	GameType string
+
+	// Names of the fields to hide from other users
+	// (i.e. "bio" or "avatarURL")
+	Private []string
+}
+
+// Get Profile Endpoint. Returns the public fields of a user's profile.
+// If the request is signed by the profile's owner the private fields
+// are returned as well.
+func GetProfile(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	rqBody := GetProfileCommandBody{}
+	err := bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if !isValidProfileGameType(rqBody.GameType) {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	username, err := getUsername(rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	isOwner := rqBody.UserID == header.UserID && bodyFactories.SigVerify(header.UserID, header.Sig) == nil
+
+	profile, err := LoadProfile(rqBody.UserID, rqBody.GameType, isOwner)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   UserInfo{AuthID: rqBody.UserID, Username: username, UserProfile: profile},
+		Digest: json.Marshal,
+	}
+}
+
+// Update Profile Endpoint. Replaces the profile of the request's user.
+// The Custom JSON is limited to ProfileCustomMax bytes unless its game
+// has its own limit (see ProfileCustomMaxes).
+func UpdateProfile(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := UpdateProfileCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if !isValidProfileGameType(rqBody.GameType) {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if len(rqBody.DisplayName) > ProfileDisplayNameMax || len(rqBody.Bio) > ProfileBioMax {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	} else if len(rqBody.Custom) > profileCustomMax(rqBody.GameType) {
+		return policy.UnSuccessfulResponse("Custom Data Is Too Large!")
+	} else if rqBody.Custom != "" && !json.Valid([]byte(rqBody.Custom)) {
+		return policy.UnSuccessfulResponse("Custom Data Is Not JSON!")
+	} else if rqBody.AvatarURL != "" && !isValidAvatarURL(rqBody.AvatarURL) {
+		return policy.UnSuccessfulResponse("Illegal Avatar URL!")
+	}
+
+	for _, field := range rqBody.Private {
+		if !profilePrivateFields[field] {
+			return policy.UnSuccessfulResponse("Unknown Profile Field: " + field)
+		}
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", ProfileSetPrefix+header.UserID,
+		ProfileDisplayNameField, rqBody.DisplayName,
+		ProfileAvatarURLField, rqBody.AvatarURL,
+		ProfileBioField, rqBody.Bio,
+		profileCustomField(rqBody.GameType), rqBody.Custom))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", ProfilePrivateSetPrefix+header.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	if len(rqBody.Private) > 0 {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", append([]string{ProfilePrivateSetPrefix + header.UserID}, rqBody.Private...)...))
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Loads a user's profile from the database.
+//
+// authID         :: Unique Identifier for a user
+// gameType       :: game whose Custom JSON is loaded ("" for the shared
+//                   Custom JSON)
+// includePrivate :: whether fields marked private should be loaded
+//
+// returns -> UserProfile :: the profile (empty if the user has none)
+//         -> error :: non-nil if the database could not be read
+func LoadProfile(authID string, gameType string, includePrivate bool) (UserProfile, error) {
+	profile := UserProfile{}
+	fields := make([]string, 5)
+
+	err := redis.MainRedis.Do(radix.Cmd(&fields, "HMGET", ProfileSetPrefix+authID,
+		ProfileDisplayNameField,
+		ProfileAvatarURLField,
+		ProfileBioField,
+		ProfileCreatedAtField,
+		profileCustomField(gameType)))
+	if err != nil {
+		return profile, err
+	}
+
+	var private []string
+	err = redis.MainRedis.Do(radix.Cmd(&private, "SMEMBERS", ProfilePrivateSetPrefix+authID))
+	if err != nil {
+		return profile, err
+	}
+
+	isPrivate := make(map[string]bool, len(private))
+	for _, field := range private {
+		isPrivate[field] = !includePrivate
+	}
+
+	if !isPrivate[ProfileDisplayNameField] {
+		profile.DisplayName = fields[0]
+	}
+
+	if !isPrivate[ProfileAvatarURLField] {
+		profile.AvatarURL = fields[1]
+	}
+
+	if !isPrivate[ProfileBioField] {
+		profile.Bio = fields[2]
+	}
+
+	if !isPrivate[ProfileCreatedAtField] && fields[3] != "" {
+		profile.CreatedAt, err = strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return profile, err
+		}
+	}
+
+	if !isPrivate[ProfileCustomField] && fields[4] != "" {
+		profile.Custom = json.RawMessage(fields[4])
+	}
+
+	if includePrivate {
+		profile.Private = private
+	}
+
+	return profile, nil
+}
+
+// Creates the profile for a new user. Only the creation date is set.
+//
+// authID :: Unique Identifier for a user
+func createProfile(authID string) error {
+	return redis.MainRedis.Do(radix.Cmd(nil, "HSET", ProfileSetPrefix+authID,
+		ProfileCreatedAtField, fmt.Sprintf("%d", time.Now().UTC().Unix())))
+}
+
+// Removes a user's profile from the database.
+//
+// authID :: Unique Identifier for a user
+func deleteProfile(authID string) error {
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", ProfileSetPrefix+authID, ProfilePrivateSetPrefix+authID))
+}
+
+// Returns the Key/Field of a game's Custom JSON in the Redis Profile
+// HashTable ("" for the shared Custom JSON)
+func profileCustomField(gameType string) string {
+	if gameType == "" {
+		return ProfileCustomField
+	}
+
+	return ProfileCustomField + ":" + gameType
+}
+
+// Returns the Maximum Size (in bytes) of a game's Custom JSON
+func profileCustomMax(gameType string) int {
+	if max, exists := ProfileCustomMaxes[gameType]; exists {
+		return max
+	}
+
+	return ProfileCustomMax
+}
+
+// Returns whether a game type may have Custom JSON in a profile. Only
+// registered game types (see GameTypes) may, so a profile has a bounded
+// number of Custom JSON fields.
+func isValidProfileGameType(gameType string) bool {
+	if gameType == "" {
+		return true
+	}
+
+	_, exists := GameTypes[gameType]
+	return exists
+}
+
+// Returns whether the Avatar URL is short enough and an absolute
+// http(s) URL.
+func isValidAvatarURL(avatarURL string) bool {
+	if len(avatarURL) > ProfileAvatarURLMax {
+		return false
+	}
+
+	parsed, err := url.Parse(avatarURL)
+	if err != nil {
+		return false
+	}
+
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
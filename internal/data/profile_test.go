@@ -0,0 +1,125 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+)
+
+func TestProfile(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "PROFILE"
+	otherUsername := testUserNamePrefix + "PROFILEOTHER"
+	password := "SomeP@ssword123"
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, otherUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	otherID := getUserTestHelper(t, otherUsername)
+
+	// New Profiles have a creation date
+	info := getProfileTestHelper(t, authID, authID)
+	if info.CreatedAt == 0 {
+		t.Errorf("Profile Creation Date was not set!\n")
+	}
+
+	t.Run("Reject Large Custom Data", func(t *testing.T) {
+		body := UpdateProfileCommandBody{Custom: "\"" + strings.Repeat("a", ProfileCustomMax) + "\""}
+		success := updateProfileTestHelper(t, authID, body)
+		if success.Successful {
+			t.Errorf("Custom Data Larger Than the Limit was Accepted!\n")
+		}
+	})
+
+	t.Run("Limit Custom Data Per Game", func(t *testing.T) {
+		GameTypes["profiletest"] = GameTypes[DefaultGameType]
+		ProfileCustomMaxes["profiletest"] = 8
+		defer delete(GameTypes, "profiletest")
+		defer delete(ProfileCustomMaxes, "profiletest")
+
+		custom := "\"" + strings.Repeat("a", 16) + "\""
+		success := updateProfileTestHelper(t, authID, UpdateProfileCommandBody{Custom: custom, GameType: "profiletest"})
+		if success.Successful {
+			t.Errorf("Custom Data Larger Than the Game's Limit was Accepted!\n")
+		}
+
+		success = updateProfileTestHelper(t, authID, UpdateProfileCommandBody{Custom: custom, GameType: DefaultGameType})
+		if !success.Successful {
+			t.Errorf("Custom Data Under the Default Limit was Rejected! Err: %s\n", success.Err)
+		}
+
+		success = updateProfileTestHelper(t, authID, UpdateProfileCommandBody{Custom: custom, GameType: "other-game"})
+		if success.Successful {
+			t.Errorf("Custom Data was Accepted for an Unregistered Game Type!\n")
+		}
+	})
+
+	t.Run("Reject Invalid Custom Data", func(t *testing.T) {
+		success := updateProfileTestHelper(t, authID, UpdateProfileCommandBody{Custom: "{derp"})
+		if success.Successful {
+			t.Errorf("Custom Data That Is Not JSON was Accepted!\n")
+		}
+	})
+
+	t.Run("Reject Invalid Avatar", func(t *testing.T) {
+		success := updateProfileTestHelper(t, authID, UpdateProfileCommandBody{AvatarURL: "javascript:alert(1)"})
+		if success.Successful {
+			t.Errorf("Illegal Avatar URL was Accepted!\n")
+		}
+	})
+
+	body := UpdateProfileCommandBody{
+		DisplayName: "Derp",
+		AvatarURL:   "https://example.com/derp.png",
+		Bio:         "Derpity Derp",
+		Custom:      "{\"level\":3}",
+		Private:     []string{ProfileBioField},
+	}
+
+	success := updateProfileTestHelper(t, authID, body)
+	if !success.Successful {
+		t.Fatalf("Could Not Update Profile! Err: %s\n", success.Err)
+	}
+
+	t.Run("Owner Sees Private Fields", func(t *testing.T) {
+		info := getProfileTestHelper(t, authID, authID)
+		if info.DisplayName != body.DisplayName || info.Bio != body.Bio || string(info.Custom) != body.Custom {
+			t.Errorf("Profile Was Not Saved! Profile: %v\n", info)
+		} else if len(info.Private) != 1 || info.Private[0] != ProfileBioField {
+			t.Errorf("Private Fields Were Not Saved! Private: %v\n", info.Private)
+		}
+	})
+
+	t.Run("Others Only See Public Fields", func(t *testing.T) {
+		info := getProfileTestHelper(t, otherID, authID)
+		if info.DisplayName != body.DisplayName || info.AvatarURL != body.AvatarURL {
+			t.Errorf("Public Fields Are Missing! Profile: %v\n", info)
+		} else if info.Bio != "" || len(info.Private) != 0 {
+			t.Errorf("Private Fields Were Shown! Profile: %v\n", info)
+		}
+	})
+
+	DeleteUser(validUsername)
+	DeleteUser(otherUsername)
+}
+
+func getProfileTestHelper(t *testing.T, userID string, profileID string) UserInfo {
+	var info UserInfo
+	endpointTestHelper(t, userID, policy.CmdGetProfile, GetProfile, GetProfileCommandBody{UserID: profileID}, &info)
+	return info
+}
+
+func updateProfileTestHelper(t *testing.T, userID string, body UpdateProfileCommandBody) policy.SuccessfulData {
+	return commandTestHelper(t, userID, policy.CmdSetProfile, UpdateProfile, body)
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Ownership Tables
+
+// Redis Set Key Prefix for the Games a user owns. Concatenated with
+// a UserID
+const OwnerGamesSetPrefix string = "ownerGames:"
+
+// Redis HashTable Key for quotas set at runtime (see SetGameQuota).
+// Fields are gameQuotaGlobalField, gameQuotaRolePrefix+<role>, or
+// gameQuotaUserPrefix+<UserID>
+const GameQuotaHashName string = "gameQuotas"
+
+const (
+	gameQuotaGlobalField string = "global"
+	gameQuotaRolePrefix  string = "role:"
+	gameQuotaUserPrefix  string = "user:"
+)
+
+//
+// Quota Settings
+
+// Quota value for no limit
+const GameQuotaUnlimited int = -1
+
+// Default number of games each role may own. Used when no quota is
+// set for the role or user at runtime.
+//
+// This should never change during runtime!
+var RoleGameQuotas map[string]int = map[string]int{
+	RolePlayer:    1,
+	RoleModerator: 1,
+	RoleAdmin:     10,
+	RoleService:   GameQuotaUnlimited,
+}
+
+// Default maximum number of games on the server. Used when no global
+// quota is set at runtime.
+const DefaultGlobalGameQuota int = GameQuotaUnlimited
+
+// Script for atomically giving a user ownership of a game if they are
+// under their quota. Returns 1 if the user owns the game afterwards.
+//
+// KEYS[1] :: owned games Set
+// ARGV[1] :: GameID
+// ARGV[2] :: quota (GameQuotaUnlimited for no limit)
+var claimGameScript = radix.NewEvalScript(1, `
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return 1
+end
+
+local quota = tonumber(ARGV[2])
+if quota >= 0 and redis.call('SCARD', KEYS[1]) >= quota then
+	return 0
+end
+
+redis.call('SADD', KEYS[1], ARGV[1])
+return 1
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Game Quotas
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Set Game Quota Endpoint/Command. Exactly one of
+// UserID, Role, or Global selects the quota to change.
+type GameQuotaCommandBody struct {
+	UserID string
+	Role   string
+	Global bool
+
+	// Number of games (GameQuotaUnlimited for no limit)
+	Quota int
+
+	// Removes the quota set at runtime instead (falling back to the
+	// role's quota or the defaults)
+	Clear bool
+}
+
+// Response to the Set Game Quota Endpoint/Command. Quota is the
+// quota in effect after the change.
+type GameQuota struct {
+	UserID string `json:",omitempty"`
+	Role   string `json:",omitempty"`
+	Global bool   `json:",omitempty"`
+	Quota  int
+}
+
+// Set Game Quota Endpoint. Administrators may change how many games
+// a user or every user with a role may own, and how many games the
+// server hosts at once.
+func SetGameQuota(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := GameQuotaCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	selected := 0
+	var field, target string
+	if rqBody.UserID != "" {
+		selected++
+		field, target = gameQuotaUserPrefix+rqBody.UserID, rqBody.UserID
+	}
+
+	if rqBody.Role != "" {
+		if _, exists := roleRanks[rqBody.Role]; !exists {
+			return policy.UnSuccessfulResponse("Unknown Role!")
+		}
+
+		selected++
+		field, target = gameQuotaRolePrefix+rqBody.Role, "role "+rqBody.Role
+	}
+
+	if rqBody.Global {
+		selected++
+		field, target = gameQuotaGlobalField, "global"
+	}
+
+	if selected != 1 || (!rqBody.Clear && rqBody.Quota < GameQuotaUnlimited) {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.Clear {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HDEL", GameQuotaHashName, field))
+	} else {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", GameQuotaHashName, field, fmt.Sprintf("%d", rqBody.Quota)))
+	}
+
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	quota := GameQuota{UserID: rqBody.UserID, Role: rqBody.Role, Global: rqBody.Global}
+	if rqBody.UserID != "" {
+		quota.Quota, err = UserGameQuota(rqBody.UserID)
+	} else if rqBody.Role != "" {
+		quota.Quota, err = roleGameQuota(rqBody.Role)
+	} else {
+		quota.Quota, err = GlobalGameQuota()
+	}
+
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditAdminAction, target, AuditSuccess, fmt.Sprintf("Game Quota %d", quota.Quota))
+	return policy.CommandResponse{
+		Data:   quota,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns the number of games a user may own. A quota set for the user
+// is used before the quota of their role.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> int   :: the quota (GameQuotaUnlimited for no limit)
+//         -> error :: non-nil if the database could not be read
+func UserGameQuota(authID string) (int, error) {
+	quota, isSet, err := getGameQuotaField(gameQuotaUserPrefix + authID)
+	if err != nil || isSet {
+		return quota, err
+	}
+
+	role, err := GetRole(authID)
+	if err != nil {
+		return 0, err
+	}
+
+	return roleGameQuota(role)
+}
+
+// Returns the maximum number of games on the server
+// (GameQuotaUnlimited for no limit)
+func GlobalGameQuota() (int, error) {
+	quota, isSet, err := getGameQuotaField(gameQuotaGlobalField)
+	if err != nil || isSet {
+		return quota, err
+	}
+
+	return DefaultGlobalGameQuota, nil
+}
+
+// Returns the GameIDs of the games a user owns
+func OwnedGames(authID string) ([]string, error) {
+	var gameIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&gameIDs, "SMEMBERS", OwnerGamesSetPrefix+authID))
+	return gameIDs, err
+}
+
+// Gives a user ownership of a game if they are under their quota.
+//
+// authID :: Unique Identifier for a user
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> bool  :: whether the user owns the game afterwards
+//         -> error :: non-nil if the database could not be read/written
+func claimGame(authID string, gameID string) (bool, error) {
+	quota, err := UserGameQuota(authID)
+	if err != nil {
+		return false, err
+	}
+
+	var claimed int
+	err = redis.MainRedis.Do(claimGameScript.Cmd(&claimed, OwnerGamesSetPrefix+authID, gameID, fmt.Sprintf("%d", quota)))
+	return claimed == 1, err
+}
+
+// Removes a game from the games a user owns
+func releaseGame(authID string, gameID string) error {
+	return redis.MainRedis.Do(radix.Cmd(nil, "SREM", OwnerGamesSetPrefix+authID, gameID))
+}
+
+// Returns a role's quota set at runtime or its default
+func roleGameQuota(role string) (int, error) {
+	quota, isSet, err := getGameQuotaField(gameQuotaRolePrefix + role)
+	if err != nil || isSet {
+		return quota, err
+	}
+
+	defaultQuota, exists := RoleGameQuotas[role]
+	if !exists {
+		return RoleGameQuotas[RolePlayer], nil
+	}
+
+	return defaultQuota, nil
+}
+
+// Returns a quota set at runtime and whether it is set
+func getGameQuotaField(field string) (int, bool, error) {
+	var value string
+	err := redis.MainRedis.Do(radix.Cmd(&value, "HGET", GameQuotaHashName, field))
+	if err != nil || value == "" {
+		return 0, false, err
+	}
+
+	quota, err := strconv.Atoi(value)
+	return quota, err == nil, err
+}
+
+// Moves game owners from the single game owner HashTable used before
+// quotas (OwnerHashSetName) to the owned games Sets. Only does work
+// when the HashTable exists.
+//
+// returns -> error :: non-nil if the database could not be read/written
+func migrateGameOwners() error {
+	var owners map[string]string
+	err := redis.MainRedis.Do(radix.Cmd(&owners, "HGETALL", OwnerHashSetName))
+	if err != nil || len(owners) == 0 {
+		return err
+	}
+
+	for ownerID, gameID := range owners {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", OwnerGamesSetPrefix+ownerID, gameID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", OwnerHashSetName))
+}
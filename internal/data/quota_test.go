@@ -0,0 +1,141 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestGameQuotas(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+			StartRoomsSystem,
+			StartRoles,
+		})
+	defer cleanup()
+
+	organizerID := "-1200"
+	playerID := "-1201"
+	deleteGamesForUsers([]string{organizerID, playerID}, t)
+	redis.MainRedis.Do(radix.Cmd(nil, "HDEL", GameQuotaHashName, gameQuotaUserPrefix+organizerID))
+
+	t.Run("Players Own One Game By Default", func(t *testing.T) {
+		metadata, jsonResponse := createGameForUser(playerID, t)
+		if metadata.Id == "" {
+			t.Fatalf("Game was not created! Response: %s\n", jsonResponse)
+		}
+
+		metadata, jsonResponse = createGameForUser(playerID, t)
+		if metadata.Id != "" {
+			t.Errorf("Player went over their Quota! Response: %s\n", jsonResponse)
+		}
+	})
+
+	t.Run("Players Cannot Set Quotas", func(t *testing.T) {
+		request, err := policy.RequestWithUserForTesting(playerID, false, policy.CmdGameQuota, GameQuotaCommandBody{UserID: playerID, Quota: 5})
+		if err != nil {
+			t.Errorf("Failure to create Request! Err: %v\n", err)
+		}
+
+		response := SetGameQuota(request.Header, request.BodyFactories, request.IsSecureConnection)
+		if response.ServerError != nil {
+			t.Fatalf("Failure to Set Game Quota! Err: %v\n", response.ServerError)
+		}
+
+		quota, err := UserGameQuota(playerID)
+		if err != nil {
+			t.Fatalf("Error Reading Quota! Err: %v\n", err)
+		} else if quota != RoleGameQuotas[RolePlayer] {
+			t.Errorf("Player Changed their own Quota! Quota: %d\n", quota)
+		}
+	})
+
+	t.Run("User Quotas", func(t *testing.T) {
+		quota := gameQuotaTestHelper(t, GameQuotaCommandBody{UserID: organizerID, Quota: 3})
+		if quota.Quota != 3 {
+			t.Fatalf("Quota was not Set! Response: %v\n", quota)
+		}
+
+		for i := 0; i < 3; i++ {
+			metadata, jsonResponse := createGameForUser(organizerID, t)
+			if metadata.Id == "" {
+				t.Fatalf("Organizer Could Not Create Game %d! Response: %s\n", i+1, jsonResponse)
+			}
+		}
+
+		metadata, jsonResponse := createGameForUser(organizerID, t)
+		if metadata.Id != "" {
+			t.Errorf("Organizer went over their Quota! Response: %s\n", jsonResponse)
+		}
+
+		owned, err := OwnedGames(organizerID)
+		if err != nil {
+			t.Fatalf("Error Reading Owned Games! Err: %v\n", err)
+		} else if len(owned) != 3 {
+			t.Errorf("Expected 3 Owned Games but got %d!\n", len(owned))
+		}
+
+		quota = gameQuotaTestHelper(t, GameQuotaCommandBody{UserID: organizerID, Clear: true})
+		if quota.Quota != RoleGameQuotas[RolePlayer] {
+			t.Errorf("Quota was not Cleared! Response: %v\n", quota)
+		}
+	})
+
+	t.Run("Global Quota", func(t *testing.T) {
+		var games int
+		err := redis.MainRedis.Do(radix.Cmd(&games, "HLEN", GameHashSetName))
+		if err != nil {
+			t.Fatalf("Error Counting Games! Err: %v\n", err)
+		}
+
+		gameQuotaTestHelper(t, GameQuotaCommandBody{Global: true, Quota: games})
+		defer gameQuotaTestHelper(t, GameQuotaCommandBody{Global: true, Clear: true})
+
+		gameQuotaTestHelper(t, GameQuotaCommandBody{UserID: organizerID, Quota: GameQuotaUnlimited})
+		defer gameQuotaTestHelper(t, GameQuotaCommandBody{UserID: organizerID, Clear: true})
+
+		metadata, jsonResponse := createGameForUser(organizerID, t)
+		if metadata.Id != "" {
+			t.Errorf("Game was Created over the Global Quota! Response: %s\n", jsonResponse)
+		}
+	})
+
+	t.Run("Deleting Needs a GameID", func(t *testing.T) {
+		request, err := policy.RequestWithUserForTesting(playerID, false, policy.CmdGameDelete, nil)
+		if err != nil {
+			t.Errorf("Failure to create Request! Err: %v\n", err)
+		}
+
+		response := DeleteGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+		bytes, err := response.Digest(response.Data)
+		if err != nil {
+			t.Errorf("Error Digesting Response! Err: %v\n", err)
+		}
+
+		var success policy.SuccessfulData
+		json.Unmarshal(bytes, &success)
+		if success.Successful {
+			t.Errorf("Game was Deleted without a GameID!\n")
+		}
+	})
+
+	deleteGamesForUsers([]string{organizerID, playerID}, t)
+}
+
+func gameQuotaTestHelper(t *testing.T, body GameQuotaCommandBody) GameQuota {
+	request, err := policy.RequestWithServiceUser(true, policy.CmdGameQuota, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	var quota GameQuota
+	requestTestHelper(t, request, SetGameQuota, &quota)
+	return quota
+}
@@ -0,0 +1,528 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Rating Tables
+
+// Redis Hash Key Prefix for a user's rating in a game type.
+// Concatenated with <gameType>:<UserID>
+const RatingPrefix string = "rating:"
+
+// Redis List Key Prefix for a user's rating history in a game type.
+// Concatenated with <gameType>:<UserID>. Newest entries are first.
+const RatingHistoryPrefix string = "ratingHistory:"
+
+// Redis Set Key Prefix for the game types a user has a rating in.
+// Concatenated with a UserID
+const RatedGameTypesPrefix string = "ratedGameTypes:"
+
+// Redis Key Prefix marking a game's result as rated so it is only
+// rated once. Concatenated with <gameType>:<GameID>
+const RatedGamePrefix string = "ratedGame:"
+
+// Fields for the Redis Rating Hash
+const (
+	ratingField     string = "rating"
+	deviationField  string = "deviation"
+	volatilityField string = "volatility"
+	gamesField      string = "games"
+	updatedField    string = "updated"
+)
+
+//
+// Rating Settings
+
+// Rating, Rating Deviation, and Volatility of a new player
+const (
+	DefaultRating     float64 = 1500
+	DefaultDeviation  float64 = 350
+	DefaultVolatility float64 = 0.06
+)
+
+// Number of rated games before a player's rating is no longer
+// provisional. Provisional ratings change faster.
+var ProvisionalRatingGames int = 10
+
+// Number of entries kept in a user's rating history
+const RatingHistoryMax int64 = 100
+
+// Default and Maximum number of entries returned by the Rating History
+// Endpoint/Command
+const (
+	RatingHistoryDefaultLimit int = 20
+	RatingHistoryMaxLimit     int = 100
+)
+
+// Time a game's result is remembered as rated
+const RatedGameLifetime time.Duration = 7 * 24 * time.Hour
+
+// Algorithm used to update ratings (see EloRating and Glicko2Rating)
+var RatingSystem RatingAlgorithm = EloRating{KFactor: 32, ProvisionalKFactor: 64}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Rating Algorithms
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A player's skill in a game type
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+
+	// Number of rated games played
+	Games int
+
+	// Whether the player has played fewer than ProvisionalRatingGames
+	Provisional bool
+}
+
+// An opponent's rating and the player's score against them
+// (1 for a win, 0.5 for a draw, 0 for a loss)
+type RatingOutcome struct {
+	Opponent Rating
+	Score    float64
+}
+
+// An algorithm updating a player's rating after a game
+type RatingAlgorithm interface {
+	// Returns the player's new rating after a game against the opponents.
+	// Games and Provisional are updated by the caller.
+	Update(player Rating, outcomes []RatingOutcome) Rating
+}
+
+// The Elo rating system. Games against several opponents are treated
+// as one game against each with the K-Factor split between them.
+type EloRating struct {
+	// Largest change in rating from one game
+	KFactor float64
+
+	// K-Factor used while a rating is provisional
+	ProvisionalKFactor float64
+}
+
+// Implements RatingAlgorithm
+func (elo EloRating) Update(player Rating, outcomes []RatingOutcome) Rating {
+	if len(outcomes) == 0 {
+		return player
+	}
+
+	k := elo.KFactor
+	if player.Provisional {
+		k = elo.ProvisionalKFactor
+	}
+
+	change := 0.0
+	for _, outcome := range outcomes {
+		expected := 1 / (1 + math.Pow(10, (outcome.Opponent.Rating-player.Rating)/400))
+		change += outcome.Score - expected
+	}
+
+	player.Rating += k * change / float64(len(outcomes))
+	return player
+}
+
+// The Glicko-2 rating system. Each game is treated as its own rating
+// period.
+//
+// http://www.glicko.net/glicko/glicko2.pdf
+type Glicko2Rating struct {
+	// Constrains the change in volatility over time (0.3 to 1.2)
+	Tau float64
+}
+
+// Converts between the Glicko and Glicko-2 scales
+const glicko2Scale float64 = 173.7178
+
+// Convergence tolerance for the Glicko-2 volatility
+const glicko2Epsilon float64 = 0.000001
+
+// Implements RatingAlgorithm
+func (glicko Glicko2Rating) Update(player Rating, outcomes []RatingOutcome) Rating {
+	mu := (player.Rating - DefaultRating) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	sigma := player.Volatility
+
+	if len(outcomes) == 0 {
+		player.Deviation = math.Min(math.Sqrt(phi*phi+sigma*sigma)*glicko2Scale, DefaultDeviation)
+		return player
+	}
+
+	variance := 0.0
+	improvement := 0.0
+	for _, outcome := range outcomes {
+		muJ := (outcome.Opponent.Rating - DefaultRating) / glicko2Scale
+		phiJ := outcome.Opponent.Deviation / glicko2Scale
+
+		g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-muJ)))
+
+		variance += g * g * expected * (1 - expected)
+		improvement += g * (outcome.Score - expected)
+	}
+
+	v := 1 / variance
+	delta := v * improvement
+
+	// Find the new volatility with the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(glicko.Tau*glicko.Tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glicko.Tau) < 0 {
+			k++
+		}
+		B = a - k*glicko.Tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glicko2Epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	newSigma := math.Exp(A / 2)
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+
+	player.Rating = newMu*glicko2Scale + DefaultRating
+	player.Deviation = newPhi * glicko2Scale
+	player.Volatility = newSigma
+	return player
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Ratings
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// A player's finishing place in a rated game. Lower placements are
+// better and equal placements are draws.
+type RatingResult struct {
+	AuthID    string
+	Placement int
+}
+
+// An entry in a user's rating history
+type RatingHistoryEntry struct {
+	// Time of the game (seconds since epoch)
+	Time int64
+
+	GameID    string
+	Rating    float64
+	Deviation float64
+	Change    float64
+}
+
+// JSON Fields for the Rating Endpoints/Commands
+type RatingCommandBody struct {
+	// User to look up ("" for the request's user)
+	UserID   string
+	GameType string
+
+	// Rating History paging
+	Offset int
+	Limit  int
+}
+
+// Response to the Rating History Endpoint/Command
+type RatingHistory struct {
+	Entries []RatingHistoryEntry
+}
+
+// Rating Endpoint. Returns a user's rating in a game type.
+func GetRatingCommand(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := RatingCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.UserID == "" {
+		rqBody.UserID = header.UserID
+	}
+
+	rating, err := GetRating(rqBody.UserID, rqBody.GameType)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   rating,
+		Digest: json.Marshal,
+	}
+}
+
+// Rating History Endpoint. Returns a page of a user's rating changes in
+// a game type, newest first.
+func GetRatingHistory(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := RatingCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.UserID == "" {
+		rqBody.UserID = header.UserID
+	}
+
+	limit := rqBody.Limit
+	if limit <= 0 {
+		limit = RatingHistoryDefaultLimit
+	} else if limit > RatingHistoryMaxLimit {
+		limit = RatingHistoryMaxLimit
+	}
+
+	if rqBody.Offset < 0 {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var entries []string
+	err = redis.MainRedis.Do(radix.Cmd(&entries, "LRANGE", RatingHistoryPrefix+ratingKey(rqBody.GameType, rqBody.UserID),
+		fmt.Sprintf("%d", rqBody.Offset), fmt.Sprintf("%d", rqBody.Offset+limit-1)))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	history := RatingHistory{Entries: make([]RatingHistoryEntry, 0, len(entries))}
+	for _, entry := range entries {
+		var parsed RatingHistoryEntry
+		err = json.Unmarshal([]byte(entry), &parsed)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		history.Entries = append(history.Entries, parsed)
+	}
+
+	return policy.CommandResponse{
+		Data:   history,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns a user's rating in a game type. Users who have not played a
+// rated game get the default (provisional) rating.
+//
+// authID   :: Unique Identifier for a user
+// gameType :: type of game
+//
+// returns -> Rating :: the user's rating
+//         -> error  :: non-nil if the database could not be read
+func GetRating(authID string, gameType string) (Rating, error) {
+	rating := Rating{
+		Rating:      DefaultRating,
+		Deviation:   DefaultDeviation,
+		Volatility:  DefaultVolatility,
+		Provisional: ProvisionalRatingGames > 0,
+	}
+
+	var fields map[string]string
+	err := redis.MainRedis.Do(radix.Cmd(&fields, "HGETALL", RatingPrefix+ratingKey(gameType, authID)))
+	if err != nil || len(fields) == 0 {
+		return rating, err
+	}
+
+	rating.Rating, err = strconv.ParseFloat(fields[ratingField], 64)
+	if err != nil {
+		return rating, err
+	}
+
+	rating.Deviation, err = strconv.ParseFloat(fields[deviationField], 64)
+	if err != nil {
+		return rating, err
+	}
+
+	rating.Volatility, err = strconv.ParseFloat(fields[volatilityField], 64)
+	if err != nil {
+		return rating, err
+	}
+
+	rating.Games, err = strconv.Atoi(fields[gamesField])
+	if err != nil {
+		return rating, err
+	}
+
+	rating.Provisional = rating.Games < ProvisionalRatingGames
+	return rating, nil
+}
+
+// Updates the ratings of every player in a finished game using the
+// RatingSystem. Each player is rated against every other player by
+// placement. A game is only rated once.
+//
+// gameType :: type of game
+// gameID   :: Unique Identifier for game in string form
+// results  :: every player's placement
+//
+// returns -> map[string]Rating :: each player's new rating (nil if the
+//                                 game was already rated)
+//         -> error             :: non-nil if the database could not be
+//                                 read/written
+func UpdateRatings(gameType string, gameID string, results []RatingResult) (map[string]Rating, error) {
+	if len(results) < 2 {
+		return nil, errors.New("A Rated Game Needs at Least Two Players!")
+	}
+
+	var marked string
+	err := redis.MainRedis.Do(radix.Cmd(&marked, "SET", RatedGamePrefix+ratingKey(gameType, gameID), "1",
+		"NX", "EX", fmt.Sprintf("%d", int64(RatedGameLifetime.Seconds()))))
+	if err != nil || marked == "" {
+		return nil, err
+	}
+
+	// Every player is rated against the ratings from before the game
+	before := make(map[string]Rating, len(results))
+	for _, result := range results {
+		before[result.AuthID], err = GetRating(result.AuthID, gameType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC().Unix()
+	after := make(map[string]Rating, len(results))
+	for _, result := range results {
+		outcomes := make([]RatingOutcome, 0, len(results)-1)
+		for _, opponent := range results {
+			if opponent.AuthID == result.AuthID {
+				continue
+			}
+
+			score := 0.5
+			if result.Placement < opponent.Placement {
+				score = 1
+			} else if result.Placement > opponent.Placement {
+				score = 0
+			}
+
+			outcomes = append(outcomes, RatingOutcome{Opponent: before[opponent.AuthID], Score: score})
+		}
+
+		rating := RatingSystem.Update(before[result.AuthID], outcomes)
+		rating.Games++
+		rating.Provisional = rating.Games < ProvisionalRatingGames
+
+		err = setRating(result.AuthID, gameType, rating, RatingHistoryEntry{
+			Time:      now,
+			GameID:    gameID,
+			Rating:    rating.Rating,
+			Deviation: rating.Deviation,
+			Change:    rating.Rating - before[result.AuthID].Rating,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		after[result.AuthID] = rating
+	}
+
+	return after, nil
+}
+
+// Stores a user's rating and adds an entry to their rating history
+func setRating(authID string, gameType string, rating Rating, entry RatingHistoryEntry) error {
+	key := ratingKey(gameType, authID)
+	err := redis.MainRedis.Do(radix.Cmd(nil, "HSET", RatingPrefix+key,
+		ratingField, strconv.FormatFloat(rating.Rating, 'f', -1, 64),
+		deviationField, strconv.FormatFloat(rating.Deviation, 'f', -1, 64),
+		volatilityField, strconv.FormatFloat(rating.Volatility, 'f', -1, 64),
+		gamesField, fmt.Sprintf("%d", rating.Games),
+		updatedField, fmt.Sprintf("%d", entry.Time)))
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", RatedGameTypesPrefix+authID, gameType))
+	if err != nil {
+		return err
+	}
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "LPUSH", RatingHistoryPrefix+key, string(entryBytes)))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "LTRIM", RatingHistoryPrefix+key, "0", fmt.Sprintf("%d", RatingHistoryMax-1)))
+}
+
+// Removes a user's ratings and rating history in every game type. The
+// game types are found with the user's rated game types Set (see
+// RatedGameTypesPrefix).
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be read/written
+func deleteRatings(authID string) error {
+	var gameTypes []string
+	err := redis.MainRedis.Do(radix.Cmd(&gameTypes, "SMEMBERS", RatedGameTypesPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	for _, gameType := range gameTypes {
+		key := ratingKey(gameType, authID)
+		err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", RatingPrefix+key, RatingHistoryPrefix+key))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", RatedGameTypesPrefix+authID))
+}
+
+// Key suffix for rating tables (<gameType>:<id>)
+func ratingKey(gameType string, id string) string {
+	return gameType + ":" + id
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const testRatingGameType string = "ratingtest"
+
+func TestEloRating(t *testing.T) {
+	elo := EloRating{KFactor: 32, ProvisionalKFactor: 64}
+	player := Rating{Rating: 1500}
+	opponent := Rating{Rating: 1500}
+
+	won := elo.Update(player, []RatingOutcome{{Opponent: opponent, Score: 1}})
+	if math.Abs(won.Rating-1516) > 0.001 {
+		t.Errorf("Expected a Rating of 1516 but got %f!\n", won.Rating)
+	}
+
+	lost := elo.Update(player, []RatingOutcome{{Opponent: opponent, Score: 0}})
+	if math.Abs(lost.Rating-1484) > 0.001 {
+		t.Errorf("Expected a Rating of 1484 but got %f!\n", lost.Rating)
+	}
+
+	player.Provisional = true
+	provisional := elo.Update(player, []RatingOutcome{{Opponent: opponent, Score: 1}})
+	if math.Abs(provisional.Rating-1532) > 0.001 {
+		t.Errorf("Provisional Rating did not use the Provisional K-Factor! Rating: %f\n", provisional.Rating)
+	}
+}
+
+func TestGlicko2Rating(t *testing.T) {
+	// Example from the Glicko-2 paper
+	glicko := Glicko2Rating{Tau: 0.5}
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+	result := glicko.Update(player, []RatingOutcome{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+	})
+
+	if math.Abs(result.Rating-1464.06) > 0.01 {
+		t.Errorf("Expected a Rating of 1464.06 but got %f!\n", result.Rating)
+	}
+
+	if math.Abs(result.Deviation-151.52) > 0.01 {
+		t.Errorf("Expected a Deviation of 151.52 but got %f!\n", result.Deviation)
+	}
+
+	if math.Abs(result.Volatility-0.05999) > 0.00001 {
+		t.Errorf("Expected a Volatility of 0.05999 but got %f!\n", result.Volatility)
+	}
+}
+
+func TestUpdateRatings(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+		})
+	defer cleanup()
+
+	playerIDs := []string{"-900", "-901", "-902"}
+	for _, playerID := range playerIDs {
+		deleteRatings(playerID)
+	}
+
+	gameID := "ratingTestGame"
+	redis.MainRedis.Do(radix.Cmd(nil, "DEL", RatedGamePrefix+ratingKey(testRatingGameType, gameID)))
+
+	ratings, err := UpdateRatings(testRatingGameType, gameID, []RatingResult{
+		{AuthID: playerIDs[0], Placement: 1},
+		{AuthID: playerIDs[1], Placement: 2},
+		{AuthID: playerIDs[2], Placement: 2},
+	})
+	if err != nil {
+		t.Fatalf("Error Updating Ratings! Err: %v\n", err)
+	}
+
+	if ratings[playerIDs[0]].Rating <= DefaultRating || ratings[playerIDs[1]].Rating >= DefaultRating {
+		t.Errorf("Ratings did not follow Placements! Ratings: %v\n", ratings)
+	} else if ratings[playerIDs[1]].Rating != ratings[playerIDs[2]].Rating {
+		t.Errorf("Tied Players got different Ratings! Ratings: %v\n", ratings)
+	} else if ratings[playerIDs[0]].Games != 1 || !ratings[playerIDs[0]].Provisional {
+		t.Errorf("New Player was not Provisional after one Game! Rating: %v\n", ratings[playerIDs[0]])
+	}
+
+	t.Run("Games Are Rated Once", func(t *testing.T) {
+		again, err := UpdateRatings(testRatingGameType, gameID, []RatingResult{
+			{AuthID: playerIDs[0], Placement: 1},
+			{AuthID: playerIDs[1], Placement: 2},
+		})
+		if err != nil {
+			t.Fatalf("Error Updating Ratings! Err: %v\n", err)
+		} else if again != nil {
+			t.Errorf("Game was Rated Twice!\n")
+		}
+
+		rating, err := GetRating(playerIDs[0], testRatingGameType)
+		if err != nil {
+			t.Fatalf("Error Getting Rating! Err: %v\n", err)
+		} else if rating.Games != 1 {
+			t.Errorf("Expected 1 Rated Game but got %d!\n", rating.Games)
+		}
+	})
+
+	t.Run("History Is Recorded", func(t *testing.T) {
+		request, err := policy.RequestWithUserForTesting(playerIDs[0], false, policy.CmdRatingLog, RatingCommandBody{GameType: testRatingGameType})
+		if err != nil {
+			t.Errorf("Failure to create Request! Err: %v\n", err)
+		}
+
+		response := GetRatingHistory(request.Header, request.BodyFactories, request.IsSecureConnection)
+		if response.ServerError != nil {
+			t.Fatalf("Failure to Get Rating History! Err: %v\n", response.ServerError)
+		}
+
+		history, ok := response.Data.(RatingHistory)
+		if !ok || len(history.Entries) != 1 {
+			t.Fatalf("Expected 1 History Entry! Response: %v\n", response.Data)
+		} else if history.Entries[0].GameID != gameID || history.Entries[0].Change <= 0 {
+			t.Errorf("History Entry is wrong! Entry: %v\n", history.Entries[0])
+		}
+	})
+
+	t.Run("Deleting Removes Every Rating", func(t *testing.T) {
+		err := deleteRatings(playerIDs[0])
+		if err != nil {
+			t.Fatalf("Error Deleting Ratings! Err: %v\n", err)
+		}
+
+		var exists int
+		redis.MainRedis.Do(radix.Cmd(&exists, "EXISTS", RatingPrefix+ratingKey(testRatingGameType, playerIDs[0]),
+			RatingHistoryPrefix+ratingKey(testRatingGameType, playerIDs[0]), RatedGameTypesPrefix+playerIDs[0]))
+		if exists > 0 {
+			t.Errorf("Ratings were not Deleted!\n")
+		}
+	})
+
+	for _, playerID := range playerIDs {
+		deleteRatings(playerID)
+	}
+}
@@ -0,0 +1,328 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/mail"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/notify"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Contact Addresses
+
+// Email Address Key/Field for Redis UserID HashTable
+const AuthIDSetEmailField string = "email"
+
+// Maximum Length (in bytes) of an Email Address
+const EmailMax int = 254
+
+//
+// Password Reset Configurables
+
+// Redis HashTable Key Prefix for Password Reset Codes. Concatenated
+// with a UserID. Holds the hashed code and the number of wrong attempts.
+const PasswordResetPrefix string = "passwordReset:"
+
+// Redis Key Prefix for the Password Reset Cooldown. The key exists
+// (with a TTL) while new codes will not be sent to the user.
+const PasswordResetCooldownPrefix string = "passwordResetCooldown:"
+
+// Time a Password Reset Code can be used for
+const PasswordResetLifetime time.Duration = 15 * time.Minute
+
+// Shortest time between sending Password Reset Codes to a user
+const PasswordResetCooldown time.Duration = time.Minute
+
+// Number of digits in a Password Reset Code
+const PasswordResetCodeLen int = 8
+
+// Wrong codes allowed before the Password Reset Code is thrown out
+const PasswordResetMaxAttempts int = 5
+
+// Notifier used to send Password Reset Codes to users (i.e. a
+// notify.SMTPNotifier). Set before startup. Password Reset Codes are
+// not issued while it is nil.
+var PasswordResetNotifier notify.Notifier = nil
+
+// Script for atomically using a Password Reset Code. The code is deleted
+// when used or after too many wrong attempts. Returns 1 if the code is
+// right, 0 if it is wrong, and -1 if there is no code.
+//
+// KEYS[1] :: Password Reset HashTable
+// ARGV[1] :: hashed code
+// ARGV[2] :: max attempts
+var confirmPasswordResetScript = radix.NewEvalScript(1, `
+local code = redis.call('HGET', KEYS[1], 'code')
+if not code then
+	return -1
+elseif code == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+end
+
+return 0
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Account Recovery
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Set Email Endpoint/Command. An empty Email
+// removes the user's Email Address.
+type SetEmailCommandBody struct {
+	Password string
+	Email    string
+}
+
+// JSON Fields for the Forgot Password Endpoint/Command
+type ForgotPasswordCommandBody struct {
+	Username string
+}
+
+// JSON Fields for the Reset Password Endpoint/Command
+type ResetPasswordCommandBody struct {
+	Username    string
+	Code        string
+	NewPassword string
+}
+
+// Set Email Endpoint. Requires the current password. The Email Address
+// is where Password Reset Codes are sent and is never shown to other
+// users.
+func SetEmail(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := SetEmailCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.Email != "" && !isValidEmail(rqBody.Email) {
+		return policy.UnSuccessfulResponse("Invalid Email Address!")
+	}
+
+	username, err := getUsername(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" || !IsValidLogin(username, rqBody.Password) {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	if rqBody.Email == "" {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HDEL", AuthIDSetPrefix+header.UserID, AuthIDSetEmailField))
+	} else {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", AuthIDSetPrefix+header.UserID, AuthIDSetEmailField, rqBody.Email))
+	}
+
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Forgot Password Endpoint. Sends a single use Password Reset Code to
+// the user through the PasswordResetNotifier. The response is the same
+// whether or not the user exists, so it can not be used to find users.
+// Fails if no PasswordResetNotifier is configured.
+func ForgotPassword(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	rqBody := ForgotPasswordCommandBody{}
+	err := bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if PasswordResetNotifier == nil {
+		return policy.UnSuccessfulResponse("Password Reset Is Disabled!")
+	}
+
+	authID, err := getAuthID(rqBody.Username)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.SuccessfulResponse()
+	} else if authID == "" {
+		return policy.SuccessfulResponse()
+	}
+
+	// Users without passwords (i.e. guests) can not reset them
+	var checksum string
+	err = redis.MainRedis.Do(radix.Cmd(&checksum, "HGET", UserPassTable, rqBody.Username))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if checksum == "" {
+		return policy.SuccessfulResponse()
+	}
+
+	var ready string
+	err = redis.MainRedis.Do(radix.Cmd(&ready, "SET", PasswordResetCooldownPrefix+authID, "1",
+		"PX", fmt.Sprintf("%d", PasswordResetCooldown.Milliseconds()), "NX"))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if ready == "" {
+		return policy.SuccessfulResponse()
+	}
+
+	code, err := newPasswordResetCode(authID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	var email string
+	err = redis.MainRedis.Do(radix.Cmd(&email, "HGET", AuthIDSetPrefix+authID, AuthIDSetEmailField))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = PasswordResetNotifier.Notify(notify.Message{
+		Username: rqBody.Username,
+		Address:  email,
+		Subject:  "Password Reset Code",
+		Body: fmt.Sprintf("Your Password Reset Code is %s\nIt can be used for %s. If you did not ask to reset your password you can ignore this message.",
+			code, PasswordResetLifetime),
+	})
+	if err != nil {
+		log.Printf("Error Sending Password Reset Code! Username: %s\tErr: %v\n", rqBody.Username, err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Reset Password Endpoint. Sets a new password using a Password Reset
+// Code. Every session of the user is revoked and the login lockout for
+// the username is cleared.
+func ResetPassword(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	rqBody := ResetPasswordCommandBody{}
+	err := bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if !passwordIsStrong(rqBody.NewPassword) {
+		return policy.UnSuccessfulResponse("Weak Password!")
+	}
+
+	authID, err := getAuthID(rqBody.Username)
+	if err != nil || authID == "" {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	var result int
+	err = redis.MainRedis.Do(confirmPasswordResetScript.Cmd(&result, PasswordResetPrefix+authID,
+		hashPasswordResetCode(authID, rqBody.Code), fmt.Sprintf("%d", PasswordResetMaxAttempts)))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if result != 1 {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	checksum := sha512.Sum512([]byte(passHashSalt + rqBody.NewPassword))
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", UserPassTable, rqBody.Username, hex.EncodeToString(checksum[:])))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = RevokeAllSessions(authID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = ClearLoginFailures(rqBody.Username, "")
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Makes a new Password Reset Code for a user replacing any earlier
+// code. Only the hash of the code is stored.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> string :: the code to send to the user
+//         -> error  :: non-nil if the database could not be written
+func newPasswordResetCode(authID string) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(PasswordResetCodeLen)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	code := fmt.Sprintf("%0*d", PasswordResetCodeLen, n)
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", PasswordResetPrefix+authID))
+	if err != nil {
+		return "", err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", PasswordResetPrefix+authID,
+		"code", hashPasswordResetCode(authID, code),
+		"attempts", "0"))
+	if err != nil {
+		return "", err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "PEXPIRE", PasswordResetPrefix+authID, fmt.Sprintf("%d", PasswordResetLifetime.Milliseconds())))
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Returns the hex hash of a Password Reset Code. The code is hashed
+// with the AuthID so equal codes for different users do not match.
+func hashPasswordResetCode(authID string, code string) string {
+	hashed := sha256.Sum256([]byte(authID + ":" + code))
+	return hex.EncodeToString(hashed[:])
+}
+
+// Returns whether an Email Address is a bare address (no display name)
+// short enough to be stored.
+func isValidEmail(email string) bool {
+	if len(email) > EmailMax {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/notify"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestPasswordReset(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "RESET"
+	password := "SomeP@ssword123"
+	newPassword := "SomeOtherP@ssword456"
+	DeleteUser(validUsername)
+
+	createUserSuccess(t, validUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	redis.MainRedis.Do(radix.Cmd(nil, "DEL", PasswordResetCooldownPrefix+authID, PasswordResetPrefix+authID))
+
+	file, err := ioutil.TempFile("", "reset*.log")
+	if err != nil {
+		t.Fatalf("Error Creating File! Err: %v\n", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	oldNotifier := PasswordResetNotifier
+	PasswordResetNotifier = nil
+
+	success := commandTestHelper(t, "", policy.CmdForgotPass, ForgotPassword, ForgotPasswordCommandBody{Username: validUsername})
+	if success.Successful {
+		t.Errorf("Password Reset was Accepted Without a Notifier!\n")
+	}
+
+	PasswordResetNotifier = notify.LogNotifier{Path: file.Name()}
+	defer func() { PasswordResetNotifier = oldNotifier }()
+
+	t.Run("Email Addresses Are Checked", func(t *testing.T) {
+		success := commandTestHelper(t, authID, policy.CmdSetEmail, SetEmail, SetEmailCommandBody{Password: password, Email: "Someone <someone@example.com>"})
+		if success.Successful {
+			t.Errorf("Set an Invalid Email Address!\n")
+		}
+
+		success = commandTestHelper(t, authID, policy.CmdSetEmail, SetEmail, SetEmailCommandBody{Password: password, Email: "someone@example.com"})
+		if !success.Successful {
+			t.Errorf("Could Not Set an Email Address! Err: %s\n", success.Err)
+		}
+	})
+
+	commandTestHelper(t, "", policy.CmdForgotPass, ForgotPassword, ForgotPasswordCommandBody{Username: validUsername})
+
+	contents, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("Error Reading Notifications! Err: %v\n", err)
+	}
+
+	match := regexp.MustCompile(`Code is (\d+)`).FindStringSubmatch(string(contents))
+	if match == nil {
+		t.Fatalf("Password Reset Code was not sent! Notifications: %s\n", string(contents))
+	}
+	code := match[1]
+
+	t.Run("Wrong Codes Are Rejected", func(t *testing.T) {
+		success := commandTestHelper(t, "", policy.CmdResetPass, ResetPassword, ResetPasswordCommandBody{Username: validUsername, Code: "wrong", NewPassword: newPassword})
+		if success.Successful {
+			t.Errorf("Password Reset With the Wrong Code!\n")
+		}
+	})
+
+	t.Run("Codes Reset Passwords", func(t *testing.T) {
+		success := commandTestHelper(t, "", policy.CmdResetPass, ResetPassword, ResetPasswordCommandBody{Username: validUsername, Code: code, NewPassword: newPassword})
+		if !success.Successful {
+			t.Fatalf("Could Not Reset Password! Err: %s\n", success.Err)
+		}
+
+		loginUserSuccess(t, validUsername, newPassword)
+		loginUserError(t, validUsername, password)
+	})
+
+	t.Run("Codes Are Single Use", func(t *testing.T) {
+		success := commandTestHelper(t, "", policy.CmdResetPass, ResetPassword, ResetPasswordCommandBody{Username: validUsername, Code: code, NewPassword: password})
+		if success.Successful {
+			t.Errorf("Password Reset Code was used twice!\n")
+		}
+	})
+
+	redis.MainRedis.Do(radix.Cmd(nil, "DEL", PasswordResetCooldownPrefix+authID))
+	DeleteUser(validUsername)
+}
@@ -0,0 +1,418 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+// Redis Key Prefix for a finished game's summary (JSON string).
+// Concatenated with GameID
+const GameResultPrefix string = "gameResult:"
+
+// Redis List Key Prefix for a user's match history (JSON entries).
+// Concatenated with UserID. Newest entries are first.
+const MatchHistoryPrefix string = "matchHistory:"
+
+// Time a finished game's summary is kept
+const GameResultLifetime time.Duration = 30 * 24 * time.Hour
+
+// Number of entries kept in a user's match history
+const MatchHistoryMax int64 = 100
+
+// Default and Maximum number of entries returned by the Match History
+// Endpoint/Command
+const (
+	MatchHistoryDefaultLimit int = 20
+	MatchHistoryMaxLimit     int = 100
+)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Game Results
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Results the game process reports when a game is finished. The
+// game reports them in the "Result" field of its response to an
+// action (see ApplyAction). Rated games also update the ratings and
+// leaderboards of their stored game type (see recordLeaderboardResults).
+type GameResultReport struct {
+	Players []PlayerResult
+
+	// Whether the results are rated in the game's type. Games can not
+	// choose the type themselves.
+	Rated bool `json:",omitempty"`
+
+	// Custom stats for the whole game
+	Stats map[string]interface{} `json:",omitempty"`
+}
+
+// A player's result in a finished game
+type PlayerResult struct {
+	UserID string
+
+	// Place in the game starting at 1. Players may share a place.
+	Placement int
+	Score     float64
+
+	// Custom stats for the player
+	Stats map[string]interface{} `json:",omitempty"`
+}
+
+// Summary of a finished game
+type GameSummary struct {
+	GameID   string
+	Owner    string
+	GameType string `json:",omitempty"`
+
+	// Seconds since epoch
+	CreatedAt  int64
+	FinishedAt int64
+
+	Players []PlayerResult
+	Stats   map[string]interface{} `json:",omitempty"`
+}
+
+// An entry in a user's match history
+type MatchHistoryEntry struct {
+	GameID   string
+	GameType string `json:",omitempty"`
+
+	// Time the game finished (seconds since epoch)
+	Time       int64
+	Placement  int
+	Score      float64
+	NumPlayers int
+}
+
+// JSON Fields for the Match History Endpoint/Command
+type MatchHistoryCommandBody struct {
+	// User to look up ("" for the request's user). Only games the
+	// request's user played in are returned for other users.
+	UserID string
+
+	Offset int
+	Limit  int
+}
+
+// Response to the Match History Endpoint/Command
+type MatchHistory struct {
+	Entries []MatchHistoryEntry
+}
+
+// JSON Fields for the Game Result Endpoint/Command
+type GameResultCommandBody struct {
+	GameID string
+}
+
+// JSON Fields the game may add to its response to an action
+type gameActionResponse struct {
+	Leaderboard []LeaderboardUpdate
+	Result      *GameResultReport
+}
+
+// Match History Endpoint. Returns a page of a user's finished games,
+// newest first. Users see all of their own history, but only the games
+// they played in (see isGameParticipant) of someone else's history, so a
+// page of another user's history may have fewer entries than the limit.
+func GetMatchHistory(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := MatchHistoryCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.UserID == "" {
+		rqBody.UserID = header.UserID
+	}
+
+	limit := rqBody.Limit
+	if limit <= 0 {
+		limit = MatchHistoryDefaultLimit
+	} else if limit > MatchHistoryMaxLimit {
+		limit = MatchHistoryMaxLimit
+	}
+
+	if rqBody.Offset < 0 {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var entries []string
+	err = redis.MainRedis.Do(radix.Cmd(&entries, "LRANGE", MatchHistoryPrefix+rqBody.UserID,
+		fmt.Sprintf("%d", rqBody.Offset), fmt.Sprintf("%d", rqBody.Offset+limit-1)))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	history := MatchHistory{Entries: make([]MatchHistoryEntry, 0, len(entries))}
+	for _, entry := range entries {
+		var parsed MatchHistoryEntry
+		err = json.Unmarshal([]byte(entry), &parsed)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		if rqBody.UserID != header.UserID {
+			summary, err := GetGameSummary(parsed.GameID)
+			if err != nil {
+				return policy.RespWithError(err)
+			} else if !isGameParticipant(summary, header.UserID) {
+				continue
+			}
+		}
+
+		history.Entries = append(history.Entries, parsed)
+	}
+
+	return policy.CommandResponse{
+		Data:   history,
+		Digest: json.Marshal,
+	}
+}
+
+// Game Result Endpoint. Returns the summary of a finished game to the
+// users who played in it (see isGameParticipant).
+func GetGameResult(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := GameResultCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	summary, err := GetGameSummary(rqBody.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if summary.GameID == "" {
+		return policy.UnSuccessfulResponse("Game Has No Result!")
+	} else if !isGameParticipant(summary, header.UserID) {
+		log.Printf("Unauthorized Attempt! User %s did not play in game %s\n", header.UserID, rqBody.GameID)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	return policy.CommandResponse{
+		Data:   summary,
+		Digest: json.Marshal,
+	}
+}
+
+// Returns the summary of a finished game. The summary is empty if the
+// game has not finished (or the summary has expired).
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> GameSummary :: the summary of the game
+//         -> error       :: non-nil if the database could not be read
+func GetGameSummary(gameID string) (GameSummary, error) {
+	summary := GameSummary{}
+
+	var summaryJSON string
+	err := redis.MainRedis.Do(radix.Cmd(&summaryJSON, "GET", GameResultPrefix+gameID))
+	if err != nil || summaryJSON == "" {
+		return summary, err
+	}
+
+	err = json.Unmarshal([]byte(summaryJSON), &summary)
+	return summary, err
+}
+
+// Returns whether a user played in a finished game. The owner counts as
+// a player.
+//
+// summary :: summary of the game (see GetGameSummary)
+// authID  :: Unique Identifier for a user
+func isGameParticipant(summary GameSummary, authID string) bool {
+	if summary.GameID == "" {
+		return false
+	} else if summary.Owner == authID {
+		return true
+	}
+
+	for _, player := range summary.Players {
+		if player.UserID == authID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Records the results of a finished game and closes its room. Each
+// player on the roster gets an entry in their match history. Results
+// for players not on the roster are ignored. Games are only finished
+// once.
+//
+// gameID :: Unique Identifier for game in string form
+// report :: results reported by the game
+//
+// returns -> GameSummary :: the stored summary (empty if the game does
+//                           not exist or already finished)
+//         -> error       :: non-nil if the database could not be
+//                           read/written
+func FinishGame(gameID string, report GameResultReport) (GameSummary, error) {
+	metadata, err := GetGameMetadata(gameID)
+	if err != nil {
+		return GameSummary{}, err
+	} else if metadata.Owner == "" {
+		return GameSummary{}, nil
+	}
+
+	var roster []string
+	err = redis.MainRedis.Do(radix.Cmd(&roster, "SMEMBERS", PlayerSetPrefix+gameID))
+	if err != nil {
+		return GameSummary{}, err
+	}
+
+	onRoster := make(map[string]bool, len(roster))
+	for _, player := range roster {
+		onRoster[player] = true
+	}
+
+	summary := GameSummary{
+		GameID:     gameID,
+		Owner:      metadata.Owner,
+		GameType:   metadata.GameType,
+		CreatedAt:  metadata.CreatedAt,
+		FinishedAt: time.Now().UTC().Unix(),
+		Players:    make([]PlayerResult, 0, len(report.Players)),
+		Stats:      report.Stats,
+	}
+
+	for _, result := range report.Players {
+		if onRoster[result.UserID] {
+			onRoster[result.UserID] = false
+			summary.Players = append(summary.Players, result)
+		}
+	}
+
+	summaryBytes, err := json.Marshal(summary)
+	if err != nil {
+		return GameSummary{}, err
+	}
+
+	var stored string
+	err = redis.MainRedis.Do(radix.Cmd(&stored, "SET", GameResultPrefix+gameID, string(summaryBytes),
+		"NX", "EX", fmt.Sprintf("%d", int64(GameResultLifetime.Seconds()))))
+	if err != nil || stored == "" {
+		return GameSummary{}, err
+	}
+
+	for _, result := range summary.Players {
+		err = addMatchHistory(result.UserID, MatchHistoryEntry{
+			GameID:     gameID,
+			GameType:   summary.GameType,
+			Time:       summary.FinishedAt,
+			Placement:  result.Placement,
+			Score:      result.Score,
+			NumPlayers: len(summary.Players),
+		})
+		if err != nil {
+			return GameSummary{}, err
+		}
+	}
+
+	var ratings map[string]Rating
+	if report.Rated && len(summary.Players) >= 2 {
+		results := make([]RatingResult, len(summary.Players))
+		for i, result := range summary.Players {
+			results[i] = RatingResult{AuthID: result.UserID, Placement: result.Placement}
+		}
+
+		ratings, err = UpdateRatings(summary.GameType, gameID, results)
+		if err != nil {
+			log.Printf("Error Rating Finished Game %s: %v\n", gameID, err)
+		}
+	}
+
+	if report.Rated {
+		err = recordLeaderboardResults(summary, ratings)
+		if err != nil {
+			log.Printf("Error Updating Leaderboards for Finished Game %s: %v\n", gameID, err)
+		}
+	}
+
+	return summary, deleteGame(gameID, metadata.Owner)
+}
+
+// Checks the game's response to an action for leaderboard updates and
+// results. Applies the updates for players on the roster to the
+// leaderboards of the game's stored type and finishes the game if the
+// game reported results.
+func handleGameResponse(gameID string, response string) error {
+	parsed := gameActionResponse{}
+	err := json.Unmarshal([]byte(response), &parsed)
+	if err != nil {
+		// Responses do not have to be JSON objects
+		return nil
+	}
+
+	var gameType string
+	if len(parsed.Leaderboard) > 0 {
+		gameType, err = GetGameType(gameID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, update := range parsed.Leaderboard {
+		isInGame, err := IsUserInGame(update.UserID, gameID)
+		if err != nil {
+			return err
+		} else if !isInGame {
+			continue
+		}
+
+		// Games can only update their own type's leaderboards
+		update.GameType = gameType
+		err = UpdateLeaderboard(update)
+		if err != nil {
+			return err
+		}
+	}
+
+	if parsed.Result == nil {
+		return nil
+	} else if len(parsed.Result.Players) == 0 {
+		return errors.New("Game Reported a Result without Players!")
+	}
+
+	_, err = FinishGame(gameID, *parsed.Result)
+	return err
+}
+
+// Adds an entry to a user's match history
+func addMatchHistory(authID string, entry MatchHistoryEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "LPUSH", MatchHistoryPrefix+authID, string(entryBytes)))
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "LTRIM", MatchHistoryPrefix+authID, "0", fmt.Sprintf("%d", MatchHistoryMax-1)))
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestFinishGame(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-1000"
+	playerID := "-1001"
+	strangerID := "-1002"
+	for _, userID := range []string{ownerID, playerID, strangerID} {
+		redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchHistoryPrefix+userID))
+	}
+	deleteGamesForUsers([]string{ownerID}, t)
+
+	metadata, jsonResponse := createGameForUser(ownerID, t)
+	if metadata.Id == "" {
+		t.Fatalf("Game was not created! Response: %s\n", jsonResponse)
+	}
+
+	welcome, jsonResponse := joinGameForUser(playerID, metadata.Id, t)
+	if welcome.Id != metadata.Id {
+		t.Fatalf("Could not Join Game! Response: %s\n", jsonResponse)
+	}
+
+	report := `{"Leaderboard": [{"UserID": "-1001", "GameType": "resultstest", "Metric": "resultstest"}],
+		"Result": {"Players": [
+		{"UserID": "-1001", "Placement": 1, "Score": 10, "Stats": {"kills": 3}},
+		{"UserID": "-1000", "Placement": 2, "Score": 4},
+		{"UserID": "-1002", "Placement": 3, "Score": 0}
+	], "Stats": {"turns": 12}}}`
+
+	err := handleGameResponse(metadata.Id, report)
+	if err != nil {
+		t.Fatalf("Error Finishing Game! Err: %v\n", err)
+	}
+
+	t.Run("Summary Is Stored", func(t *testing.T) {
+		summary := gameResultTestHelper(t, ownerID, metadata.Id)
+		if summary.GameID != metadata.Id || summary.Owner != ownerID {
+			t.Fatalf("Summary is for the wrong Game! Summary: %v\n", summary)
+		} else if len(summary.Players) != 2 {
+			t.Errorf("Players not on the Roster were in the Summary! Summary: %v\n", summary)
+		} else if summary.Players[0].UserID != playerID || summary.Players[0].Stats["kills"] != float64(3) {
+			t.Errorf("Player Results were not kept! Summary: %v\n", summary)
+		}
+	})
+
+	t.Run("Leaderboards Use the Game's Type", func(t *testing.T) {
+		season, err := CurrentLeaderboardSeason()
+		if err != nil {
+			t.Fatalf("Error Reading Season! Err: %v\n", err)
+		}
+
+		var otherScore, ownScore string
+		redis.MainRedis.Do(radix.Cmd(&otherScore, "ZSCORE", leaderboardKey(season, "resultstest", "resultstest"), playerID))
+		redis.MainRedis.Do(radix.Cmd(&ownScore, "ZSCORE", leaderboardKey(season, DefaultGameType, "resultstest"), playerID))
+		if otherScore != "" {
+			t.Errorf("Game Updated Another Game Type's Leaderboard!\n")
+		} else if ownScore == "" {
+			t.Errorf("Game did not Update its own Leaderboard!\n")
+		}
+	})
+
+	t.Run("Room Is Closed", func(t *testing.T) {
+		var exists bool
+		err := redis.MainRedis.Do(radix.Cmd(&exists, "HEXISTS", GameHashSetName, metadata.Id))
+		if err != nil {
+			t.Fatalf("Error Reading Games! Err: %v\n", err)
+		} else if exists {
+			t.Errorf("Finished Game was not Closed!\n")
+		}
+	})
+
+	t.Run("History Is Recorded", func(t *testing.T) {
+		history := matchHistoryTestHelper(t, ownerID, MatchHistoryCommandBody{UserID: playerID})
+		if len(history.Entries) != 1 {
+			t.Fatalf("Expected 1 History Entry! History: %v\n", history)
+		} else if entry := history.Entries[0]; entry.GameID != metadata.Id || entry.Placement != 1 || entry.NumPlayers != 2 {
+			t.Errorf("History Entry is wrong! Entry: %v\n", entry)
+		}
+
+		history = matchHistoryTestHelper(t, strangerID, MatchHistoryCommandBody{})
+		if len(history.Entries) != 0 {
+			t.Errorf("Player not on the Roster got a History Entry! History: %v\n", history)
+		}
+	})
+
+	t.Run("Only Players See Results", func(t *testing.T) {
+		summary := gameResultTestHelper(t, strangerID, metadata.Id)
+		if summary.GameID != "" {
+			t.Errorf("User who did not Play got the Summary! Summary: %v\n", summary)
+		}
+
+		history := matchHistoryTestHelper(t, strangerID, MatchHistoryCommandBody{UserID: playerID})
+		if len(history.Entries) != 0 {
+			t.Errorf("User who did not Play saw the Game in a History! History: %v\n", history)
+		}
+	})
+
+	t.Run("Games Finish Once", func(t *testing.T) {
+		summary, err := FinishGame(metadata.Id, GameResultReport{Players: []PlayerResult{{UserID: ownerID, Placement: 1}}})
+		if err != nil {
+			t.Fatalf("Error Finishing Game! Err: %v\n", err)
+		} else if summary.GameID != "" {
+			t.Errorf("Game was Finished Twice! Summary: %v\n", summary)
+		}
+	})
+
+	for _, userID := range []string{ownerID, playerID, strangerID} {
+		redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchHistoryPrefix+userID))
+	}
+	redis.MainRedis.Do(radix.Cmd(nil, "DEL", GameResultPrefix+metadata.Id))
+	removeUserFromLeaderboards(playerID)
+	deleteGamesForUsers([]string{ownerID}, t)
+}
+
+func gameResultTestHelper(t *testing.T, userID string, gameID string) GameSummary {
+	var summary GameSummary
+	endpointTestHelper(t, userID, policy.CmdGameResult, GetGameResult, GameResultCommandBody{GameID: gameID}, &summary)
+	return summary
+}
+
+func matchHistoryTestHelper(t *testing.T, userID string, body MatchHistoryCommandBody) MatchHistory {
+	var history MatchHistory
+	endpointTestHelper(t, userID, policy.CmdGameLog, GetMatchHistory, body, &history)
+	return history
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Roles
+
+// Role Key/Field for Redis UserID HashTable
+const AuthIDSetRoleField string = "role"
+
+// Roles a user may have. Each role has every permission of the roles
+// ranked below it (see roleRanks).
+const (
+	RolePlayer    string = "player"
+	RoleModerator string = "moderator"
+	RoleAdmin     string = "admin"
+	RoleService   string = "service"
+)
+
+// Rank of each Role. A higher rank has more permissions.
+var roleRanks map[string]int = map[string]int{
+	RolePlayer:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+	RoleService:   3,
+}
+
+// Lowest Role needed to use each command. Commands which are not
+// listed only need a valid signature (RolePlayer).
+//
+// This should never change during runtime!
+var CommandRoles map[policy.ClientCmd]string = map[policy.ClientCmd]string{
+	policy.CmdRevokeUser: RoleAdmin,
+	policy.CmdSetRole:    RoleAdmin,
+	policy.CmdUnlockUser: RoleAdmin,
+	policy.CmdAuditQuery: RoleAdmin,
+	policy.CmdGameQuota:  RoleAdmin,
+}
+
+// ServerTask Startup Function for Roles. Gives the service identity
+// (see policy.ServiceUserID) the service role.
+func StartRoles() (func(), error) {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "HSET", AuthIDSetPrefix+policy.ServiceUserID,
+		AuthIDSetRoleField, RoleService))
+	if err != nil {
+		return nil, err
+	}
+
+	return cleanUpRoles, nil
+}
+
+// CleanUp Function returned by Startup function. Doesn't do anything, but here
+// for consistency.
+func cleanUpRoles() {
+	log.Println("Cleaning Up Role Logic")
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Permissions
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Set Role Endpoint/Command
+type SetRoleCommandBody struct {
+	UserID string
+	Role   string
+}
+
+// Verifies the request's signature and that the request's user has the
+// role needed for the command (see CommandRoles). Requests as the
+// Service Identity must be signed with its credential. Used at the start
+// of every authenticated endpoint.
+//
+// returns -> error :: non-nil if the request must be rejected
+func Authorize(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories) error {
+	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	if err != nil {
+		return err
+	}
+
+	if header.UserID == policy.ServiceUserID {
+		err = policy.VerifyServiceCredential(header.UserID, header.Sig)
+		if err != nil {
+			return err
+		}
+	}
+
+	role, exists := CommandRoles[header.Command]
+	if !exists || role == RolePlayer {
+		return nil
+	}
+
+	hasRole, err := HasRole(header.UserID, role)
+	if err != nil {
+		return err
+	} else if !hasRole {
+		auditRequest(header, AuditAdminAction, "", AuditFailure, fmt.Sprintf("Command %d Needs Role %s", header.Command, role))
+		return errors.New("User " + header.UserID + " does not have the role " + role)
+	}
+
+	return nil
+}
+
+// Set Role Endpoint. Administrators may change the role of any user
+// up to their own role.
+func SetUserRole(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := SetRoleCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if _, exists := roleRanks[rqBody.Role]; !exists {
+		return policy.UnSuccessfulResponse("Unknown Role!")
+	}
+
+	hasRole, err := HasRole(header.UserID, rqBody.Role)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !hasRole {
+		log.Printf("Unauthorized Attempt! User %s can not give the role %s\n", header.UserID, rqBody.Role)
+		auditRequest(header, AuditAdminAction, rqBody.UserID, AuditFailure, "Set Role "+rqBody.Role)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	username, err := getUsername(rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	err = SetRole(rqBody.UserID, rqBody.Role)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditAdminAction, rqBody.UserID, AuditSuccess, "Set Role "+rqBody.Role)
+	return policy.SuccessfulResponse()
+}
+
+// Returns the role of a user. Users without a role are players.
+//
+// authID :: Unique Identifier for a user
+func GetRole(authID string) (string, error) {
+	var role string
+	err := redis.MainRedis.Do(radix.Cmd(&role, "HGET", AuthIDSetPrefix+authID, AuthIDSetRoleField))
+	if err != nil {
+		return RolePlayer, err
+	} else if _, exists := roleRanks[role]; !exists {
+		return RolePlayer, nil
+	}
+
+	return role, nil
+}
+
+// Changes the role of a user.
+//
+// authID :: Unique Identifier for a user
+// role   :: new role of the user (i.e. RoleModerator)
+func SetRole(authID string, role string) error {
+	if _, exists := roleRanks[role]; !exists {
+		return errors.New("Unknown Role: " + role)
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "HSET", AuthIDSetPrefix+authID, AuthIDSetRoleField, role))
+}
+
+// Returns whether a user has a role or a role ranked above it.
+//
+// authID :: Unique Identifier for a user
+// role   :: the lowest role needed (i.e. RoleModerator)
+func HasRole(authID string, role string) (bool, error) {
+	userRole, err := GetRole(authID)
+	if err != nil {
+		return false, err
+	}
+
+	return roleRanks[userRole] >= roleRanks[role], nil
+}
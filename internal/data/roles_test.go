@@ -0,0 +1,148 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestStartRoles(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartRoles,
+		})
+	defer cleanup()
+
+	role, err := GetRole(policy.ServiceUserID)
+	if err != nil {
+		t.Errorf("Error Getting Role! Err: %v\n", err)
+	} else if role != RoleService {
+		t.Errorf("Service Identity has role %s instead of %s\n", role, RoleService)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartRoomsSystem,
+			StartRoles,
+		})
+	defer cleanup()
+
+	playerUsername := testUserNamePrefix + "ROLEPLAYER"
+	modUsername := testUserNamePrefix + "ROLEMOD"
+	adminUsername := testUserNamePrefix + "ROLEADMIN"
+	password := "SomeP@ssword123"
+	DeleteUser(playerUsername)
+	DeleteUser(modUsername)
+	DeleteUser(adminUsername)
+
+	createUserSuccess(t, playerUsername, password)
+	createUserSuccess(t, modUsername, password)
+	createUserSuccess(t, adminUsername, password)
+	playerID := getUserTestHelper(t, playerUsername)
+	modID := getUserTestHelper(t, modUsername)
+	adminID := getUserTestHelper(t, adminUsername)
+
+	err := SetRole(adminID, RoleAdmin)
+	if err != nil {
+		t.Fatalf("Error Setting Role! Err: %v\n", err)
+	}
+
+	t.Run("Players Can Not Use Admin Commands", func(t *testing.T) {
+		success := setRoleTestHelper(t, playerID, playerID, RoleAdmin)
+		if success.Successful {
+			t.Errorf("Player Gave Themselves a Role!\n")
+		}
+	})
+
+	t.Run("Admins Can Not Give Roles Above Their Own", func(t *testing.T) {
+		success := setRoleTestHelper(t, adminID, modID, RoleService)
+		if success.Successful {
+			t.Errorf("Admin Gave the Service Role!\n")
+		}
+	})
+
+	t.Run("Admins Can Give Roles", func(t *testing.T) {
+		success := setRoleTestHelper(t, adminID, modID, RoleModerator)
+		if !success.Successful {
+			t.Fatalf("Admin Could Not Give a Role! Err: %s\n", success.Err)
+		}
+
+		isModerator, err := HasRole(modID, RoleModerator)
+		if err != nil {
+			t.Errorf("Error Checking Role! Err: %v\n", err)
+		} else if !isModerator {
+			t.Errorf("Role Was Not Given!\n")
+		}
+	})
+
+	t.Run("Players Can Not Delete Other Games", func(t *testing.T) {
+		metadata, _ := createGameForUser(adminID, t)
+		success := deleteGameByIDTestHelper(t, playerID, metadata.Id)
+		if success.Successful {
+			t.Errorf("Player Deleted Another Player's Game!\n")
+		}
+
+		deleteGamesForUsers([]string{adminID}, t)
+	})
+
+	t.Run("Moderators Can Delete Other Games", func(t *testing.T) {
+		metadata, _ := createGameForUser(playerID, t)
+		success := deleteGameByIDTestHelper(t, modID, metadata.Id)
+		if !success.Successful {
+			t.Errorf("Moderator Could Not Delete a Game! Err: %s\n", success.Err)
+		}
+	})
+
+	t.Run("Service Identity Can Delete Games", func(t *testing.T) {
+		metadata, _ := createGameForUser(playerID, t)
+
+		request, err := policy.RequestWithServiceUser(true, policy.CmdGameDelete, SelectGameArgs{GameID: metadata.Id})
+		if err != nil {
+			t.Fatalf("Error Creating Service Request! Err: %v\n", err)
+		}
+
+		response := DeleteGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+		if response.ServerError != nil {
+			t.Fatalf("Failure to Delete Game! Err: %v\n", response.ServerError)
+		}
+
+		var exists bool
+		err = redis.MainRedis.Do(radix.Cmd(&exists, "HEXISTS", GameHashSetName, metadata.Id))
+		if err != nil {
+			t.Errorf("Error Checking Game! Err: %v\n", err)
+		} else if exists {
+			t.Errorf("Service Identity Could Not Delete a Game!\n")
+		}
+	})
+
+	t.Run("Service Identity Needs Its Credential", func(t *testing.T) {
+		metadata, _ := createGameForUser(playerID, t)
+
+		success := deleteGameByIDTestHelper(t, policy.ServiceUserID, metadata.Id)
+		if success.Successful {
+			t.Errorf("Request Without the Service Credential Deleted a Game!\n")
+		}
+
+		deleteGameByIDTestHelper(t, playerID, metadata.Id)
+	})
+
+	DeleteUser(playerUsername)
+	DeleteUser(modUsername)
+	DeleteUser(adminUsername)
+}
+
+func setRoleTestHelper(t *testing.T, userID string, targetID string, role string) policy.SuccessfulData {
+	return commandTestHelper(t, userID, policy.CmdSetRole, SetUserRole, SetRoleCommandBody{UserID: targetID, Role: role})
+}
+
+func deleteGameByIDTestHelper(t *testing.T, userID string, gameID string) policy.SuccessfulData {
+	return commandTestHelper(t, userID, policy.CmdGameDelete, DeleteGame, SelectGameArgs{GameID: gameID})
+}
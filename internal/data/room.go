@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/event"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
 	"github.com/mediocregopher/radix/v3"
@@ -18,18 +18,24 @@ import (
 
 // Table / Datastructure Names
 
-// Redis Key For Game List
+// Redis Key For Game List (see ListGames for finding games)
 const GameListName string = "gameList"
 
 // Redis Key for Game Set
 const GameHashSetName string = "gameHash"
 
-// Redis Key for Owner Set
+// Redis Key for the Owner HashTable used before ownership quotas
+// (one game per owner). Only read to move owners to their owned games
+// Sets (see OwnerGamesSetPrefix and migrateGameOwners)
 const OwnerHashSetName string = "ownerMapGame"
 
 // Redis Key Prefix for Player Roster Sets
 const PlayerSetPrefix string = "roster:"
 
+// Redis Key marking the user's games Sets as filled for games created
+// before they existed (see backfillPlayerGames)
+const PlayerGamesBackfilledName string = "playerGamesBackfilled"
+
 // Redis Key for Game ID Counter
 const GameAtomicCounter string = "gameCountInteger"
 
@@ -53,25 +59,39 @@ const MetadataSetCreatedAt string = "createdAt"
 //    (number of milliseconds since epoch)
 const MetadataSetLastUsed string = "lastUsed"
 
-// Game Throttling
-
-// The Maximum Number of Games If
-// ThrottleGames is true
-const NumberOfGames = 20
+// Redis Field/Key for Game Metadata Maximum Number of Players
+//    (0 for no maximum)
+const MetadataSetMaxPlayers string = "maxPlayers"
 
-// Whether to Throttle to the Maximum
-// Number of Games or Not
-const ThrottleGames = false
+// Redis Field/Key for Game Metadata Tags
+//    (comma separated, see normalizeGameTags)
+const MetadataSetTags string = "tags"
 
 // ServerTask Startup Function for Game Rooms. Takes care of initialization.
-// Sets Atomic Counter for GameIDs. Error is returned if the Database
-// can't be reached.
+// Sets Atomic Counter for GameIDs, moves game owners to their owned games
+// Sets, and fills the lobby and player indexes. Error is returned if the
+// Database can't be reached.
 func StartRoomsSystem() (func(), error) {
 	err := redis.MainRedis.Do(radix.Cmd(nil, "SETNX", GameAtomicCounter, "0"))
 	if err != nil {
 		return nil, err
 	}
 
+	err = migrateGameOwners()
+	if err != nil {
+		return nil, err
+	}
+
+	err = backfillGameIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = backfillPlayerGames()
+	if err != nil {
+		return nil, err
+	}
+
 	return cleanUpRoomSystem, nil
 }
 
@@ -92,44 +112,140 @@ type GameWelcomeData struct {
 	Id         string
 	NumPlayers uint16
 	Data       string
+
+	// Place in the waitlist (starting at 1) when the game was full.
+	// Waiting players are seated automatically when a player leaves.
+	WaitlistPosition int `json:",omitempty"`
 }
 
 // JSON Fields for the Create Game Command
 // For Static game details
 type GameMetadata struct {
-	Id        string
-	Owner     string
-	CreatedAt int64 `json:",string"`
-	LastUsed  int64 `json:",string"`
+	Id         string
+	Owner      string
+	CreatedAt  int64 `json:",string"`
+	LastUsed   int64 `json:",string"`
+	MaxPlayers uint16
+	Tags       []string `json:",omitempty"`
+	Visibility string
+	Observers  string
+	Waitlist   bool
+	GameType   string
+}
+
+// JSON Fields for the Create Game Command. Every field is optional.
+type CreateGameCommandBody struct {
+	// Type of game to play (see GameTypes, DefaultGameType if missing)
+	GameType string
+
+	// Maximum Number of Players (0 for no maximum)
+	MaxPlayers uint16
+
+	// Tags players can search for (see ListGames)
+	Tags []string
+
+	// GameVisibilityPublic (default), GameVisibilityUnlisted, or
+	// GameVisibilityPrivate
+	Visibility string
+
+	// GameObserversAnyone, GameObserversRoster, or GameObserversFriends.
+	// Defaults to roster for private games and anyone otherwise.
+	Observers string
+
+	// Password for joining a private game. Requires a secure connection.
+	Password string
+
+	// Whether players joining a full game wait for a seat
+	// (needs MaxPlayers)
+	Waitlist bool
 }
 
 // Unmarshal Structure for Joining/Finding Games
 type SelectGameArgs struct {
 	GameID string
+
+	// Used to join private games (see CreateGameInvite)
+	InviteCode string `json:",omitempty"`
+	Password   string `json:",omitempty"`
 }
 
 // Create Game Endpoint to add a Game and new Game Data to the
-// the database. Each player can only own/create one game. They
-// may delete and create games freely.
+// the database. Each player can own as many games as their quota
+// allows (see UserGameQuota). They may delete and create games
+// freely. Each game is played by the process of its game type (see
+// GameTypes).
 func CreateGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
 	}
 
+	// Games may be created with the defaults by sending no body
+	args := CreateGameCommandBody{}
+	err = bodyFactories.ParseFactory(&args)
+	if err != nil && err != policy.ErrEmptyBody {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	tags, err := normalizeGameTags(args.Tags)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if args.Visibility == "" {
+		args.Visibility = GameVisibilityPublic
+	}
+
+	if args.Observers == "" && args.Visibility == GameVisibilityPrivate {
+		args.Observers = GameObserversRoster
+	} else if args.Observers == "" {
+		args.Observers = GameObserversAnyone
+	}
+
+	if _, exists := GameTypes[args.GameType]; args.GameType != "" && !exists {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if !isValidGameVisibility(args.Visibility) || !isValidGameObservers(args.Observers) || len(args.Password) > GamePasswordMax {
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	} else if !applyGameTypeSettings(&args) {
+		return policy.UnSuccessfulResponse("Too Many Players for the Game Type!")
+	} else if args.Password != "" && !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	metadata, err := createGame(header.UserID, args, tags)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return policy.CommandResponse{
+		Data:   metadata,
+		Digest: json.Marshal,
+	}
+}
+
+// Creates a game owned by a user and adds them to its roster. Used by
+// the Create Game Endpoint and matchmaking.
+//
+// ownerID :: Unique Identifier for the user owning the game
+// args    :: validated Create Game arguments (see applyGameTypeSettings)
+// tags    :: normalized tags (see normalizeGameTags)
+//
+// returns -> GameMetadata :: metadata of the game (Id is "" if the user
+//                            cannot create a game or no GameID is free)
+//         -> error        :: non-nil if the database could not be read/written
+func createGame(ownerID string, args CreateGameCommandBody, tags []string) (GameMetadata, error) {
 	var success int
 	var players int
 
-	canCreateGame, err := CanCreateGame(header.UserID)
+	canCreateGame, err := CanCreateGame(ownerID)
 
 	if err != nil {
-		return policy.RespWithError(err)
+		return GameMetadata{}, err
 	} else if !canCreateGame {
-		return policy.CommandResponse{
-			Data:   GameMetadata{Id: "", Owner: "", CreatedAt: 0},
-			Digest: json.Marshal,
-		}
+		return GameMetadata{}, nil
 	}
 
 	//// We are good to create game
@@ -139,90 +255,133 @@ func CreateGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFac
 	for tries := 0; tries < 100; tries++ {
 		atomicClockValue, err := IncrementCounterAndGetValue(GameAtomicCounter)
 		if err != nil {
-			return policy.RespWithError(err)
+			return GameMetadata{}, err
 		}
 
 		gameID = StringIDFromNumbers(atomicClockValue)
-		metadata = GameMetadata{Id: gameID, Owner: header.UserID, CreatedAt: time.Now().UTC().Unix(), LastUsed: time.Now().UTC().Unix()}
+		metadata = GameMetadata{
+			Id:         gameID,
+			Owner:      ownerID,
+			CreatedAt:  time.Now().UTC().Unix(),
+			LastUsed:   time.Now().UTC().Unix(),
+			MaxPlayers: args.MaxPlayers,
+			Tags:       tags,
+			Visibility: args.Visibility,
+			Observers:  args.Observers,
+			Waitlist:   args.Waitlist && args.MaxPlayers > 0,
+			GameType:   args.GameType,
+		}
 
 		err = redis.MainRedis.Do(radix.Cmd(&success, "HSETNX", GameHashSetName, gameID, "{}"))
 		if err != nil {
-			return policy.RespWithError(err)
+			return GameMetadata{}, err
 		} else if success != 0 {
-			err = redis.MainRedis.Do(radix.Cmd(&success, "HSET", OwnerHashSetName, header.UserID, gameID))
+			claimed, err := claimGame(ownerID, gameID)
 			if err != nil {
-				return policy.RespWithError(err)
-			} else if success == 0 {
-				return policy.RespWithError(errors.New("Could Not Map User " + header.UserID + " to " + gameID))
+				return GameMetadata{}, err
+			} else if !claimed {
+				// Another request used the last of the user's quota
+				return GameMetadata{}, redis.MainRedis.Do(radix.Cmd(nil, "HDEL", GameHashSetName, gameID))
 			}
 
 			err = SetGameMetadata(metadata)
 			if err != nil {
-				return policy.RespWithError(err)
+				return GameMetadata{}, err
 			}
 
-			err = redis.MainRedis.Do(radix.Cmd(&players, "SADD", PlayerSetPrefix+gameID, header.UserID))
+			if args.Password != "" {
+				err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+gameID,
+					MetadataSetPassword, hashGamePassword(gameID, args.Password)))
+				if err != nil {
+					return GameMetadata{}, err
+				}
+			}
+
+			err = redis.MainRedis.Do(radix.Cmd(&players, "SADD", PlayerSetPrefix+gameID, ownerID))
 			if err != nil {
-				return policy.RespWithError(err)
+				return GameMetadata{}, err
 			} else if players != 1 {
-				return policy.RespWithError(errors.New("Failed to Add Player to Game!"))
+				return GameMetadata{}, errors.New("Failed to Add Player to Game!")
+			}
+
+			err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", PlayerGamesSetPrefix+ownerID, gameID))
+			if err != nil {
+				return GameMetadata{}, err
 			}
 
-			err = redis.MainRedis.Do(radix.Cmd(nil, "RPUSH", GameListName, gameID))
+			err = recordRosterJoin(gameID, ownerID)
 			if err != nil {
-				return policy.RespWithError(err)
+				return GameMetadata{}, err
+			}
+
+			err = indexGame(metadata)
+			if err != nil {
+				return GameMetadata{}, err
 			}
 
 			// We can also do other things here like push metadata or channel numbers under different keys/tables.
 			// As long as the gameID is an identifier.
 
-			return policy.CommandResponse{
-				Data:   metadata,
-				Digest: json.Marshal,
-			}
+			return metadata, nil
 		} else {
 			log.Printf("Game already exists at " + gameID)
 		}
 	}
 
 	// Too Many Full Games Try Again Later
-	return policy.CommandResponse{
-		Data:   GameMetadata{Id: "", Owner: "", CreatedAt: 0},
-		Digest: json.Marshal,
-	}
+	return GameMetadata{}, nil
 }
 
+// Returns whether a user may create another game. The server must be
+// under its global quota and the user under their own quota (see
+// GlobalGameQuota and UserGameQuota).
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> bool  :: whether the user may create a game
+//         -> error :: non-nil if the database could not be read
 func CanCreateGame(authID string) (bool, error) {
-	var success int
 	var games int
 
+	globalQuota, err := GlobalGameQuota()
+	if err != nil {
+		return false, err
+	}
+
 	// Find the number of games
 	// We could also use metadataHashSetName Here
-	err := redis.MainRedis.Do(radix.Cmd(&games, "HLEN", GameHashSetName))
+	err = redis.MainRedis.Do(radix.Cmd(&games, "HLEN", GameHashSetName))
 	if err != nil {
 		return false, err
 	}
 
 	// Throttle Number of Games
 	// Cannot create too many games
-	if games >= NumberOfGames && ThrottleGames {
+	if globalQuota != GameQuotaUnlimited && games >= globalQuota {
 		return false, nil
 	}
 
-	// Check if user already has a game
-	err = redis.MainRedis.Do(radix.Cmd(&success, "HEXISTS", OwnerHashSetName, authID))
+	userQuota, err := UserGameQuota(authID)
+	if err != nil {
+		return false, err
+	} else if userQuota == GameQuotaUnlimited {
+		return true, nil
+	}
+
+	// Check if user already has too many games
+	err = redis.MainRedis.Do(radix.Cmd(&games, "SCARD", OwnerGamesSetPrefix+authID))
 	if err != nil {
-		// TODO Redirect to Get Game Info
 		return false, err
 	}
 
-	return success == 0, nil
+	return games < userQuota, nil
 }
 
 // Join Game Endpoint adds the player to the roster of an existing
 // game. This means they can "applyActions" to the game (see game.go)
+// Full games reject the player or add them to the game's waitlist.
 func JoinGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
@@ -235,9 +394,11 @@ func JoinGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFacto
 		return policy.UnSuccessfulResponse("Bad Arguments!")
 	}
 
+	if args.Password != "" && !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
 	var gameDataSerialized string
-	var success int
-	var numPlayers uint16
 
 	err = redis.MainRedis.Do(radix.Cmd(&gameDataSerialized, "HGET", GameHashSetName, args.GameID))
 	if err != nil {
@@ -249,28 +410,54 @@ func JoinGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFacto
 		}
 	}
 
-	err = redis.MainRedis.Do(radix.Cmd(&success, "SADD", PlayerSetPrefix+args.GameID, header.UserID))
+	metadata, err := GetGameMetadata(args.GameID)
 	if err != nil {
 		return policy.RespWithError(err)
-	} else if success < 1 {
-		log.Printf("User Tried to Add Themselves More Than Once!\nGameID: %s\tPlayerID: %s\n", args.GameID, header.UserID)
 	}
 
-	err = redis.MainRedis.Do(radix.Cmd(&numPlayers, "SCARD", PlayerSetPrefix+args.GameID))
+	isBanned, err := IsBannedFromGame(header.UserID, args.GameID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if isBanned {
+		return policy.UnSuccessfulResponseWithCode("Banned From Game!", policy.CodeBannedFromGame)
+	}
+
+	canJoin, err := canJoinGame(header.UserID, metadata, args)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !canJoin {
+		return policy.UnSuccessfulResponse("Game is Private!")
+	}
+
+	joined, position, err := joinRosterOrWaitlist(header.UserID, args.GameID, true)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if joined < 0 && position == 0 {
+		return policy.UnSuccessfulResponse("Game is Full!")
+	} else if joined < 0 {
+		return policy.CommandResponse{
+			Data:   GameWelcomeData{Id: args.GameID, NumPlayers: metadata.MaxPlayers, WaitlistPosition: position},
+			Digest: json.Marshal,
+		}
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GameKickedPrefix+args.GameID, header.UserID))
 	if err != nil {
-		log.Printf("Redis Error! Err %v\n", err)
+		return policy.RespWithError(err)
 	}
 
 	return policy.CommandResponse{
-		Data:   GameWelcomeData{Id: args.GameID, NumPlayers: numPlayers, Data: gameDataSerialized},
+		Data:   GameWelcomeData{Id: args.GameID, NumPlayers: uint16(joined), Data: gameDataSerialized},
 		Digest: json.Marshal,
 	}
 }
 
 // Leave Game Endpoint removes the player from the roster of an existing
 // game. This means they can no longer "applyActions" to the game (see game.go)
+// The next player on the game's waitlist takes their seat. Players on
+// the waitlist leave it instead.
 func LeaveGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
@@ -284,8 +471,6 @@ func LeaveGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFact
 	}
 
 	var doesGameExist bool
-	var numPlayers uint16
-	var diff uint16
 
 	err = redis.MainRedis.Do(radix.Cmd(&doesGameExist, "HEXISTS", GameHashSetName, args.GameID))
 	if err != nil {
@@ -296,70 +481,214 @@ func LeaveGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFact
 		return policy.UnSuccessfulResponse("Game Does Not Exist!")
 	}
 
-	err = redis.MainRedis.Do(radix.Cmd(&numPlayers, "SCARD", PlayerSetPrefix+args.GameID))
+	wasInGame, err := leaveRoster(header.UserID, args.GameID)
 	if err != nil {
 		return policy.RespWithError(err)
+	} else if !wasInGame {
+		wasWaiting, err := leaveWaitlist(header.UserID, args.GameID)
+		if err != nil {
+			return policy.RespWithError(err)
+		} else if !wasWaiting {
+			return policy.UnSuccessfulResponse(args.GameID)
+		}
+
+		return policy.SuccessfulResponse()
 	}
 
-	err = redis.MainRedis.Do(radix.Cmd(&diff, "SREM", PlayerSetPrefix+args.GameID, header.UserID))
+	// Owners pass the game on to the longest present player
+	owner, err := getGameOwner(args.GameID)
 	if err != nil {
 		return policy.RespWithError(err)
-	} else if diff == 0 {
-		return policy.UnSuccessfulResponse(args.GameID)
-	} else if numPlayers-diff <= 0 {
-		event.SubmitGameForHealthCheck(args.GameID)
+	} else if owner == header.UserID {
+		_, err = handOverGame(args.GameID, owner)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
 	}
 
 	return policy.SuccessfulResponse()
 }
 
-// An Owner may delete their game at any time. This means the game
-// metadata and state will be removed from the database.
+// An Owner may delete their games at any time. This means the game
+// metadata and state will be removed from the database. Moderators
+// (and the service identity) may delete any game. The GameID is
+// required since owners may own several games.
 func DeleteGame(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
-	err := bodyFactories.SigVerify(header.UserID, header.Sig)
+	err := Authorize(header, bodyFactories)
 	if err != nil {
 		log.Printf("Unauthorized Attempt! Error: %v\n", err)
 		return policy.UnSuccessfulResponse("Unauthorized!")
 	}
 
-	// TODO This should be done with Pipelining!!!
-	var gameID string
-	err = redis.MainRedis.Do(radix.Cmd(&gameID, "HGET", OwnerHashSetName, header.UserID))
+	args := SelectGameArgs{}
+	err = bodyFactories.ParseFactory(&args)
+	if err != nil || args.GameID == "" {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	gameID := args.GameID
+
+	var doesGameExist bool
+	err = redis.MainRedis.Do(radix.Cmd(&doesGameExist, "HEXISTS", GameHashSetName, gameID))
 	if err != nil {
 		return policy.RespWithError(err)
-	} else if gameID == "" {
-		return policy.UnSuccessfulResponse("User does not own a game!")
+	} else if !doesGameExist {
+		return policy.UnSuccessfulResponse("Game Does Not Exist!")
 	}
 
-	var success int
-	err = redis.MainRedis.Do(radix.Cmd(&success, "HDEL", GameHashSetName, gameID))
+	ownerID, err := getGameOwner(gameID)
 	if err != nil {
 		return policy.RespWithError(err)
-	} else if success == 0 {
+	}
+
+	if ownerID != header.UserID {
+		isModerator, err := HasRole(header.UserID, RoleModerator)
+		if err != nil {
+			return policy.RespWithError(err)
+		} else if !isModerator {
+			log.Printf("Unauthorized Attempt! User %s does not own game %s\n", header.UserID, gameID)
+			auditRequest(header, AuditGameDeleted, gameID, AuditFailure, "Not the Owner")
+			return policy.UnSuccessfulResponse("Unauthorized!")
+		}
+	}
+
+	err = deleteGame(gameID, ownerID)
+	if err != nil {
 		return policy.RespWithError(err)
 	}
 
+	auditRequest(header, AuditGameDeleted, gameID, AuditSuccess, "Owner "+ownerID)
+	return policy.SuccessfulResponse()
+}
+
+// Removes a game's data, metadata, and roster from the database along
+// with the owner's mapping to it and its lobby entries.
+//
+// gameID  :: Unique Identifier for game in string form
+// ownerID :: Unique Identifier for the user owning the game
+//
+// returns -> error :: non-nil if the database could not be written to
+func deleteGame(gameID string, ownerID string) error {
+	// TODO This should be done with Pipelining!!!
+	var success int
+	err := redis.MainRedis.Do(radix.Cmd(&success, "HDEL", GameHashSetName, gameID))
+	if err != nil {
+		return err
+	} else if success == 0 {
+		return errors.New("Game Does Not Exist! GameID: " + gameID)
+	}
+
 	err = redis.MainRedis.Do(radix.Cmd(&success, "DEL", MetadataSetPrefix+gameID))
 	if err != nil {
-		return policy.RespWithError(err)
+		return err
 	} else if success == 0 {
 		log.Println("Failed to Delete Metadata at:  " + MetadataSetPrefix + gameID)
 	}
 
+	var players []string
+	err = redis.MainRedis.Do(radix.Cmd(&players, "SMEMBERS", PlayerSetPrefix+gameID))
+	if err != nil {
+		return err
+	}
+
+	for _, player := range players {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", PlayerGamesSetPrefix+player, gameID))
+		if err != nil {
+			return err
+		}
+	}
+
 	var count int
 	err = redis.MainRedis.Do(radix.Cmd(&count, "SUNIONSTORE", PlayerSetPrefix+gameID, EmptyName))
 	if err != nil {
-		return policy.RespWithError(err)
+		return err
 	} else if count > 0 {
 		log.Println("Failed to Remove Players at:  " + PlayerSetPrefix + gameID)
 	}
 
-	err = redis.MainRedis.Do(radix.Cmd(nil, "HDEL", OwnerHashSetName, header.UserID))
+	err = unindexGame(gameID)
 	if err != nil {
-		return policy.RespWithError(err)
+		return err
 	}
 
-	return policy.SuccessfulResponse()
+	err = clearWaitlist(gameID)
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", GameInvitePrefix+gameID,
+		RosterJoinedPrefix+gameID, RosterActivityPrefix+gameID, GameBanPrefix+gameID, GameKickedPrefix+gameID))
+	if err != nil {
+		return err
+	}
+
+	return releaseGame(ownerID, gameID)
+}
+
+// Removes a user from every roster and waitlist. The rosters are found
+// with the user's games Set (see PlayerGamesSetPrefix). Waiting players
+// take the user's seats and games left without players are submitted
+// for a health check.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be read/written
+func removeUserFromRosters(authID string) error {
+	var gameIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&gameIDs, "SMEMBERS", PlayerGamesSetPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		_, err = leaveRoster(authID, gameID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = removeUserFromWaitlists(authID)
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", PlayerGamesSetPrefix+authID))
+}
+
+// Adds the players of games created before the user's games Sets
+// existed (see PlayerGamesSetPrefix) to them. Only runs once.
+//
+// returns -> error :: non-nil if the database could not be read/written
+func backfillPlayerGames() error {
+	var backfilled int
+	err := redis.MainRedis.Do(radix.Cmd(&backfilled, "EXISTS", PlayerGamesBackfilledName))
+	if err != nil || backfilled > 0 {
+		return err
+	}
+
+	var gameIDs []string
+	err = redis.MainRedis.Do(radix.Cmd(&gameIDs, "HKEYS", GameHashSetName))
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		var players []string
+		err = redis.MainRedis.Do(radix.Cmd(&players, "SMEMBERS", PlayerSetPrefix+gameID))
+		if err != nil {
+			return err
+		}
+
+		for _, player := range players {
+			err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", PlayerGamesSetPrefix+player, gameID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "SET", PlayerGamesBackfilledName, "1"))
 }
 
 // Returns the time in which the last recorded action was taken
@@ -437,22 +766,39 @@ func StringIDFromNumbers(counter int64) string {
 // metadata :: New Metadata Value
 //    (overwrites the id at metadata.id)
 func SetGameMetadata(metadata GameMetadata) error {
+	waitlist := "0"
+	if metadata.Waitlist {
+		waitlist = "1"
+	}
+
 	return redis.MainRedis.Do(radix.Cmd(nil, "HSET", MetadataSetPrefix+metadata.Id,
 		MetadataSetOwner, metadata.Owner,
 		MetadataSetCreatedAt, fmt.Sprintf("%d", metadata.CreatedAt),
-		MetadataSetLastUsed, fmt.Sprintf("%d", metadata.LastUsed)))
+		MetadataSetLastUsed, fmt.Sprintf("%d", metadata.LastUsed),
+		MetadataSetMaxPlayers, fmt.Sprintf("%d", metadata.MaxPlayers),
+		MetadataSetTags, strings.Join(metadata.Tags, ","),
+		MetadataSetVisibility, metadata.Visibility,
+		MetadataSetObservers, metadata.Observers,
+		MetadataSetWaitlist, waitlist,
+		MetadataSetGameType, metadata.GameType))
 }
 
 // Utility Function for selecting the game Metadata from redis
 //
 // gameID :: string unique identifier for game.
 func GetGameMetadata(gameID string) (GameMetadata, error) {
-	fields := make([]string, 3)
+	fields := make([]string, 9)
 
 	err := redis.MainRedis.Do(radix.Cmd(&fields, "HMGET", MetadataSetPrefix+gameID,
 		MetadataSetOwner,
 		MetadataSetCreatedAt,
-		MetadataSetLastUsed))
+		MetadataSetLastUsed,
+		MetadataSetMaxPlayers,
+		MetadataSetTags,
+		MetadataSetVisibility,
+		MetadataSetObservers,
+		MetadataSetWaitlist,
+		MetadataSetGameType))
 
 	data := GameMetadata{}
 
@@ -472,6 +818,36 @@ func GetGameMetadata(gameID string) (GameMetadata, error) {
 		return data, err
 	}
 
+	// Games created before these fields existed do not have them
+	if fields[3] != "" {
+		maxPlayers, err := strconv.ParseUint(fields[3], 10, 16)
+		if err != nil {
+			return data, err
+		}
+		data.MaxPlayers = uint16(maxPlayers)
+	}
+
+	if fields[4] != "" {
+		data.Tags = strings.Split(fields[4], ",")
+	}
+
+	data.Visibility = fields[5]
+	if data.Visibility == "" {
+		data.Visibility = GameVisibilityPublic
+	}
+
+	data.Observers = fields[6]
+	if data.Observers == "" {
+		data.Observers = GameObserversAnyone
+	}
+
+	data.Waitlist = fields[7] == "1"
+
+	data.GameType = fields[8]
+	if data.GameType == "" {
+		data.GameType = DefaultGameType
+	}
+
 	return data, nil
 }
 
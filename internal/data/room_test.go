@@ -167,29 +167,36 @@ func TestLeaveJoinGame(t *testing.T) {
 		t.Errorf("Number of Players is incorrect in Set! Number: %d Instead of %d!\n", numPlayers, length-3)
 	}
 
-	deleteGamesForUsers([]string{ownerID}, t)
+	// The game passes to the remaining players as owners leave
+	deleteGamesForUsers(userIDs, t)
 }
 
 func deleteGamesForUsers(userIDs []string, t *testing.T) {
-	var err error
 	var request policy.InternalUserRequest
 	var response policy.CommandResponse
 	lenUserIDs := len(userIDs)
 
 	for k := 0; k < lenUserIDs; k++ {
-		request, err = policy.RequestWithUserForTesting(
-			userIDs[k],
-			false,
-			policy.CmdGameDelete,
-			nil,
-		)
+		gameIDs, err := OwnedGames(userIDs[k])
 		if err != nil {
-			t.Errorf("Error Creating Request Payload for creating Game!")
+			t.Errorf("Error Reading Owned Games! Err: %v\n", err)
 		}
 
-		response = DeleteGame(request.Header, request.BodyFactories, request.IsSecureConnection)
-		if response.ServerError != nil {
-			t.Errorf("Got Error From Create Game Request! Err: %v\n", response.ServerError)
+		for _, gameID := range gameIDs {
+			request, err = policy.RequestWithUserForTesting(
+				userIDs[k],
+				false,
+				policy.CmdGameDelete,
+				SelectGameArgs{GameID: gameID},
+			)
+			if err != nil {
+				t.Errorf("Error Creating Request Payload for creating Game!")
+			}
+
+			response = DeleteGame(request.Header, request.BodyFactories, request.IsSecureConnection)
+			if response.ServerError != nil {
+				t.Errorf("Got Error From Create Game Request! Err: %v\n", response.ServerError)
+			}
 		}
 	}
 }
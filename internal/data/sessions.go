@@ -0,0 +1,486 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Stateless Token Configurables
+
+// Whether Login issues stateless session tokens instead of storing
+// a token in the database. Stateless tokens are verified with the
+// server key alone, so authenticated requests do not touch Redis.
+var UseStatelessTokens bool = false
+
+// Redis Key for the Stateless Token Signing Key
+const statelessTokenKeyName string = "StatelessTokenKey"
+
+// Number of bytes for the random Stateless Token Signing Key
+const statelessTokenKeyLen int = 64
+
+// Number of bytes for the random Session ID
+const sessionIDLen int = 16
+
+// Time a Stateless Token stays good for before a new login is required
+const StatelessTokenLifetime time.Duration = TokenStaleTime
+
+//
+// Revocation List Configurables
+
+// Redis Key for the Sorted Set of Revoked Session IDs. The score is
+// the unix time the session would have expired at anyways.
+const RevokedSessionsSetName string = "revokedSessions"
+
+// Redis Key for the Sorted Set of Users who revoked all their sessions.
+// The score is the time (milliseconds since epoch) of the revocation.
+const RevokedUsersSetName string = "revokedUsers"
+
+//
+// Replay Protection Configurables
+
+// Whether the signatures of stateless requests are recorded in the
+// database so a request replayed to another server is also rejected.
+// Off by default so stateless requests do not touch Redis. Signatures
+// are then only remembered by the server which accepted them.
+var ShareStatelessNonces bool = false
+
+// Redis Key Prefix for the signatures of stateless requests already
+// accepted. Concatenated with a Session ID and the signature.
+const StatelessNoncePrefix string = "statelessNonce:"
+
+// Time a stateless request's signature is remembered. Must cover every
+// timestamp a signature is accepted for (twice the signature timestamp
+// skew in route).
+const StatelessNonceLifetime time.Duration = time.Minute
+
+// Time between reloading the revocation list from the database. A
+// session revoked on another server may be accepted until then.
+const RevocationRefreshInterval time.Duration = 5 * time.Second
+
+//// Global Variables | Singletons
+
+// Key for signing Stateless Tokens and deriving Session Secrets.
+// Loaded on Startup
+var statelessTokenKey []byte = nil
+
+// Local copy of the revocation list (see refreshRevocationCache)
+var revocationCache = struct {
+	sync.RWMutex
+	sessions map[string]bool
+	users    map[string]int64
+}{sessions: map[string]bool{}, users: map[string]int64{}}
+
+// Signatures of stateless requests accepted by this server and when
+// they were accepted (see ConsumeStatelessNonce)
+var statelessNonces = struct {
+	sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}{seen: map[string]time.Time{}}
+
+// Control Channel for stopping the revocation list refresh
+var revocationRefreshStop chan bool = nil
+
+// ServerTask Startup Function for Sessions. Loads the Stateless Token
+// Signing Key (creating it if it does not exist) and starts refreshing
+// the revocation list.
+func StartSessions() (func(), error) {
+	var keyTemp string
+	err := redis.MainRedis.Do(radix.Cmd(&keyTemp, "GET", statelessTokenKeyName))
+	if err != nil {
+		return nil, err
+	} else if keyTemp == "" {
+		byteTemp := make([]byte, statelessTokenKeyLen)
+		n, err := rand.Read(byteTemp)
+		if err != nil {
+			return nil, err
+		} else if n < statelessTokenKeyLen {
+			return nil, errors.New("rand.Read did not return full Stateless Token Key!")
+		}
+
+		// Another server may have set a key in the meantime
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SETNX", statelessTokenKeyName, string(byteTemp)))
+		if err != nil {
+			return nil, err
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(&keyTemp, "GET", statelessTokenKeyName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statelessTokenKey = []byte(keyTemp)
+
+	err = refreshRevocationCache()
+	if err != nil {
+		return nil, err
+	}
+
+	revocationRefreshStop = make(chan bool)
+	go revocationRefreshLoop(revocationRefreshStop)
+
+	return cleanUpSessions, nil
+}
+
+// CleanUp Function returned by Startup function. Stops refreshing
+// the revocation list.
+func cleanUpSessions() {
+	log.Println("Cleaning Up Session Logic")
+	revocationRefreshStop <- true
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Stateless Tokens
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Claims carried in a Stateless Token. The token is the base64 JSON of
+// these claims and the base64 HMAC of that JSON separated by a period.
+type StatelessClaims struct {
+	UserID    string
+	SessionID string
+
+	// Unix time (seconds) the token stops being accepted
+	Expiry int64
+
+	// Time (milliseconds since epoch) the token was issued
+	Issued int64
+}
+
+// JSON Response for a Login when Stateless Tokens are used. The secret
+// is used by the client to sign requests. It is never sent back.
+type StatelessSession struct {
+	Token  string
+	Secret string
+}
+
+// Issues a Stateless Token for a user. Nothing is written to the database.
+// Tokens issued in the same millisecond the user's sessions were revoked
+// are stamped after the revocation so they are not revoked themselves.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> StatelessSession :: the token and the base64 secret for the session
+//         -> error :: non-nil if a session ID could not be generated
+func IssueStatelessToken(authID string) (StatelessSession, error) {
+	sessionBytes := make([]byte, sessionIDLen)
+	n, err := rand.Read(sessionBytes)
+	if err != nil {
+		return StatelessSession{}, err
+	} else if n < sessionIDLen {
+		return StatelessSession{}, errors.New("rand.Read did not return full Session ID!")
+	}
+
+	now := time.Now().UTC()
+	claims := StatelessClaims{
+		UserID:    authID,
+		SessionID: base64.RawURLEncoding.EncodeToString(sessionBytes),
+		Expiry:    now.Add(StatelessTokenLifetime).Unix(),
+		Issued:    now.UnixNano() / int64(time.Millisecond),
+	}
+
+	revocationCache.RLock()
+	revokedBefore, exists := revocationCache.users[authID]
+	revocationCache.RUnlock()
+	if exists && claims.Issued <= revokedBefore {
+		claims.Issued = revokedBefore + 1
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return StatelessSession{}, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	token := encodedPayload + "." + base64.RawURLEncoding.EncodeToString(statelessMAC([]byte(encodedPayload)))
+	secret := SessionSecret(claims.SessionID)
+
+	return StatelessSession{
+		Token:  token,
+		Secret: base64.RawStdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+// Parses a Stateless Token and verifies it without using the database.
+// The token must be signed by this server (or one sharing its key), must
+// not be expired, and must not be on the revocation list.
+//
+// token :: the Stateless Token string sent with the request
+//
+// returns -> StatelessClaims :: the claims carried in the token
+//         -> error :: non-nil if the token must be rejected
+func VerifyStatelessToken(token string) (StatelessClaims, error) {
+	claims, err := ParseStatelessToken(token)
+	if err != nil {
+		return claims, err
+	}
+
+	if time.Unix(claims.Expiry, 0).Before(time.Now().UTC()) {
+		return claims, errors.New("Token Is Stale!")
+	} else if IsSessionRevoked(claims) {
+		return claims, errors.New("Token Has Been Revoked!")
+	}
+
+	return claims, nil
+}
+
+// Parses a Stateless Token checking the server signature. The expiry
+// and revocation list are not checked (see VerifyStatelessToken).
+//
+// token :: the Stateless Token string
+func ParseStatelessToken(token string) (StatelessClaims, error) {
+	claims := StatelessClaims{}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, errors.New("Malformed Token!")
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errors.New("Malformed Token!")
+	} else if !hmac.Equal(mac, statelessMAC([]byte(parts[0]))) {
+		return claims, errors.New("Token Signature is Incorrect!")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, errors.New("Malformed Token!")
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return claims, errors.New("Malformed Token!")
+	}
+
+	return claims, nil
+}
+
+// Records a stateless request's signature so the same signed request
+// is only accepted once. The signature covers the command, user,
+// timestamp, and body, so it serves as the request's nonce. Signatures
+// are kept in memory unless ShareStatelessNonces is set. Either way
+// they are forgotten after StatelessNonceLifetime, when the request's
+// timestamp is no longer accepted.
+//
+// sessionID :: Session ID from the Stateless Token claims
+// nonce     :: Signature sent with the request
+//
+// returns -> error :: non-nil if the request was seen already or the
+//                     database could not be written to
+func ConsumeStatelessNonce(sessionID string, nonce string) error {
+	if !ShareStatelessNonces {
+		return consumeLocalNonce(sessionID + ":" + nonce)
+	}
+
+	var stored string
+	err := redis.MainRedis.Do(radix.Cmd(&stored, "SET", StatelessNoncePrefix+sessionID+":"+nonce, "1",
+		"NX", "PX", fmt.Sprintf("%d", int64(StatelessNonceLifetime/time.Millisecond))))
+	if err != nil {
+		return err
+	} else if stored == "" {
+		return errors.New("Request Has Already Been Used!")
+	}
+
+	return nil
+}
+
+// Records a stateless request's signature in memory
+// (see ConsumeStatelessNonce).
+func consumeLocalNonce(key string) error {
+	now := time.Now().UTC()
+
+	statelessNonces.Lock()
+	defer statelessNonces.Unlock()
+
+	if now.Sub(statelessNonces.pruned) >= StatelessNonceLifetime {
+		pruneLocalNonces(now)
+	}
+
+	accepted, exists := statelessNonces.seen[key]
+	if exists && now.Sub(accepted) < StatelessNonceLifetime {
+		return errors.New("Request Has Already Been Used!")
+	}
+
+	statelessNonces.seen[key] = now
+	return nil
+}
+
+// Forgets signatures accepted more than StatelessNonceLifetime ago.
+// statelessNonces must be locked.
+func pruneLocalNonces(now time.Time) {
+	for key, accepted := range statelessNonces.seen {
+		if now.Sub(accepted) >= StatelessNonceLifetime {
+			delete(statelessNonces.seen, key)
+		}
+	}
+
+	statelessNonces.pruned = now
+}
+
+// Derives the secret a client signs requests with for a session.
+// The secret can be derived again from the session ID with the server
+// key, so it never has to be stored.
+//
+// sessionID :: Session ID from the Stateless Token claims
+func SessionSecret(sessionID string) []byte {
+	mac := hmac.New(sha256.New, statelessTokenKey)
+	mac.Write([]byte("session:" + sessionID))
+	return mac.Sum(nil)
+}
+
+// HMAC-SHA256 with the server key over the given payload
+func statelessMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, statelessTokenKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Revocation List
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Returns whether the session is on the local revocation list, either by
+// itself or because the user revoked all sessions after it was issued.
+func IsSessionRevoked(claims StatelessClaims) bool {
+	revocationCache.RLock()
+	defer revocationCache.RUnlock()
+
+	if revocationCache.sessions[claims.SessionID] {
+		return true
+	}
+
+	revokedBefore, exists := revocationCache.users[claims.UserID]
+	return exists && claims.Issued <= revokedBefore
+}
+
+// Adds a single session to the revocation list. It is kept on the list
+// until the token would have expired anyways.
+//
+// claims :: claims of the session to revoke
+func RevokeSession(claims StatelessClaims) error {
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RevokedSessionsSetName,
+		fmt.Sprintf("%d", claims.Expiry), claims.SessionID))
+	if err != nil {
+		return err
+	}
+
+	revocationCache.Lock()
+	revocationCache.sessions[claims.SessionID] = true
+	revocationCache.Unlock()
+
+	return nil
+}
+
+// Adds every session issued until now for a user to the revocation list.
+//
+// authID :: Unique Identifier for a user
+func revokeStatelessSessions(authID string) error {
+	revokedBefore := time.Now().UTC().UnixNano() / int64(time.Millisecond)
+
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZADD", RevokedUsersSetName,
+		fmt.Sprintf("%d", revokedBefore), authID))
+	if err != nil {
+		return err
+	}
+
+	revocationCache.Lock()
+	revocationCache.users[authID] = revokedBefore
+	revocationCache.Unlock()
+
+	return nil
+}
+
+// Reloads the local revocation list from the database. Entries for
+// tokens which would have expired anyways are removed first.
+func refreshRevocationCache() error {
+	now := time.Now().UTC()
+	oldestRelevant := now.Add(-StatelessTokenLifetime).UnixNano() / int64(time.Millisecond)
+
+	err := redis.MainRedis.Do(radix.Cmd(nil, "ZREMRANGEBYSCORE", RevokedSessionsSetName,
+		"-inf", fmt.Sprintf("(%d", now.Unix())))
+	if err != nil {
+		return err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "ZREMRANGEBYSCORE", RevokedUsersSetName,
+		"-inf", fmt.Sprintf("(%d", oldestRelevant)))
+	if err != nil {
+		return err
+	}
+
+	var sessionIDs []string
+	err = redis.MainRedis.Do(radix.Cmd(&sessionIDs, "ZRANGE", RevokedSessionsSetName, "0", "-1"))
+	if err != nil {
+		return err
+	}
+
+	var userScores []string
+	err = redis.MainRedis.Do(radix.Cmd(&userScores, "ZRANGE", RevokedUsersSetName, "0", "-1", "WITHSCORES"))
+	if err != nil {
+		return err
+	}
+
+	sessions := make(map[string]bool, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		sessions[sessionID] = true
+	}
+
+	users := make(map[string]int64, len(userScores)/2)
+	for i := 0; i+1 < len(userScores); i += 2 {
+		revokedBefore, err := strconv.ParseInt(userScores[i+1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		users[userScores[i]] = revokedBefore
+	}
+
+	revocationCache.Lock()
+	revocationCache.sessions = sessions
+	revocationCache.users = users
+	revocationCache.Unlock()
+
+	return nil
+}
+
+// Refreshes the revocation list every RevocationRefreshInterval until
+// signaled otherwise. This should be run with a goroutine.
+//
+// stop :: control channel for cleanup
+func revocationRefreshLoop(stop chan bool) {
+	ticker := time.NewTicker(RevocationRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := refreshRevocationCache()
+			if err != nil {
+				log.Printf("Error Refreshing Revocation List! Err: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestStartSessions(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartSessions,
+		})
+	defer cleanup()
+
+	var keyTemp string
+	err := redis.MainRedis.Do(radix.Cmd(&keyTemp, "GET", statelessTokenKeyName))
+	if err != nil {
+		t.Errorf("Error Reading Redis Stateless Token Key! Err: %v\n", err)
+	}
+
+	if keyTemp == "" || keyTemp != string(statelessTokenKey) {
+		t.Errorf("Stateless Token Key was not loaded from the database!\n")
+	}
+}
+
+func TestConsumeStatelessNonce(t *testing.T) {
+	sessionID := testUserNamePrefix + "NONCE"
+
+	err := ConsumeStatelessNonce(sessionID, "signature")
+	if err != nil {
+		t.Errorf("New Signature was rejected! Err: %v\n", err)
+	}
+
+	err = ConsumeStatelessNonce(sessionID, "signature")
+	if err == nil {
+		t.Errorf("Replayed Signature was accepted!\n")
+	}
+
+	statelessNonces.Lock()
+	pruneLocalNonces(time.Now().UTC().Add(StatelessNonceLifetime))
+	_, exists := statelessNonces.seen[sessionID+":signature"]
+	statelessNonces.Unlock()
+
+	if exists {
+		t.Errorf("Expired Signature was not Pruned!\n")
+	}
+}
+
+func TestStatelessToken(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartSessions,
+		})
+	defer cleanup()
+
+	authID := testUserNamePrefix + "STATELESS"
+
+	session, err := IssueStatelessToken(authID)
+	if err != nil {
+		t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+	}
+
+	t.Run("Verify Issued Token", func(t *testing.T) {
+		claims, err := VerifyStatelessToken(session.Token)
+		if err != nil {
+			t.Fatalf("Issued Token was rejected! Err: %v\n", err)
+		} else if claims.UserID != authID {
+			t.Errorf("Expected UserID %s but got %s\n", authID, claims.UserID)
+		}
+	})
+
+	t.Run("Reject Tampered Token", func(t *testing.T) {
+		parts := strings.Split(session.Token, ".")
+		other, err := IssueStatelessToken(authID + "OTHER")
+		if err != nil {
+			t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+		}
+
+		tampered := strings.Split(other.Token, ".")[0] + "." + parts[1]
+		_, err = VerifyStatelessToken(tampered)
+		if err == nil {
+			t.Errorf("Tampered Token was accepted!\n")
+		}
+	})
+
+	t.Run("Reject Revoked Session", func(t *testing.T) {
+		claims, err := ParseStatelessToken(session.Token)
+		if err != nil {
+			t.Fatalf("Error Parsing Stateless Token! Err: %v\n", err)
+		}
+
+		err = RevokeSession(claims)
+		if err != nil {
+			t.Fatalf("Error Revoking Session! Err: %v\n", err)
+		}
+
+		// Revocation must survive reloading the list from the database
+		err = refreshRevocationCache()
+		if err != nil {
+			t.Fatalf("Error Refreshing Revocation List! Err: %v\n", err)
+		}
+
+		_, err = VerifyStatelessToken(session.Token)
+		if err == nil {
+			t.Errorf("Revoked Token was accepted!\n")
+		}
+	})
+
+	t.Run("Reject Sessions Revoked For User", func(t *testing.T) {
+		userSession, err := IssueStatelessToken(authID + "ALL")
+		if err != nil {
+			t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+		}
+
+		err = revokeStatelessSessions(authID + "ALL")
+		if err != nil {
+			t.Fatalf("Error Revoking Sessions! Err: %v\n", err)
+		}
+
+		_, err = VerifyStatelessToken(userSession.Token)
+		if err == nil {
+			t.Errorf("Token Issued Before Revocation was accepted!\n")
+		}
+
+		// Tokens issued right after revoking (i.e. changing password) are kept
+		newSession, err := IssueStatelessToken(authID + "ALL")
+		if err != nil {
+			t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+		}
+
+		_, err = VerifyStatelessToken(newSession.Token)
+		if err != nil {
+			t.Errorf("Token Issued After Revocation was rejected! Err: %v\n", err)
+		}
+	})
+}
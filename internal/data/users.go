@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
@@ -50,6 +51,17 @@ const AuthIDSetTokenStaleDateTimeField string = "stale"
 // Token Use Counter Key/Field for Redis UserID HashTable
 const AuthIDSetTokenUseCounter string = "tokenUses"
 
+// Token Use Window Key/Field for Redis UserID HashTable. A bitmask of
+// the counters above the use counter that have already been used.
+const AuthIDSetTokenUseWindowField string = "tokenWindow"
+
+// Token Issue DateTime Key/Field for Redis UserID HashTable
+const AuthIDSetTokenIssuedDateTimeField string = "issued"
+
+// Revocation DateTime Key/Field for Redis UserID HashTable. Any
+// token issued at or before this time is rejected.
+const AuthIDSetRevokedBeforeField string = "revokedBefore"
+
 //
 // Register/Login Configurables
 
@@ -72,6 +84,54 @@ const TokenLength int = 256
 // is required
 const TokenStaleTime time.Duration = time.Minute * 5
 
+// Number of counters (starting at the lowest unused counter) a signature
+// may be made with. A value of 1 requires requests to arrive in order.
+// Raising it lets a client keep several requests in flight which may
+// arrive out of order. Each counter may still only be used once.
+// This should be between 1 and 32.
+var TokenCounterWindow int = 1
+
+// Sessions started within this long may delete an account without a
+// password (OIDC and guest users) without sending a new ID Token
+const DeleteAccountFreshSession time.Duration = time.Minute * 5
+
+// Script for atomically consuming a token counter. The token's issue
+// time is compared so a counter can't be consumed for a token that was
+// replaced in the meantime. Returns 1 if the counter was consumed and 0
+// if the counter was already used or is outside of the window.
+//
+// KEYS[1] :: authID HashTable
+// ARGV[1] :: counter to consume
+// ARGV[2] :: window size (see TokenCounterWindow)
+// ARGV[3] :: issue time of the verified token
+var consumeTokenUseScript = radix.NewEvalScript(1, `
+local fields = redis.call('HMGET', KEYS[1], '`+AuthIDSetTokenUseCounter+`', '`+AuthIDSetTokenUseWindowField+`', '`+AuthIDSetTokenIssuedDateTimeField+`')
+if fields[3] ~= ARGV[3] then
+	return 0
+end
+
+local base = tonumber(fields[1]) or 0
+local mask = tonumber(fields[2]) or 0
+local counter = tonumber(ARGV[1])
+if counter < base or counter >= base + tonumber(ARGV[2]) then
+	return 0
+end
+
+local flag = 2 ^ (counter - base)
+if math.floor(mask / flag) % 2 == 1 then
+	return 0
+end
+
+mask = mask + flag
+while mask % 2 == 1 do
+	mask = math.floor(mask / 2)
+	base = base + 1
+end
+
+redis.call('HSET', KEYS[1], '`+AuthIDSetTokenUseCounter+`', base, '`+AuthIDSetTokenUseWindowField+`', mask)
+return 1
+`)
+
 // ServerTask Startup Function for Users. Takes care of initialization.
 // Loads The Password Salt from the Hash if it does not already exist
 func StartUsers() (func(), error) {
@@ -92,6 +152,10 @@ func StartUsers() (func(), error) {
 		passHashSalt = passHashSaltTemp
 	}
 
+	if PasswordResetNotifier == nil {
+		log.Println("Password Reset Is Disabled")
+	}
+
 	return cleanUpUsers, nil
 }
 
@@ -127,7 +191,7 @@ func Register(header policy.RequestHeader, bodyFactories policy.RequestBodyFacto
 		return policy.UnSuccessfulResponse("Bad Arguments!")
 	}
 
-	if rqBody.Username == "" {
+	if rqBody.Username == "" || usernameIsReserved(rqBody.Username) {
 		return policy.RawUnsuccessfulResponse("Illegal Input!")
 	} else if !passwordIsStrong(rqBody.Password) {
 		return policy.RawUnsuccessfulResponse("Weak Password!")
@@ -137,12 +201,20 @@ func Register(header policy.RequestHeader, bodyFactories policy.RequestBodyFacto
 	if err != nil {
 		return policy.RespWithError(err)
 	} else if success {
+		auditRequest(header, AuditRegister, rqBody.Username, AuditSuccess, "")
 		return policy.RawSuccessfulResponse(rqBody.Username)
 	} else {
+		auditRequest(header, AuditRegister, rqBody.Username, AuditFailure, "Username Already Exists")
 		return policy.RawUnsuccessfulResponse("Username Already Exists!")
 	}
 }
 
+// Returns if a username has a prefix reserved for generated usernames
+// (see OIDCUsernamePrefix and GuestUsernamePrefix).
+func usernameIsReserved(username string) bool {
+	return strings.HasPrefix(username, OIDCUsernamePrefix) || strings.HasPrefix(username, GuestUsernamePrefix)
+}
+
 // Takes a string and returns if it would be a strong password.
 // returns -> true if it is strong and false otherwise
 func passwordIsStrong(password string) bool {
@@ -177,14 +249,23 @@ func passwordIsStrong(password string) bool {
 // returns bool :: true/false if the user can be added to the database
 //        error :: if writing to the database failed it will be non-nil
 func CreateAccount(username string, password string) (bool, error) {
+	checksum := sha512.Sum512([]byte(passHashSalt + password))
+	return createAccountWithChecksum(username, hex.EncodeToString(checksum[:]))
+}
+
+// Adds an account to the database with an already hashed password. An
+// empty checksum makes an account which can not login with a password
+// (i.e. accounts from an identity provider, see LoginOIDC).
+//
+// returns bool :: true/false if the user can be added to the database
+//        error :: if writing to the database failed it will be non-nil
+func createAccountWithChecksum(username string, checksumHex string) (bool, error) {
 	if len(username) > redis.RedisKeyMax {
 		return false, errors.New("Attempting To Store Too Large of a Username!")
 	}
 
 	var newID int
 	var success int
-	checksum := sha512.Sum512([]byte(passHashSalt + password))
-	checksumHex := hex.EncodeToString(checksum[:])
 
 	// It should be noted, username could be encoded in any type of way.... it could be a mess of bytes... don't trust it on reads.
 	err := redis.MainRedis.Do(radix.Cmd(&success, "HSETNX", UserPassTable, username, checksumHex))
@@ -211,8 +292,15 @@ func CreateAccount(username string, password string) (bool, error) {
 		AuthIDSetUsernameField, username,
 		AuthIDSetTokenField, "",
 		AuthIDSetTokenStaleDateTimeField, fmt.Sprintf("0"),
-		AuthIDSetTokenUseCounter, "0"))
+		AuthIDSetTokenUseCounter, "0",
+		AuthIDSetTokenUseWindowField, "0",
+		AuthIDSetTokenIssuedDateTimeField, "0",
+		AuthIDSetRevokedBeforeField, "0"))
+	if err != nil {
+		return false, err
+	}
 
+	err = createProfile(fmt.Sprintf("%d", newID))
 	return err == nil, err
 }
 
@@ -251,6 +339,11 @@ func DeleteUser(username string) (bool, error) {
 		return false, errors.New("Could Not Delete User Info!")
 	}
 
+	err = deleteProfile(fmt.Sprintf("%d", authID))
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -268,7 +361,11 @@ type LoginCommandBody struct {
 
 // Login a user to receive a valid token to continue making requests
 // under. The connection must be secure and correctly formatted
-// otherwise an error will be returned.
+// otherwise an error will be returned. When UseStatelessTokens is set
+// the response is a StatelessSession rather than a token.
+//
+// Failed logins are counted for the username and the IP Address. Too
+// many failures slow down and then lock logins (see CheckLoginAllowed).
 func Login(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
 	if !isSecureConnection {
 		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
@@ -281,15 +378,55 @@ func Login(header policy.RequestHeader, bodyFactories policy.RequestBodyFactorie
 		return policy.UnSuccessfulResponse("Bad Arguments!")
 	}
 
+	code, err := CheckLoginAllowed(rqBody.Username, header.RemoteAddr)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if code == policy.CodeAccountLocked {
+		auditRequest(header, AuditLogin, rqBody.Username, AuditFailure, code)
+		return policy.UnSuccessfulResponseWithCode("Account Is Locked!", code)
+	} else if code == policy.CodeLoginBackoff {
+		auditRequest(header, AuditLogin, rqBody.Username, AuditFailure, code)
+		return policy.UnSuccessfulResponseWithCode("Too Many Attempts! Try Again Later!", code)
+	}
+
 	if !IsValidLogin(rqBody.Username, rqBody.Password) {
+		auditRequest(header, AuditLogin, rqBody.Username, AuditFailure, "Wrong Username or Password")
+		err = RecordLoginFailure(rqBody.Username, header.RemoteAddr)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
 		return policy.RawUnsuccessfulResponse("Illegal Input!")
 	}
 
+	err = ClearLoginFailures(rqBody.Username, "")
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
 	authID, err := getAuthID(rqBody.Username)
 	if err != nil {
 		return policy.RespWithError(err)
 	}
 
+	RecordAudit(AuditEvent{Event: AuditLogin, Actor: authID, Target: rqBody.Username, IP: header.RemoteAddr, Outcome: AuditSuccess})
+	return newSessionResponse(authID)
+}
+
+// Starts a new session for a user responding with the token (or the
+// StatelessSession when UseStatelessTokens is set).
+//
+// authID :: Unique Identifier for a user
+func newSessionResponse(authID string) policy.CommandResponse {
+	if UseStatelessTokens {
+		session, err := IssueStatelessToken(authID)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		return policy.CommandResponse{Data: session, Digest: json.Marshal}
+	}
+
 	token, _, err := ConstructNewToken(authID)
 	if err != nil {
 		return policy.RespWithError(err)
@@ -352,10 +489,11 @@ type GetUserCommandBody struct {
 
 // struct for ease of use when marshalling to JSON.
 // Carries the fields used when a user is gathered
-// from cmdGetUser
+// from cmdGetUser (including the public profile fields)
 type UserInfo struct {
 	AuthID   string
 	Username string
+	UserProfile
 }
 
 // Endpoint Returns the User ID associated with the supplied username. Useful for finding friends
@@ -376,8 +514,13 @@ func GetUser(header policy.RequestHeader, bodyFactories policy.RequestBodyFactor
 		return policy.UnSuccessfulResponse("User Does Not Exist!")
 	}
 
+	profile, err := LoadProfile(authID, "", false)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
 	return policy.CommandResponse{
-		Data:   UserInfo{AuthID: authID, Username: rqBody.Username},
+		Data:   UserInfo{AuthID: authID, Username: rqBody.Username, UserProfile: profile},
 		Digest: json.Marshal,
 	}
 }
@@ -388,10 +531,42 @@ func GetUser(header policy.RequestHeader, bodyFactories policy.RequestBodyFactor
 ////
 ///////////////////////////////////////////////////////////////////////////////////////////////////
 
+// Token Data loaded from the database for signature verification
+// (see GetToken)
 type AuthToken struct {
 	Token string
 	Stale time.Time
 	Uses  int
+
+	// Bitmask of counters above Uses which were already used
+	// (see TokenCounterWindow)
+	UsedWindow uint64
+
+	// When the token was constructed and the time the user last
+	// revoked their sessions. A token is revoked if it was issued
+	// at or before RevokedBefore.
+	Issued        time.Time
+	RevokedBefore time.Time
+}
+
+// Returns whether the token was revoked through a logout or
+// an administrator. Revoked tokens must never be accepted.
+func (token AuthToken) IsRevoked() bool {
+	return token.Token == "" || !token.Issued.After(token.RevokedBefore)
+}
+
+// Returns the counters a request may currently be signed with. These are
+// the counters in the window (see TokenCounterWindow) that have not been
+// used yet, in ascending order.
+func (token AuthToken) AvailableCounters() []int {
+	res := make([]int, 0, TokenCounterWindow)
+	for i := 0; i < TokenCounterWindow; i++ {
+		if token.UsedWindow&(1<<uint(i)) == 0 {
+			res = append(res, token.Uses+i)
+		}
+	}
+
+	return res
 }
 
 // Constructs a new token and deadline for the token going stale for
@@ -401,7 +576,8 @@ type AuthToken struct {
 func ConstructNewToken(authID string) ([]byte, time.Time, error) {
 	authIDSet := AuthIDSetPrefix + authID
 	token := make([]byte, TokenLength)
-	staleDateTime := time.Now().UTC().Add(TokenStaleTime)
+	issuedDateTime := time.Now().UTC()
+	staleDateTime := issuedDateTime.Add(TokenStaleTime)
 
 	n, err := rand.Read(token)
 	if err != nil {
@@ -413,7 +589,9 @@ func ConstructNewToken(authID string) ([]byte, time.Time, error) {
 	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", authIDSet,
 		AuthIDSetTokenField, string(token),
 		AuthIDSetTokenStaleDateTimeField, fmt.Sprintf("%d", staleDateTime.Unix()),
-		AuthIDSetTokenUseCounter, "0"))
+		AuthIDSetTokenUseCounter, "0",
+		AuthIDSetTokenUseWindowField, "0",
+		AuthIDSetTokenIssuedDateTimeField, fmt.Sprintf("%d", issuedDateTime.UnixNano())))
 	if err != nil {
 		return nil, staleDateTime, err
 	}
@@ -421,14 +599,25 @@ func ConstructNewToken(authID string) ([]byte, time.Time, error) {
 	return token, staleDateTime, nil
 }
 
+// Loads the token data for a user from the database.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> AuthToken :: the token fields for the user
+//
+//	-> error :: non-nil if the user does not exist or
+//	         the fields could not be read
 func GetToken(authID string) (AuthToken, error) {
 	res := AuthToken{}
 	authIDSet := AuthIDSetPrefix + authID
-	redisReply := make([]string, 3)
+	redisReply := make([]string, 6)
 	err := redis.MainRedis.Do(radix.Cmd(&redisReply, "HMGET", authIDSet,
 		AuthIDSetTokenField,
 		AuthIDSetTokenStaleDateTimeField,
-		AuthIDSetTokenUseCounter))
+		AuthIDSetTokenUseCounter,
+		AuthIDSetTokenIssuedDateTimeField,
+		AuthIDSetRevokedBeforeField,
+		AuthIDSetTokenUseWindowField))
 
 	if err != nil {
 		return res, err
@@ -449,21 +638,550 @@ func GetToken(authID string) (AuthToken, error) {
 		return res, err
 	}
 
+	res.Issued, err = parseUnixNanoField(redisReply[3])
+	if err != nil {
+		return res, err
+	}
+
+	res.RevokedBefore, err = parseUnixNanoField(redisReply[4])
+	if err != nil {
+		return res, err
+	}
+
+	// Accounts created before the window existed have no value
+	if redisReply[5] != "" {
+		res.UsedWindow, err = strconv.ParseUint(redisReply[5], 10, 64)
+		if err != nil {
+			return res, err
+		}
+	}
+
 	return res, nil
 }
 
-func IncrementTokenUses(authID string, newCount int) error {
-	authIDSet := AuthIDSetPrefix + authID
-
-	// TODO Slight Security Vulnerability
-	// There is a race condition in which multiple threads can set/unset a counter depending
-	// on the speed of the verification. This could be solved by making the AuthIDSetTokenUseCounter it's
-	// own key in redis and WATCH MULT EXEC the set. (See Redis Transactions)
-	err := redis.MainRedis.Do(radix.Cmd(nil, "HSET", authIDSet,
-		AuthIDSetTokenUseCounter, fmt.Sprintf("%d", newCount+1)))
+// Atomically marks a counter as used for a verified token. Two requests
+// signed with the same counter can both pass verification, but only one
+// of them can consume the counter. The other receives an error.
+//
+// authID  :: Unique Identifier for a user
+// token   :: the token the signature was verified against (see GetToken)
+// counter :: the counter the signature was made with
+//
+// returns -> error :: non-nil if the counter was already used, is outside
+//                 of the window, or the token changed since it was loaded
+func ConsumeTokenUse(authID string, token AuthToken, counter int) error {
+	var consumed int
+	err := redis.MainRedis.Do(consumeTokenUseScript.Cmd(&consumed, AuthIDSetPrefix+authID,
+		fmt.Sprintf("%d", counter),
+		fmt.Sprintf("%d", TokenCounterWindow),
+		fmt.Sprintf("%d", token.Issued.UnixNano())))
 	if err != nil {
 		return err
+	} else if consumed == 0 {
+		return errors.New("Token Counter Was Already Used!")
 	}
 
 	return nil
 }
+
+// Parses a nanosecond timestamp field from redis. Accounts created
+// before the field existed have no value, which is treated as the
+// epoch.
+func parseUnixNanoField(field string) (time.Time, error) {
+	if field == "" {
+		return time.Unix(0, 0), nil
+	}
+
+	nano, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return time.Unix(0, 0), err
+	}
+
+	return time.Unix(0, nano), nil
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Logout and Token Revocation
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Revoke User Endpoint/Command
+type RevokeUserCommandBody struct {
+	UserID string
+}
+
+// Logout Endpoint. Revokes the session the request was signed with.
+// The user will need to login again to make authenticated requests.
+func Logout(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	if header.Token != "" {
+		claims, err := ParseStatelessToken(header.Token)
+		if err != nil {
+			return policy.UnSuccessfulResponseError(err)
+		} else if claims.UserID != header.UserID {
+			log.Printf("Unauthorized Attempt! User %s tried to revoke a session of %s\n", header.UserID, claims.UserID)
+			return policy.UnSuccessfulResponse("Unauthorized!")
+		}
+
+		err = RevokeSession(claims)
+		if err != nil {
+			return policy.RespWithError(err)
+		}
+
+		auditRequest(header, AuditTokenRevoked, header.UserID, AuditSuccess, "Logout")
+		return policy.SuccessfulResponse()
+	}
+
+	err = RevokeToken(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditTokenRevoked, header.UserID, AuditSuccess, "Logout")
+	return policy.SuccessfulResponse()
+}
+
+// Logout All Endpoint. Revokes every session the user has, including
+// the session the request was signed with.
+func LogoutAll(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	err = RevokeAllSessions(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditTokenRevoked, header.UserID, AuditSuccess, "Logout All")
+	return policy.SuccessfulResponse()
+}
+
+// Revoke User Endpoint. Administrators may revoke every session and API
+// Key for any given user (i.e. when a token is known to be leaked).
+func RevokeUser(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := RevokeUserCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	var exists int
+	err = redis.MainRedis.Do(radix.Cmd(&exists, "EXISTS", AuthIDSetPrefix+rqBody.UserID))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if exists == 0 {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	err = RevokeAllSessions(rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = deleteAPIKeys(rqBody.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	auditRequest(header, AuditAdminAction, rqBody.UserID, AuditSuccess, "Revoke User")
+	return policy.SuccessfulResponse()
+}
+
+// Revokes the current token for a user. The token is cleared from the
+// database so signature verification rejects it on every server.
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be written to
+func RevokeToken(authID string) error {
+	return redis.MainRedis.Do(radix.Cmd(nil, "HSET", AuthIDSetPrefix+authID,
+		AuthIDSetTokenField, "",
+		AuthIDSetTokenStaleDateTimeField, "0",
+		AuthIDSetTokenUseCounter, "0",
+		AuthIDSetTokenUseWindowField, "0"))
+}
+
+// Revokes every session for a user. Any token issued up until now is
+// rejected regardless of how it was issued (including Stateless Tokens).
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be written to
+func RevokeAllSessions(authID string) error {
+	err := RevokeToken(authID)
+	if err != nil {
+		return err
+	}
+
+	err = revokeStatelessSessions(authID)
+	if err != nil {
+		return err
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "HSET", AuthIDSetPrefix+authID,
+		AuthIDSetRevokedBeforeField, fmt.Sprintf("%d", time.Now().UTC().UnixNano())))
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Account Management
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JSON Fields for the Change Password Endpoint/Command
+type ChangePasswordCommandBody struct {
+	Password    string
+	NewPassword string
+}
+
+// JSON Fields for the Change Username Endpoint/Command
+type ChangeUsernameCommandBody struct {
+	Password    string
+	NewUsername string
+}
+
+// JSON Fields for the Delete Account Endpoint/Command
+type DeleteAccountCommandBody struct {
+	// Current Password (for users with a password)
+	Password string
+
+	// New ID Token from the Identity Provider (for OIDC users whose
+	// session is not fresh, see DeleteAccountFreshSession)
+	IDToken string `json:",omitempty"`
+}
+
+// Script for atomically renaming a user. Moves the username in the
+// UserPass and UserAuthID tables and updates the username in the authID
+// HashTable. Returns 1 if renamed and 0 if the new username is taken.
+//
+// KEYS[1] :: UserPass Table
+// KEYS[2] :: UserAuthID Table
+// KEYS[3] :: authID HashTable
+// ARGV[1] :: current username
+// ARGV[2] :: new username
+var renameUserScript = radix.NewEvalScript(3, `
+if redis.call('HEXISTS', KEYS[1], ARGV[2]) == 1 or redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+	return 0
+end
+
+local checksum = redis.call('HGET', KEYS[1], ARGV[1])
+local authID = redis.call('HGET', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[2], checksum)
+redis.call('HSET', KEYS[2], ARGV[2], authID)
+redis.call('HSET', KEYS[3], '`+AuthIDSetUsernameField+`', ARGV[2])
+return 1
+`)
+
+// Change Password Endpoint. Requires the current password. Every other
+// session is revoked and a new session is started for the request's user
+// (the response is the same as Login).
+func ChangePassword(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := ChangePasswordCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	username, err := getUsername(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" || !IsValidLogin(username, rqBody.Password) {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	} else if !passwordIsStrong(rqBody.NewPassword) {
+		return policy.UnSuccessfulResponse("Weak Password!")
+	}
+
+	checksum := sha512.Sum512([]byte(passHashSalt + rqBody.NewPassword))
+	err = redis.MainRedis.Do(radix.Cmd(nil, "HSET", UserPassTable, username, hex.EncodeToString(checksum[:])))
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	err = RevokeAllSessions(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	}
+
+	return newSessionResponse(header.UserID)
+}
+
+// Change Username Endpoint. Requires the current password. The user ID
+// does not change, so sessions, games, and friends are kept.
+func ChangeUsername(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := ChangeUsernameCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	if rqBody.NewUsername == "" || len(rqBody.NewUsername) > redis.RedisKeyMax || usernameIsReserved(rqBody.NewUsername) {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	username, err := getUsername(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" || !IsValidLogin(username, rqBody.Password) {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	var success int
+	err = redis.MainRedis.Do(renameUserScript.Cmd(&success, UserPassTable, UserAuthIDTable, AuthIDSetPrefix+header.UserID,
+		username, rqBody.NewUsername))
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if success == 0 {
+		return policy.UnSuccessfulResponse("Username Already Exists!")
+	}
+
+	return policy.CommandResponse{
+		Data:   UserInfo{AuthID: header.UserID, Username: rqBody.NewUsername},
+		Digest: json.Marshal,
+	}
+}
+
+// Delete Account Endpoint. Requires the current password, or for users
+// without a password (OIDC and guest users) a new ID Token or a fresh
+// session (see reauthenticateForDeletion). The user is removed from
+// every roster and their games are handed over to other players (or
+// deleted if no one can take them) before the account is deleted.
+func DeleteAccount(header policy.RequestHeader, bodyFactories policy.RequestBodyFactories, isSecureConnection bool) policy.CommandResponse {
+	if !isSecureConnection {
+		return policy.RawUnsuccessfulResponse("Unsecure Connection!")
+	}
+
+	err := Authorize(header, bodyFactories)
+	if err != nil {
+		log.Printf("Unauthorized Attempt! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Unauthorized!")
+	}
+
+	rqBody := DeleteAccountCommandBody{}
+	err = bodyFactories.ParseFactory(&rqBody)
+	if err != nil {
+		log.Printf("Bad Argument! Error: %v\n", err)
+		return policy.UnSuccessfulResponse("Bad Arguments!")
+	}
+
+	username, err := getUsername(header.UserID)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if username == "" {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	reauthenticated, err := reauthenticateForDeletion(header, username, rqBody)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !reauthenticated {
+		return policy.UnSuccessfulResponse("Illegal Input!")
+	}
+
+	success, err := removeAccount(header.UserID, username)
+	if err != nil {
+		return policy.RespWithError(err)
+	} else if !success {
+		return policy.UnSuccessfulResponse("User Does Not Exist!")
+	}
+
+	return policy.SuccessfulResponse()
+}
+
+// Checks the owner of an account is deleting it. Users with a password
+// must send it. Users without one (OIDC and guest users) must send a new
+// ID Token for their subject or sign the request with a session started
+// within DeleteAccountFreshSession.
+//
+// header   :: header of the Delete Account request
+// username :: the user's current username
+// rqBody   :: body of the Delete Account request
+//
+// returns -> bool  :: true if the account may be deleted
+//         -> error :: non-nil if the database could not be read
+func reauthenticateForDeletion(header policy.RequestHeader, username string, rqBody DeleteAccountCommandBody) (bool, error) {
+	var checksum string
+	err := redis.MainRedis.Do(radix.Cmd(&checksum, "HGET", UserPassTable, username))
+	if err != nil {
+		return false, err
+	} else if checksum != "" {
+		return IsValidLogin(username, rqBody.Password), nil
+	}
+
+	if rqBody.IDToken != "" {
+		claims, err := VerifyIDToken(rqBody.IDToken)
+		if err != nil {
+			log.Printf("Invalid ID Token! Error: %v\n", err)
+			return false, nil
+		}
+
+		var authID string
+		err = redis.MainRedis.Do(radix.Cmd(&authID, "HGET", OIDCSubjectTable, claims.Issuer+"|"+claims.Subject))
+		return authID == header.UserID, err
+	}
+
+	issued, err := sessionIssuedAt(header)
+	if err != nil {
+		return false, err
+	}
+
+	return time.Now().UTC().Sub(issued) <= DeleteAccountFreshSession, nil
+}
+
+// Returns when the session a request was signed under was started. The
+// zero time is returned if the Stateless Token is not the user's.
+func sessionIssuedAt(header policy.RequestHeader) (time.Time, error) {
+	if header.Token != "" {
+		claims, err := ParseStatelessToken(header.Token)
+		if err != nil {
+			return time.Time{}, err
+		} else if claims.UserID != header.UserID {
+			return time.Time{}, nil
+		}
+
+		return time.Unix(0, claims.Issued*int64(time.Millisecond)), nil
+	}
+
+	var issuedStr string
+	err := redis.MainRedis.Do(radix.Cmd(&issuedStr, "HGET", AuthIDSetPrefix+header.UserID, AuthIDSetTokenIssuedDateTimeField))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	issued, _ := strconv.ParseInt(issuedStr, 10, 64)
+	return time.Unix(0, issued), nil
+}
+
+// Removes a user from every game and friend list, revokes their
+// sessions, and deletes the account.
+//
+// authID   :: Unique Identifier for a user
+// username :: the user's current username
+//
+// returns -> bool  :: false if the user did not exist
+//         -> error :: non-nil if the database could not be read/written
+func removeAccount(authID string, username string) (bool, error) {
+	err := removeUserFromGames(authID)
+	if err != nil {
+		return false, err
+	}
+
+	err = deleteFriends(authID)
+	if err != nil {
+		return false, err
+	}
+
+	// Stateless Sessions are not removed with the user's data
+	err = revokeStatelessSessions(authID)
+	if err != nil {
+		return false, err
+	}
+
+	err = deleteAPIKeys(authID)
+	if err != nil {
+		return false, err
+	}
+
+	err = removeUserFromMatchmaking(authID)
+	if err != nil {
+		return false, err
+	}
+
+	err = deleteRatings(authID)
+	if err != nil {
+		return false, err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", MatchHistoryPrefix+authID))
+	if err != nil {
+		return false, err
+	}
+
+	err = removeUserFromLeaderboards(authID)
+	if err != nil {
+		return false, err
+	}
+
+	return DeleteUser(username)
+}
+
+// Removes a user from every game. Each game the user owns is handed
+// over to another player in its roster or deleted if there is no one
+// to take it (see handOverGame).
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be read/written
+func removeUserFromGames(authID string) error {
+	gameIDs, err := OwnedGames(authID)
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		newOwner, err := handOverGame(gameID, authID)
+		if err != nil {
+			return err
+		} else if newOwner == "" {
+			err = deleteGame(gameID, authID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "DEL", OwnerGamesSetPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	return removeUserFromRosters(authID)
+}
+
+// Returns the username for a user ID or "" if the user does not exist.
+//
+// authID :: Unique Identifier for a user
+func getUsername(authID string) (string, error) {
+	var username string
+	err := redis.MainRedis.Do(radix.Cmd(&username, "HGET", AuthIDSetPrefix+authID, AuthIDSetUsernameField))
+	return username, err
+}
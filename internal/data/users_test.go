@@ -293,3 +293,214 @@ func getUserTestHelper(t *testing.T, username string) string {
 
 	return authResponse.AuthID
 }
+
+func TestLogoutUser(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartSessions,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "LOGOUT"
+	adminUsername := testUserNamePrefix + "LOGOUTADMIN"
+	password := "SomeP@ssword123"
+	DeleteUser(validUsername)
+	DeleteUser(adminUsername)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, adminUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	adminID := getUserTestHelper(t, adminUsername)
+
+	// Logout revokes the current token
+	loginUserSuccess(t, validUsername, password)
+	tokenRevokedTestHelper(t, authID, false)
+	commandTestHelper(t, authID, policy.CmdLogout, Logout, nil)
+	tokenRevokedTestHelper(t, authID, true)
+
+	// Logout All revokes the current token
+	loginUserSuccess(t, validUsername, password)
+	tokenRevokedTestHelper(t, authID, false)
+	commandTestHelper(t, authID, policy.CmdLogoutAll, LogoutAll, nil)
+	tokenRevokedTestHelper(t, authID, true)
+
+	// Logging in after a revocation gives a good token
+	loginUserSuccess(t, validUsername, password)
+	tokenRevokedTestHelper(t, authID, false)
+
+	// Users cannot logout sessions of other users
+	session, err := IssueStatelessToken(authID)
+	if err != nil {
+		t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+	}
+
+	req, err := policy.RequestWithUserForTesting(adminID, false, policy.CmdLogout, nil)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+	req.Header.Token = session.Token
+
+	var success policy.SuccessfulData
+	response := Logout(req.Header, req.BodyFactories, req.IsSecureConnection)
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &success)
+
+	claims, err := ParseStatelessToken(session.Token)
+	if err != nil {
+		t.Fatalf("Error Parsing Stateless Token! Err: %v\n", err)
+	} else if success.Successful || IsSessionRevoked(claims) {
+		t.Errorf("User Revoked the Session of another User!\n")
+	}
+
+	// Non-administrators cannot revoke other users
+	success = commandTestHelper(t, adminID, policy.CmdRevokeUser, RevokeUser, RevokeUserCommandBody{UserID: authID})
+	if success.Successful {
+		t.Errorf("Non-Administrator Revoked a User!\n")
+	}
+	tokenRevokedTestHelper(t, authID, false)
+
+	// Administrators can revoke other users
+	err = SetRole(adminID, RoleAdmin)
+	if err != nil {
+		t.Errorf("Error Adding Administrator! Err: %v\n", err)
+	}
+
+	success = commandTestHelper(t, adminID, policy.CmdRevokeUser, RevokeUser, RevokeUserCommandBody{UserID: authID})
+	if !success.Successful {
+		t.Errorf("Administrator Could Not Revoke a User! Err: %s\n", success.Err)
+	}
+	tokenRevokedTestHelper(t, authID, true)
+
+	err = SetRole(adminID, RolePlayer)
+	if err != nil {
+		t.Errorf("Error Removing Administrator! Err: %v\n", err)
+	}
+
+	DeleteUser(validUsername)
+	DeleteUser(adminUsername)
+}
+
+func tokenRevokedTestHelper(t *testing.T, authID string, expected bool) {
+	token, err := GetToken(authID)
+	if err != nil {
+		t.Fatalf("Error Getting Token! Err: %v\n", err)
+	} else if token.IsRevoked() != expected {
+		t.Errorf("Token Revocation was %t instead of %t!\n", token.IsRevoked(), expected)
+	}
+}
+
+func TestAccountManagement(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			StartUsers,
+			StartRoomsSystem,
+		})
+	defer cleanup()
+
+	validUsername := testUserNamePrefix + "ACCOUNT"
+	newUsername := testUserNamePrefix + "ACCOUNTRENAMED"
+	otherUsername := testUserNamePrefix + "ACCOUNTOTHER"
+	password := "SomeP@ssword123"
+	newPassword := "SomeOtherP@ssword123"
+	DeleteUser(validUsername)
+	DeleteUser(newUsername)
+	DeleteUser(otherUsername)
+
+	createUserSuccess(t, validUsername, password)
+	createUserSuccess(t, otherUsername, password)
+	authID := getUserTestHelper(t, validUsername)
+	otherID := getUserTestHelper(t, otherUsername)
+
+	// Change Password
+	loginUserSuccess(t, validUsername, password)
+	success := commandTestHelper(t, authID, policy.CmdChangePass, ChangePassword, ChangePasswordCommandBody{Password: "NOTtheRightPassword", NewPassword: newPassword})
+	if success.Successful {
+		t.Errorf("Password Changed With the Wrong Password!\n")
+	}
+
+	success = commandTestHelper(t, authID, policy.CmdChangePass, ChangePassword, ChangePasswordCommandBody{Password: password, NewPassword: newPassword})
+	if success.Err != "" {
+		t.Errorf("Could Not Change Password! Err: %s\n", success.Err)
+	}
+	tokenRevokedTestHelper(t, authID, false)
+	loginUserError(t, validUsername, password)
+	loginUserSuccess(t, validUsername, newPassword)
+
+	// Change Username
+	success = commandTestHelper(t, authID, policy.CmdChangeName, ChangeUsername, ChangeUsernameCommandBody{Password: newPassword, NewUsername: otherUsername})
+	if success.Successful || success.Err == "" {
+		t.Errorf("Username Changed to an Existing Username!\n")
+	}
+
+	success = commandTestHelper(t, authID, policy.CmdChangeName, ChangeUsername, ChangeUsernameCommandBody{Password: newPassword, NewUsername: newUsername})
+	if success.Err != "" {
+		t.Errorf("Could Not Change Username! Err: %s\n", success.Err)
+	} else if getUserTestHelper(t, newUsername) != authID {
+		t.Errorf("New Username Does Not Map to the Same User!\n")
+	}
+	loginUserError(t, validUsername, newPassword)
+	loginUserSuccess(t, newUsername, newPassword)
+
+	// Delete Account hands the game over to another player
+	metadata, _ := createGameForUser(authID, t)
+	joinGameForUser(otherID, metadata.Id, t)
+
+	success = commandTestHelper(t, authID, policy.CmdDeleteAcct, DeleteAccount, DeleteAccountCommandBody{Password: newPassword})
+	if !success.Successful {
+		t.Errorf("Could Not Delete Account! Err: %s\n", success.Err)
+	}
+
+	isInGame, err := IsUserInGame(authID, metadata.Id)
+	if err != nil {
+		t.Errorf("Error Checking Roster! Err: %v\n", err)
+	} else if isInGame {
+		t.Errorf("Deleted User is still in a Roster!\n")
+	}
+
+	var isOwner bool
+	err = redis.MainRedis.Do(radix.Cmd(&isOwner, "SISMEMBER", OwnerGamesSetPrefix+otherID, metadata.Id))
+	if err != nil {
+		t.Errorf("Error Reading Owner! Err: %v\n", err)
+	} else if !isOwner {
+		t.Errorf("Game %s was not handed over!\n", metadata.Id)
+	}
+
+	var exists int
+	err = redis.MainRedis.Do(radix.Cmd(&exists, "EXISTS", AuthIDSetPrefix+authID))
+	if err != nil {
+		t.Errorf("Error Reading User! Err: %v\n", err)
+	} else if exists != 0 {
+		t.Errorf("Deleted User still exists!\n")
+	}
+
+	// Accounts without a password need a fresh session
+	guestID, _, err := createGuest()
+	if err != nil {
+		t.Fatalf("Error Creating Guest! Err: %v\n", err)
+	}
+
+	success = commandTestHelper(t, guestID, policy.CmdDeleteAcct, DeleteAccount, DeleteAccountCommandBody{})
+	if success.Successful {
+		t.Errorf("Guest was Deleted Without a Fresh Session!\n")
+	}
+
+	_, _, err = ConstructNewToken(guestID)
+	if err != nil {
+		t.Fatalf("Error Starting Guest Session! Err: %v\n", err)
+	}
+
+	success = commandTestHelper(t, guestID, policy.CmdDeleteAcct, DeleteAccount, DeleteAccountCommandBody{})
+	if !success.Successful {
+		t.Errorf("Could Not Delete Guest With a Fresh Session! Err: %s\n", success.Err)
+	}
+	redis.MainRedis.Do(radix.Cmd(nil, "ZREM", GuestSetName, guestID))
+
+	deleteGamesForUsers([]string{otherID}, t)
+	DeleteUser(otherUsername)
+}
@@ -0,0 +1,322 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/event"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/mediocregopher/radix/v3"
+)
+
+//// Configurables
+
+//
+// Waitlists
+
+// Redis Sorted Set Key Prefix for a game's waitlist. Concatenated with a
+// GameID. Scores are when each user started waiting (milliseconds since
+// epoch) so the earliest user is seated first.
+const WaitlistPrefix string = "waitlist:"
+
+// Redis Field/Key for Game Metadata Waitlist ("1" if the game has a
+// waitlist)
+const MetadataSetWaitlist string = "waitlist"
+
+// Redis Set Key Prefix for the Games a user is waiting for.
+// Concatenated with a UserID. The reverse of the waitlists
+// (see WaitlistPrefix)
+const PlayerWaitlistsSetPrefix string = "playerWaitlists:"
+
+// Maximum Number of users waiting for a game
+const MaxWaitlist int = 100
+
+// Script for atomically adding a user to a roster or, when the roster is
+// full, to the end of the game's waitlist. Users already in the roster
+// are not added twice and users already waiting keep their place. Seated
+// users leave the waitlist. Returns the number of players afterwards (-1
+// if the user was not seated) and the user's place in the waitlist
+// (starting at 1, 0 if the user is not waiting).
+//
+// KEYS[1] :: roster Set
+// KEYS[2] :: metadata HashTable
+// KEYS[3] :: waitlist Sorted Set
+// KEYS[4] :: user's waitlists Set
+// ARGV[1] :: authID
+// ARGV[2] :: gameID
+// ARGV[3] :: "1" if the user may wait
+// ARGV[4] :: current time (milliseconds since epoch)
+// ARGV[5] :: maximum number of users waiting
+var joinRosterScript = radix.NewEvalScript(4, `
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return {redis.call('SCARD', KEYS[1]), 0}
+end
+
+local max = tonumber(redis.call('HGET', KEYS[2], '`+MetadataSetMaxPlayers+`') or '0') or 0
+local count = redis.call('SCARD', KEYS[1])
+if max <= 0 or count < max then
+	redis.call('SADD', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[3], ARGV[1])
+	redis.call('SREM', KEYS[4], ARGV[2])
+	return {count + 1, 0}
+end
+
+if ARGV[3] ~= '1' or redis.call('HGET', KEYS[2], '`+MetadataSetWaitlist+`') ~= '1' then
+	return {-1, 0}
+end
+
+if not redis.call('ZSCORE', KEYS[3], ARGV[1]) then
+	if redis.call('ZCARD', KEYS[3]) >= tonumber(ARGV[5]) then
+		return {-1, 0}
+	end
+
+	redis.call('ZADD', KEYS[3], ARGV[4], ARGV[1])
+	redis.call('SADD', KEYS[4], ARGV[2])
+end
+
+return {-1, redis.call('ZRANK', KEYS[3], ARGV[1]) + 1}
+`)
+
+// Script for atomically seating users from a waitlist while there are
+// open seats. Returns the users that were seated.
+//
+// KEYS[1] :: roster Set
+// KEYS[2] :: metadata HashTable
+// KEYS[3] :: waitlist Sorted Set
+var seatWaitlistScript = radix.NewEvalScript(3, `
+local max = tonumber(redis.call('HGET', KEYS[2], '`+MetadataSetMaxPlayers+`') or '0') or 0
+local seated = {}
+
+while max <= 0 or redis.call('SCARD', KEYS[1]) < max do
+	local waiting = redis.call('ZRANGE', KEYS[3], 0, 0)
+	if #waiting == 0 then
+		break
+	end
+
+	redis.call('ZREM', KEYS[3], waiting[1])
+	redis.call('SADD', KEYS[1], waiting[1])
+	table.insert(seated, waiting[1])
+end
+
+return seated
+`)
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Roster Capacity
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Adds a user to a game's roster unless it is full
+//
+// authID :: Unique Identifier for a user
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> int   :: number of players in the game or -1 if it is full
+//         -> error :: non-nil if the database could not be read/written
+func joinRoster(authID string, gameID string) (int, error) {
+	numPlayers, _, err := joinRosterOrWaitlist(authID, gameID, false)
+	return numPlayers, err
+}
+
+// Adds a user to a game's roster or, when it is full and the game has a
+// waitlist, to the end of its waitlist. Both are decided at once (see
+// joinRosterScript) so a seat opening in between is never missed.
+//
+// authID  :: Unique Identifier for a user
+// gameID  :: Unique Identifier for game in string form
+// mayWait :: whether the user may be added to the waitlist
+//
+// returns -> int   :: number of players in the game or -1 if the user
+//                     was not seated
+//         -> int   :: place in the waitlist (starting at 1) or 0 if the
+//                     user is not waiting
+//         -> error :: non-nil if the database could not be read/written
+func joinRosterOrWaitlist(authID string, gameID string, mayWait bool) (int, int, error) {
+	wait := "0"
+	if mayWait {
+		wait = "1"
+	}
+
+	now := fmt.Sprintf("%d", time.Now().UTC().UnixNano()/int64(time.Millisecond))
+
+	var result []int
+	err := redis.MainRedis.Do(joinRosterScript.Cmd(&result, PlayerSetPrefix+gameID, MetadataSetPrefix+gameID,
+		WaitlistPrefix+gameID, PlayerWaitlistsSetPrefix+authID, authID, gameID, wait, now, fmt.Sprintf("%d", MaxWaitlist)))
+	if err != nil {
+		return 0, 0, err
+	} else if len(result) != 2 {
+		return 0, 0, errors.New("Unexpected Reply Joining Roster!")
+	}
+
+	numPlayers, position := result[0], result[1]
+	if numPlayers < 0 {
+		return numPlayers, position, nil
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", PlayerGamesSetPrefix+authID, gameID))
+	if err != nil {
+		return numPlayers, 0, err
+	}
+
+	return numPlayers, 0, recordRosterJoin(gameID, authID)
+}
+
+// Returns a user's place in a game's waitlist (starting at 1) or 0 if
+// they are not waiting
+func waitlistPosition(authID string, gameID string) (int, error) {
+	var rank string
+	err := redis.MainRedis.Do(radix.Cmd(&rank, "ZRANK", WaitlistPrefix+gameID, authID))
+	if err != nil || rank == "" {
+		return 0, err
+	}
+
+	position, err := strconv.Atoi(rank)
+	return position + 1, err
+}
+
+// Removes a user from a game's waitlist
+//
+// returns -> bool  :: true if the user was waiting
+//         -> error :: non-nil if the database could not be written to
+func leaveWaitlist(authID string, gameID string) (bool, error) {
+	var removed int
+	err := redis.MainRedis.Do(radix.Cmd(&removed, "ZREM", WaitlistPrefix+gameID, authID))
+	if err != nil {
+		return false, err
+	}
+
+	return removed > 0, redis.MainRedis.Do(radix.Cmd(nil, "SREM", PlayerWaitlistsSetPrefix+authID, gameID))
+}
+
+// Removes a user from a game's roster. Waiting users take their seat.
+//
+// authID :: Unique Identifier for a user
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> bool  :: true if the user was on the roster
+//         -> error :: non-nil if the database could not be read/written
+func leaveRoster(authID string, gameID string) (bool, error) {
+	var removed int
+	err := redis.MainRedis.Do(radix.Cmd(&removed, "SREM", PlayerSetPrefix+gameID, authID))
+	if err != nil || removed == 0 {
+		return false, err
+	}
+
+	err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", PlayerGamesSetPrefix+authID, gameID))
+	if err != nil {
+		return true, err
+	}
+
+	err = forgetRosterMember(gameID, authID)
+	if err != nil {
+		return true, err
+	}
+
+	return true, refillRoster(gameID)
+}
+
+// Seats users from a game's waitlist while it has open seats. Called
+// after a player leaves.
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> []string :: the users that were seated
+//         -> error    :: non-nil if the database could not be read/written
+func seatWaitlist(gameID string) ([]string, error) {
+	var seated []string
+	err := redis.MainRedis.Do(seatWaitlistScript.Cmd(&seated, PlayerSetPrefix+gameID, MetadataSetPrefix+gameID, WaitlistPrefix+gameID))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authID := range seated {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SADD", PlayerGamesSetPrefix+authID, gameID))
+		if err != nil {
+			return seated, err
+		}
+
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", PlayerWaitlistsSetPrefix+authID, gameID))
+		if err != nil {
+			return seated, err
+		}
+
+		err = recordRosterJoin(gameID, authID)
+		if err != nil {
+			return seated, err
+		}
+	}
+
+	return seated, nil
+}
+
+// Seats users from a game's waitlist after a player was removed. Games
+// left without players are submitted for a health check.
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> error :: non-nil if the database could not be read/written
+func refillRoster(gameID string) error {
+	_, err := seatWaitlist(gameID)
+	if err != nil {
+		return err
+	}
+
+	var numPlayers int
+	err = redis.MainRedis.Do(radix.Cmd(&numPlayers, "SCARD", PlayerSetPrefix+gameID))
+	if err != nil {
+		return err
+	} else if numPlayers == 0 {
+		event.SubmitGameForHealthCheck(gameID)
+	}
+
+	return nil
+}
+
+// Removes a user from every waitlist. The waitlists are found with the
+// user's waitlists Set (see PlayerWaitlistsSetPrefix).
+//
+// authID :: Unique Identifier for a user
+//
+// returns -> error :: non-nil if the database could not be read/written
+func removeUserFromWaitlists(authID string) error {
+	var gameIDs []string
+	err := redis.MainRedis.Do(radix.Cmd(&gameIDs, "SMEMBERS", PlayerWaitlistsSetPrefix+authID))
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "ZREM", WaitlistPrefix+gameID, authID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", PlayerWaitlistsSetPrefix+authID))
+}
+
+// Removes everyone from a game's waitlist. Used when the game is
+// deleted.
+//
+// gameID :: Unique Identifier for game in string form
+//
+// returns -> error :: non-nil if the database could not be read/written
+func clearWaitlist(gameID string) error {
+	var waiting []string
+	err := redis.MainRedis.Do(radix.Cmd(&waiting, "ZRANGE", WaitlistPrefix+gameID, "0", "-1"))
+	if err != nil {
+		return err
+	}
+
+	for _, authID := range waiting {
+		err = redis.MainRedis.Do(radix.Cmd(nil, "SREM", PlayerWaitlistsSetPrefix+authID, gameID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return redis.MainRedis.Do(radix.Cmd(nil, "DEL", WaitlistPrefix+gameID))
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/startup"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/zeromq"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestRosterCapacity(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-600"
+	deleteGamesForUsers([]string{ownerID}, t)
+
+	metadata := createGameWithArgsForUser(t, ownerID, CreateGameCommandBody{MaxPlayers: 3})
+	if metadata.Id == "" || metadata.MaxPlayers != 3 {
+		t.Fatalf("Game was not created! Metadata: %v\n", metadata)
+	}
+
+	// Join all at once to check seats are not given out twice
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(playerID string) {
+			defer wg.Done()
+			joinGameWithArgsForUser(t, playerID, SelectGameArgs{GameID: metadata.Id})
+		}(fmt.Sprintf("-6%02d", 10+i))
+	}
+	wg.Wait()
+
+	var numPlayers int
+	err := redis.MainRedis.Do(radix.Cmd(&numPlayers, "SCARD", PlayerSetPrefix+metadata.Id))
+	if err != nil {
+		t.Fatalf("Error Reading Roster! Err: %v\n", err)
+	} else if numPlayers != 3 {
+		t.Errorf("Roster has %d players instead of 3!\n", numPlayers)
+	}
+
+	welcome := joinGameWithArgsForUser(t, "-650", SelectGameArgs{GameID: metadata.Id})
+	if welcome.Id != "" || welcome.WaitlistPosition != 0 {
+		t.Errorf("Joined a Full Game without a Waitlist! Response: %v\n", welcome)
+	}
+
+	deleteGamesForUsers([]string{ownerID}, t)
+}
+
+func TestWaitlist(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			zeromq.StartZeroMqComms,
+		})
+	defer cleanup()
+
+	ownerID := "-700"
+	playerIDs := []string{"-701", "-702", "-703"}
+	deleteGamesForUsers([]string{ownerID}, t)
+
+	metadata := createGameWithArgsForUser(t, ownerID, CreateGameCommandBody{MaxPlayers: 2, Waitlist: true})
+	if metadata.Id == "" || !metadata.Waitlist {
+		t.Fatalf("Game was not created! Metadata: %v\n", metadata)
+	}
+
+	welcome := joinGameWithArgsForUser(t, playerIDs[0], SelectGameArgs{GameID: metadata.Id})
+	if welcome.Id != metadata.Id || welcome.WaitlistPosition != 0 {
+		t.Errorf("Could not Join a Game with an open Seat! Response: %v\n", welcome)
+	}
+
+	for i, playerID := range playerIDs[1:] {
+		welcome = joinGameWithArgsForUser(t, playerID, SelectGameArgs{GameID: metadata.Id})
+		if welcome.WaitlistPosition != i+1 {
+			t.Errorf("Expected Waitlist Position %d but got %d!\n", i+1, welcome.WaitlistPosition)
+		}
+	}
+
+	t.Run("Leaving Seats The Next Player", func(t *testing.T) {
+		success, jsonResponse := leaveGameForUser(playerIDs[0], metadata.Id, t)
+		if !success.Successful {
+			t.Fatalf("Could not Leave Game! Response: %s\n", jsonResponse)
+		}
+
+		isInGame, err := IsUserInGame(playerIDs[1], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Roster! Err: %v\n", err)
+		} else if !isInGame {
+			t.Errorf("Next Player was not Seated!\n")
+		}
+
+		position, err := waitlistPosition(playerIDs[2], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Waitlist! Err: %v\n", err)
+		} else if position != 1 {
+			t.Errorf("Waitlist did not move up! Position: %d\n", position)
+		}
+	})
+
+	t.Run("Waiting Players Can Leave", func(t *testing.T) {
+		success, jsonResponse := leaveGameForUser(playerIDs[2], metadata.Id, t)
+		if !success.Successful {
+			t.Fatalf("Could not Leave Waitlist! Response: %s\n", jsonResponse)
+		}
+
+		position, err := waitlistPosition(playerIDs[2], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Waitlist! Err: %v\n", err)
+		} else if position != 0 {
+			t.Errorf("Player is still Waiting! Position: %d\n", position)
+		}
+	})
+
+	t.Run("Removed Users Leave Every Waitlist", func(t *testing.T) {
+		welcome := joinGameWithArgsForUser(t, playerIDs[2], SelectGameArgs{GameID: metadata.Id})
+		if welcome.WaitlistPosition != 1 {
+			t.Fatalf("Expected Waitlist Position 1 but got %d!\n", welcome.WaitlistPosition)
+		}
+
+		var isIndexed bool
+		err := redis.MainRedis.Do(radix.Cmd(&isIndexed, "SISMEMBER", PlayerWaitlistsSetPrefix+playerIDs[2], metadata.Id))
+		if err != nil {
+			t.Fatalf("Error Reading Waitlists! Err: %v\n", err)
+		} else if !isIndexed {
+			t.Errorf("Waitlist is missing from the User's Waitlists!\n")
+		}
+
+		err = removeUserFromWaitlists(playerIDs[2])
+		if err != nil {
+			t.Fatalf("Error Removing User from Waitlists! Err: %v\n", err)
+		}
+
+		position, err := waitlistPosition(playerIDs[2], metadata.Id)
+		if err != nil {
+			t.Fatalf("Error Reading Waitlist! Err: %v\n", err)
+		} else if position != 0 {
+			t.Errorf("Removed User is still Waiting! Position: %d\n", position)
+		}
+	})
+
+	deleteGamesForUsers([]string{ownerID}, t)
+}
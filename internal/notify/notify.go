@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+//// Global Variables | Singletons
+
+// Lock for appending to LogNotifier files so messages are not interleaved
+var logFileLock sync.Mutex
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+////
+//// Notifiers
+////
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Message sent to a user outside of the game (i.e. a password reset code)
+type Message struct {
+	Username string
+
+	// Email Address of the user (may be empty)
+	Address string
+
+	Subject string
+	Body    string
+}
+
+// Delivers Messages to users. Implementations should be safe to use
+// from multiple goroutines.
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// Notifier which writes Messages to the log or appends them to a file.
+// Meant for development and testing, since anyone who can read the log
+// can read the Messages.
+type LogNotifier struct {
+	// File to append Messages to. Messages are logged if empty
+	Path string
+}
+
+// Notifier which emails Messages over SMTP. Messages to users without
+// an Address fail.
+type SMTPNotifier struct {
+	// Address of the SMTP Server (host:port)
+	Addr string
+
+	// Address Messages are sent from
+	From string
+
+	// Authentication for the SMTP Server (may be nil)
+	Auth smtp.Auth
+}
+
+// Logs the Message or appends it to the LogNotifier's file.
+func (notifier LogNotifier) Notify(msg Message) error {
+	formatted := fmt.Sprintf("To: %s <%s>\nSubject: %s\n\n%s\n\n", msg.Username, msg.Address, msg.Subject, msg.Body)
+
+	if notifier.Path == "" {
+		log.Printf("Notification!\n%s", formatted)
+		return nil
+	}
+
+	logFileLock.Lock()
+	defer logFileLock.Unlock()
+
+	file, err := os.OpenFile(notifier.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(formatted)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Emails the Message to its Address.
+func (notifier SMTPNotifier) Notify(msg Message) error {
+	if msg.Address == "" {
+		return errors.New("User has no Address to Notify: " + msg.Username)
+	} else if strings.ContainsAny(msg.Address+msg.Subject, "\r\n") {
+		return errors.New("Message Headers can not have line breaks!")
+	}
+
+	var builder strings.Builder
+	builder.WriteString("From: " + notifier.From + "\r\n")
+	builder.WriteString("To: " + msg.Address + "\r\n")
+	builder.WriteString("Subject: " + msg.Subject + "\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	builder.WriteString("\r\n")
+
+	return smtp.SendMail(notifier.Addr, notifier.Auth, notifier.From, []string{msg.Address}, []byte(builder.String()))
+}
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogNotifier(t *testing.T) {
+	file, err := ioutil.TempFile("", "notify*.log")
+	if err != nil {
+		t.Fatalf("Error Creating File! Err: %v\n", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	notifier := LogNotifier{Path: file.Name()}
+	msgs := []Message{
+		{Username: "first", Subject: "Hello", Body: "First Body"},
+		{Username: "second", Address: "second@example.com", Subject: "Hello", Body: "Second Body"},
+	}
+
+	for _, msg := range msgs {
+		err = notifier.Notify(msg)
+		if err != nil {
+			t.Errorf("Error Notifying! Err: %v\n", err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("Error Reading File! Err: %v\n", err)
+	}
+
+	for _, msg := range msgs {
+		if !strings.Contains(string(contents), msg.Body) {
+			t.Errorf("Message Was Not Written! Expected: %s\n", msg.Body)
+		}
+	}
+
+	err = LogNotifier{}.Notify(msgs[0])
+	if err != nil {
+		t.Errorf("Error Logging Notification! Err: %v\n", err)
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error Starting SMTP Stand-In! Err: %v\n", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go smtpStandInTestHelper(listener, received)
+
+	notifier := SMTPNotifier{Addr: listener.Addr().String(), From: "laplace@example.com"}
+
+	t.Run("Users Need An Address", func(t *testing.T) {
+		err := notifier.Notify(Message{Username: "noAddress", Subject: "Hello", Body: "Body"})
+		if err == nil {
+			t.Errorf("Notified a User Without an Address!\n")
+		}
+	})
+
+	t.Run("Headers Can Not Be Injected", func(t *testing.T) {
+		err := notifier.Notify(Message{Username: "user", Address: "user@example.com", Subject: "Hello\r\nBcc: evil@example.com", Body: "Body"})
+		if err == nil {
+			t.Errorf("Sent a Message with a Line Break in the Subject!\n")
+		}
+	})
+
+	t.Run("Messages Are Sent", func(t *testing.T) {
+		err := notifier.Notify(Message{Username: "user", Address: "user@example.com", Subject: "Hello", Body: "The Code is 1234"})
+		if err != nil {
+			t.Fatalf("Error Sending Message! Err: %v\n", err)
+		}
+
+		data := <-received
+		if !strings.Contains(data, "To: user@example.com") || !strings.Contains(data, "The Code is 1234") {
+			t.Errorf("Stand-In Received the Wrong Message! Data: %s\n", data)
+		}
+	})
+}
+
+// Accepts one connection and speaks just enough SMTP to receive a
+// message. The message data is sent to the channel.
+func smtpStandInTestHelper(listener net.Listener, received chan string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost Stand-In")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 End with <CRLF>.<CRLF>")
+
+			var builder strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil || dataLine == ".\r\n" {
+					break
+				}
+				builder.WriteString(dataLine)
+			}
+
+			received <- builder.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -7,7 +7,11 @@
 package policy
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"time"
 )
@@ -18,9 +22,39 @@ import (
 // for x time on a game then it should be deleted
 const StaleGameDuration time.Duration = time.Duration(time.Minute * 5)
 
-// UserID For Request Made From the Server rather than
-// from a user. Useful for papertrails.
-const SuperUserID string = "-1"
+// UserID of the Service Identity. Requests made from the server rather
+// than from a user use this identity. Useful for papertrails. Its
+// privileges come from its role like any other user.
+const ServiceUserID string = "-1"
+
+// Number of random bytes in the Service Identity's credential
+const ServiceCredentialBytes int = 32
+
+//
+// Response Codes (see SuccessfulData.Code)
+
+// Too many failed logins. Logins are rejected until the lockout ends
+// or an administrator unlocks the account.
+const CodeAccountLocked string = "ACCOUNT_LOCKED"
+
+// Failed logins are being slowed down. The login should be tried
+// again later.
+const CodeLoginBackoff string = "LOGIN_BACKOFF"
+
+// The owner kicked the player from the game. The player must join the
+// game again before taking actions.
+const CodeKickedFromGame string = "KICKED_FROM_GAME"
+
+// The owner banned the user from joining the game
+const CodeBannedFromGame string = "BANNED_FROM_GAME"
+
+//// Global Variables | Singletons
+
+// Credential the Service Identity signs its requests with (see
+// RequestWithServiceUser). It is made when the server starts and never
+// leaves the process, so no one outside the server can make requests
+// as the Service Identity.
+var serviceCredential string = newServiceCredential()
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////
 ////
@@ -45,6 +79,16 @@ type RequestAttachment struct {
 
 	// Request Signature for Authentication
 	Sig string
+
+	// Signing Scheme the Signature was made with
+	// (0 or missing is the legacy scheme)
+	SigVersion int `asn1:"optional"`
+
+	// Unix Time (seconds) the request was signed at
+	Timestamp int64 `asn1:"optional"`
+
+	// Stateless Session Token (only for the stateless signing scheme)
+	Token string `asn1:"optional,utf8"`
 }
 
 //// Private Request Definitions For Parsing
@@ -62,6 +106,18 @@ type RequestHeader struct {
 
 	// Request Signature for Authenticated Requests
 	Sig string
+
+	// Signing Scheme the Signature was made with
+	SigVersion int
+
+	// Unix Time (seconds) the request was signed at
+	Timestamp int64
+
+	// Stateless Session Token the request was signed under
+	Token string
+
+	// IP Address the request came from (empty for internal requests)
+	RemoteAddr string
 }
 
 // The Request Body Represents the data for the command. Since
@@ -70,12 +126,17 @@ type RequestHeader struct {
 // the required data. (I use Factories here but they are more
 // defered Transformation/Map Functions).
 type RequestBodyFactories struct {
-	// Interface Parameter should be a pointer
+	// Interface Parameter should be a pointer. Returns ErrEmptyBody if
+	// the request has no body.
 	ParseFactory func(ptr interface{}) error
 
 	SigVerify func(userID string, userSig string) error
 }
 
+// Error returned by ParseFactory when the request has no body.
+// Endpoints with optional arguments may use their defaults instead.
+var ErrEmptyBody error = errors.New("Request Body Is Empty!")
+
 // Required Fields for any connection
 // see calculateResponse
 // or see switchOnCommand
@@ -129,6 +190,10 @@ type CommandResponse struct {
 type SuccessfulData struct {
 	Successful bool
 	Err        string
+
+	// Machine readable reason for an unsuccessful response
+	// (i.e. CodeAccountLocked)
+	Code string `json:",omitempty"`
 }
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////
@@ -150,8 +215,12 @@ const (
 	//                   //=====================
 	//                     TLS Commands
 	//                   //=====================
-	CmdRegister //       //0000_0000_0000_0001
-	CmdLogin    //       //0000_0000_0000_0010
+	CmdRegister   //     //0000_0000_0000_0001
+	CmdLogin      //     //0000_0000_0000_0010
+	CmdLoginOIDC  //     //0000_0000_0000_0011
+	CmdLoginGuest //     //0000_0000_0000_0100
+	CmdForgotPass //     //0000_0000_0000_0101
+	CmdResetPass  //     //0000_0000_0000_0110
 	//                   //=====================
 	//                     Through Commands (To Third Party)
 	//                   //=====================
@@ -160,7 +229,19 @@ const (
 	//                   //=====================
 	//                     User Management Commands
 	//                   //=====================
-	CmdGetUser //        //0000_0001_0000_0000
+	CmdGetUser    //     //0000_0001_0000_0000
+	CmdLogout     //     //0000_0001_0000_0001
+	CmdLogoutAll  //     //0000_0001_0000_0010
+	CmdChangePass //     //0000_0001_0000_0011
+	CmdChangeName //     //0000_0001_0000_0100
+	CmdDeleteAcct //     //0000_0001_0000_0101
+	CmdGetProfile //     //0000_0001_0000_0110
+	CmdSetProfile //     //0000_0001_0000_0111
+	CmdUpgrade    //     //0000_0001_0000_1000
+	CmdSetEmail   //     //0000_0001_0000_1001
+	CmdKeyCreate  //     //0000_0001_0000_1010
+	CmdKeyList    //     //0000_0001_0000_1011
+	CmdKeyRevoke  //     //0000_0001_0000_1100
 	//                   //=====================
 	//                     Game Management Commands
 	//                   //=====================
@@ -168,6 +249,39 @@ const (
 	CmdGameJoin   //     //0000_0010_0000_0001
 	CmdGameLeave  //     //0000_0010_0000_0010
 	CmdGameDelete //     //0000_0010_0000_0011
+	CmdGameList   //     //0000_0010_0000_0100
+	CmdGameConfig //     //0000_0010_0000_0101
+	CmdGameInvite //     //0000_0010_0000_0110
+	CmdGameResult //     //0000_0010_0000_0111
+	CmdGameLog    //     //0000_0010_0000_1000
+	CmdGameOwner  //     //0000_0010_0000_1001
+	CmdGameKick   //     //0000_0010_0000_1010
+	CmdGameBan    //     //0000_0010_0000_1011
+	//                   //=====================
+	//                     Social Commands
+	//                   //=====================
+	CmdFriendRequest //  //0000_0011_0000_0000
+	CmdFriendAccept  //  //0000_0011_0000_0001
+	CmdFriendDecline //  //0000_0011_0000_0010
+	CmdFriendRemove  //  //0000_0011_0000_0011
+	CmdFriendList    //  //0000_0011_0000_0100
+	//                   //=====================
+	//                     Administration Commands
+	//                   //=====================
+	CmdRevokeUser //     //0000_0100_0000_0000
+	CmdSetRole    //     //0000_0100_0000_0001
+	CmdUnlockUser //     //0000_0100_0000_0010
+	CmdAuditQuery //     //0000_0100_0000_0011
+	CmdGameQuota  //     //0000_0100_0000_0100
+	//                   //=====================
+	//                     Matchmaking Commands
+	//                   //=====================
+	CmdMatchQueue  //    //0000_0101_0000_0000
+	CmdMatchCancel //    //0000_0101_0000_0001
+	CmdMatchStatus //    //0000_0101_0000_0010
+	CmdRatingGet   //    //0000_0101_0000_0011
+	CmdRatingLog   //    //0000_0101_0000_0100
+	CmdLeaderboard //    //0000_0101_0000_0101
 	//                   //=====================
 )
 
@@ -195,7 +309,7 @@ func RespWithError(err error) CommandResponse {
 //   (something that contains a string to be sent to the user)
 func UnSuccessfulResponseError(err error) CommandResponse {
 	return CommandResponse{
-		Data:   SuccessfulData{false, err.Error()},
+		Data:   SuccessfulData{Successful: false, Err: err.Error()},
 		Digest: json.Marshal,
 	}
 }
@@ -208,7 +322,19 @@ func UnSuccessfulResponseError(err error) CommandResponse {
 // err : a string to be sent to the user
 func UnSuccessfulResponse(err string) CommandResponse {
 	return CommandResponse{
-		Data:   SuccessfulData{false, err},
+		Data:   SuccessfulData{Successful: false, Err: err},
+		Digest: json.Marshal,
+	}
+}
+
+// Reject the request with a code the client can act on as well as
+// the message (see SuccessfulData.Code)
+//
+// err  : a string to be sent to the user
+// code : the reason for the rejection (i.e. CodeAccountLocked)
+func UnSuccessfulResponseWithCode(err string, code string) CommandResponse {
+	return CommandResponse{
+		Data:   SuccessfulData{Successful: false, Err: err, Code: code},
 		Digest: json.Marshal,
 	}
 }
@@ -263,18 +389,19 @@ func RawUnsuccessfulResponse(err string) CommandResponse {
 ////
 ///////////////////////////////////////////////////////////////////////////////////////////////////
 
-// Function to construct internal request with from a "Super User". Useful for
-// using endpoints with a specific papertrail. Super Users have a lot
-// more privaledges in checks than other users, but they can do this because
-// they skip the parsing steps. SigVerify automatically returns a nil error.
-// This could(/should) never happen from outside the system.
+// Function to construct internal request with from the Service Identity
+// (see ServiceUserID). Useful for using endpoints with a specific papertrail.
+// The request skips the parsing steps and is signed with the Service
+// Identity's credential, which SigVerify checks (see
+// VerifyServiceCredential). Privileges still come from the Service
+// Identity's role. This could(/should) never happen from outside the system.
 //
 // isTask :: true if task is making the request and false otherwise
 //      (old parameter and not necessary)
 // cmd    :: Selected Endpoint to be requested
 // args   :: struct to use for args for endpoint
 // returns -> InternalUserRequest struct for making the request.
-func RequestWithSuperUser(isTask bool, cmd ClientCmd, args interface{}) (InternalUserRequest, error) {
+func RequestWithServiceUser(isTask bool, cmd ClientCmd, args interface{}) (InternalUserRequest, error) {
 	// shortcut bodyfactory using reflection
 	bodyFactories := RequestBodyFactories{
 		ParseFactory: func(ptr interface{}) error {
@@ -283,17 +410,43 @@ func RequestWithSuperUser(isTask bool, cmd ClientCmd, args interface{}) (Interna
 			ptrValue.Elem().Set(argsVal)
 			return nil
 		},
-		SigVerify: func(userID string, userSig string) error {
-			return nil
-		},
+		SigVerify: VerifyServiceCredential,
 	}
 
 	// Body Start is only used in main.go and is not necessary for a manual request command
-	header := RequestHeader{Command: cmd, UserID: SuperUserID}
+	header := RequestHeader{Command: cmd, UserID: ServiceUserID, Sig: serviceCredential}
 
 	return InternalUserRequest{Header: header, BodyFactories: bodyFactories, IsSecureConnection: true}, nil
 }
 
+// Verifies a request was made by the Service Identity (see
+// RequestWithServiceUser).
+//
+// userID  :: String User ID of the request
+// userSig :: Signature of the request
+//
+// returns -> error :: non-nil if the request was not signed with the
+//                     Service Identity's credential
+func VerifyServiceCredential(userID string, userSig string) error {
+	if userID != ServiceUserID || subtle.ConstantTimeCompare([]byte(userSig), []byte(serviceCredential)) != 1 {
+		return errors.New("Request Was Not Made By The Service Identity")
+	}
+
+	return nil
+}
+
+// Returns a new random credential for the Service Identity. Panics if
+// there is no randomness since the server should not start without it.
+func newServiceCredential() string {
+	credential := make([]byte, ServiceCredentialBytes)
+	_, err := rand.Read(credential)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(credential)
+}
+
 // Function to construct internal request with from a given user.
 // Used for unit testing
 //
@@ -17,6 +17,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
@@ -93,7 +94,12 @@ var listenerThreadPool util.ThreadPool = util.NewThreadPool(4)
 
 // ServerTask Startup Function for Conneciton Listening. Takes care of initialization.
 func StartListener() (func(), error) {
-	err := listenerThreadPool.SubmitFuncUnsafe(startTCPListening)
+	err := registerAPIKeyCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	err = listenerThreadPool.SubmitFuncUnsafe(startTCPListening)
 	if err != nil {
 		return nil, err
 	}
@@ -152,17 +158,57 @@ func calculateResponse(requestHeader policy.RequestHeader, bodyFactories policy.
 //
 // This should never change during runtime!
 var postOnlyCmdMap map[policy.ClientCmd]bool = map[policy.ClientCmd]bool{
-	policy.CmdError:      false,
-	policy.CmdEmpty:      false,
-	policy.CmdRegister:   true,
-	policy.CmdLogin:      true,
-	policy.CmdAction:     true,
-	policy.CmdObserve:    true,
-	policy.CmdGetUser:    true,
-	policy.CmdGameCreate: true,
-	policy.CmdGameJoin:   true,
-	policy.CmdGameLeave:  true,
-	policy.CmdGameDelete: true,
+	policy.CmdError:         false,
+	policy.CmdEmpty:         false,
+	policy.CmdRegister:      true,
+	policy.CmdLogin:         true,
+	policy.CmdLoginOIDC:     true,
+	policy.CmdLoginGuest:    true,
+	policy.CmdForgotPass:    true,
+	policy.CmdResetPass:     true,
+	policy.CmdAction:        true,
+	policy.CmdObserve:       true,
+	policy.CmdGetUser:       true,
+	policy.CmdLogout:        true,
+	policy.CmdLogoutAll:     true,
+	policy.CmdChangePass:    true,
+	policy.CmdChangeName:    true,
+	policy.CmdDeleteAcct:    true,
+	policy.CmdGetProfile:    true,
+	policy.CmdSetProfile:    true,
+	policy.CmdUpgrade:       true,
+	policy.CmdSetEmail:      true,
+	policy.CmdKeyCreate:     true,
+	policy.CmdKeyList:       true,
+	policy.CmdKeyRevoke:     true,
+	policy.CmdGameCreate:    true,
+	policy.CmdGameJoin:      true,
+	policy.CmdGameLeave:     true,
+	policy.CmdGameDelete:    true,
+	policy.CmdGameList:      true,
+	policy.CmdGameConfig:    true,
+	policy.CmdGameInvite:    true,
+	policy.CmdGameResult:    true,
+	policy.CmdGameLog:       true,
+	policy.CmdGameOwner:     true,
+	policy.CmdGameKick:      true,
+	policy.CmdGameBan:       true,
+	policy.CmdFriendRequest: true,
+	policy.CmdFriendAccept:  true,
+	policy.CmdFriendDecline: true,
+	policy.CmdFriendRemove:  true,
+	policy.CmdFriendList:    true,
+	policy.CmdRevokeUser:    true,
+	policy.CmdSetRole:       true,
+	policy.CmdUnlockUser:    true,
+	policy.CmdAuditQuery:    true,
+	policy.CmdGameQuota:     true,
+	policy.CmdMatchQueue:    true,
+	policy.CmdMatchCancel:   true,
+	policy.CmdMatchStatus:   true,
+	policy.CmdRatingGet:     true,
+	policy.CmdRatingLog:     true,
+	policy.CmdLeaderboard:   true,
 }
 
 // Attaches Path Handlers for HTTP Web Server. Uses Paths to
@@ -174,13 +220,53 @@ func startHTTPListening(ctx context.Context) {
 	http.HandleFunc("/error/", getHttpHandler(policy.CmdError))
 	http.HandleFunc("/register/", getHttpHandler(policy.CmdRegister))
 	http.HandleFunc("/login/", getHttpHandler(policy.CmdLogin))
+	http.HandleFunc("/login/oidc/", getHttpHandler(policy.CmdLoginOIDC))
+	http.HandleFunc("/login/guest/", getHttpHandler(policy.CmdLoginGuest))
+	http.HandleFunc("/password/forgot/", getHttpHandler(policy.CmdForgotPass))
+	http.HandleFunc("/password/reset/", getHttpHandler(policy.CmdResetPass))
 	http.HandleFunc("/action/", getHttpHandler(policy.CmdAction))
 	http.HandleFunc("/observe/", getHttpHandler(policy.CmdObserve))
 	http.HandleFunc("/user/", getHttpHandler(policy.CmdGetUser))
+	http.HandleFunc("/logout/", getHttpHandler(policy.CmdLogout))
+	http.HandleFunc("/logout/all/", getHttpHandler(policy.CmdLogoutAll))
+	http.HandleFunc("/user/password/", getHttpHandler(policy.CmdChangePass))
+	http.HandleFunc("/user/username/", getHttpHandler(policy.CmdChangeName))
+	http.HandleFunc("/user/delete/", getHttpHandler(policy.CmdDeleteAcct))
+	http.HandleFunc("/user/profile/", getHttpHandler(policy.CmdGetProfile))
+	http.HandleFunc("/user/profile/update/", getHttpHandler(policy.CmdSetProfile))
+	http.HandleFunc("/user/upgrade/", getHttpHandler(policy.CmdUpgrade))
+	http.HandleFunc("/user/email/", getHttpHandler(policy.CmdSetEmail))
+	http.HandleFunc("/user/keys/", getHttpHandler(policy.CmdKeyList))
+	http.HandleFunc("/user/keys/create/", getHttpHandler(policy.CmdKeyCreate))
+	http.HandleFunc("/user/keys/revoke/", getHttpHandler(policy.CmdKeyRevoke))
 	http.HandleFunc("/game/create/", getHttpHandler(policy.CmdGameCreate))
 	http.HandleFunc("/game/join/", getHttpHandler(policy.CmdGameJoin))
 	http.HandleFunc("/game/leave/", getHttpHandler(policy.CmdGameLeave))
 	http.HandleFunc("/game/delete/", getHttpHandler(policy.CmdGameDelete))
+	http.HandleFunc("/game/list/", getHttpHandler(policy.CmdGameList))
+	http.HandleFunc("/game/settings/", getHttpHandler(policy.CmdGameConfig))
+	http.HandleFunc("/game/invite/", getHttpHandler(policy.CmdGameInvite))
+	http.HandleFunc("/game/result/", getHttpHandler(policy.CmdGameResult))
+	http.HandleFunc("/game/history/", getHttpHandler(policy.CmdGameLog))
+	http.HandleFunc("/game/owner/", getHttpHandler(policy.CmdGameOwner))
+	http.HandleFunc("/game/kick/", getHttpHandler(policy.CmdGameKick))
+	http.HandleFunc("/game/ban/", getHttpHandler(policy.CmdGameBan))
+	http.HandleFunc("/friends/", getHttpHandler(policy.CmdFriendList))
+	http.HandleFunc("/friends/request/", getHttpHandler(policy.CmdFriendRequest))
+	http.HandleFunc("/friends/accept/", getHttpHandler(policy.CmdFriendAccept))
+	http.HandleFunc("/friends/decline/", getHttpHandler(policy.CmdFriendDecline))
+	http.HandleFunc("/friends/remove/", getHttpHandler(policy.CmdFriendRemove))
+	http.HandleFunc("/admin/revoke/", getHttpHandler(policy.CmdRevokeUser))
+	http.HandleFunc("/admin/role/", getHttpHandler(policy.CmdSetRole))
+	http.HandleFunc("/admin/unlock/", getHttpHandler(policy.CmdUnlockUser))
+	http.HandleFunc("/admin/audit/", getHttpHandler(policy.CmdAuditQuery))
+	http.HandleFunc("/admin/quota/", getHttpHandler(policy.CmdGameQuota))
+	http.HandleFunc("/match/queue/", getHttpHandler(policy.CmdMatchQueue))
+	http.HandleFunc("/match/cancel/", getHttpHandler(policy.CmdMatchCancel))
+	http.HandleFunc("/match/status/", getHttpHandler(policy.CmdMatchStatus))
+	http.HandleFunc("/rating/", getHttpHandler(policy.CmdRatingGet))
+	http.HandleFunc("/rating/history/", getHttpHandler(policy.CmdRatingLog))
+	http.HandleFunc("/leaderboard/", getHttpHandler(policy.CmdLeaderboard))
 
 	http.HandleFunc("*", http.NotFound)
 
@@ -224,17 +310,25 @@ func handleHttp(clientCmd policy.ClientCmd, writer http.ResponseWriter, req *htt
 	requestAttachment := parseHeaderInfo(req, &body)
 
 	requestHeader := policy.RequestHeader{
-		Command: clientCmd,
-		UserID:  requestAttachment.UserID,
-		Sig:     requestAttachment.Sig,
+		Command:    clientCmd,
+		UserID:     requestAttachment.UserID,
+		Sig:        requestAttachment.Sig,
+		SigVersion: requestAttachment.SigVersion,
+		Timestamp:  requestAttachment.Timestamp,
+		Token:      requestAttachment.Token,
+		RemoteAddr: remoteIP(req.RemoteAddr),
 	}
 
 	bodyFactories := policy.RequestBodyFactories{
 		ParseFactory: func(ptr interface{}) error {
+			if len(body) == 0 {
+				return policy.ErrEmptyBody
+			}
+
 			return json.Unmarshal(body, ptr)
 		},
 		SigVerify: func(userID string, userSig string) error {
-			return SigVerification(userID, userSig, &body)
+			return SigVerification(signedHeader(requestHeader, userID, userSig), &body)
 		},
 	}
 
@@ -288,6 +382,19 @@ func parseHeaderInfo(req *http.Request, body *[]byte) policy.RequestAttachment {
 	possibleUserIDs[0] = req.Header.Get("laplace-user-id")
 	possibleSigs[0] = req.Header.Get("laplace-signature")
 
+	// Signing Scheme Fields are only read from the header or the body
+	sigVersion, err := strconv.Atoi(req.Header.Get("laplace-signature-version"))
+	if err == nil {
+		requestAttachment.SigVersion = sigVersion
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get("laplace-timestamp"), 10, 64)
+	if err == nil {
+		requestAttachment.Timestamp = timestamp
+	}
+
+	requestAttachment.Token = req.Header.Get("laplace-token")
+
 	// Check Cookies
 	userIDCookie, cookieErr := req.Cookie("laplaceUserId")
 	if cookieErr != nil {
@@ -311,6 +418,18 @@ func parseHeaderInfo(req *http.Request, body *[]byte) policy.RequestAttachment {
 		if err == nil {
 			possibleUserIDs[2] = userSigObj.UserID
 			possibleSigs[2] = userSigObj.Sig
+
+			if requestAttachment.SigVersion == 0 {
+				requestAttachment.SigVersion = userSigObj.SigVersion
+			}
+
+			if requestAttachment.Timestamp == 0 {
+				requestAttachment.Timestamp = userSigObj.Timestamp
+			}
+
+			if requestAttachment.Token == "" {
+				requestAttachment.Token = userSigObj.Token
+			}
 		} else {
 			log.Println("Illformatted JSON sent to HTTP Header")
 		}
@@ -501,6 +620,8 @@ func readAndRespondTCP(clientConn TCPClientConn, dataIn *[]byte) bool {
 		return false
 	}
 
+	header.RemoteAddr = remoteIP(clientConn.conn.RemoteAddr().String())
+
 	response, err := calculateResponse(header, bodyFactory, clientConn.isSecured)
 
 	// Tokenize and Encrypt Response Here
@@ -575,6 +696,9 @@ func generateRequestFromSocket(length int, data *[]byte, prefix TCPRequestPrefix
 	}
 	header.Sig = attachment.Sig
 	header.UserID = attachment.UserID
+	header.SigVersion = attachment.SigVersion
+	header.Timestamp = attachment.Timestamp
+	header.Token = attachment.Token
 
 	bodyPayload := bodyAttachmentAndPayload[bodyStart:]
 	factories.ParseFactory = func(ptr interface{}) error {
@@ -582,7 +706,7 @@ func generateRequestFromSocket(length int, data *[]byte, prefix TCPRequestPrefix
 	}
 
 	factories.SigVerify = func(userID string, userSig string) error {
-		return SigVerification(userID, userSig, &bodyPayload)
+		return SigVerification(signedHeader(header, userID, userSig), &bodyPayload)
 	}
 
 	return header, factories, nil
@@ -622,3 +746,16 @@ func writeTCPResponse(clientConn TCPClientConn, response *[]byte, length int) er
 
 	return nil
 }
+
+// Returns the IP Address of a "host:port" remote address. The address
+// is returned as is if it has no port.
+//
+// addr :: remote address of the connection (i.e. net.Conn.RemoteAddr)
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -17,16 +17,56 @@ import (
 //
 // This should never change during runtime!
 var commandMap map[int64]policy.ClientCmd = map[int64]policy.ClientCmd{
-	0000 + 0: policy.CmdEmpty,
-	0000 + 1: policy.CmdRegister,
-	0000 + 2: policy.CmdLogin,
-	1<<4 + 0: policy.CmdAction,
-	1<<4 + 1: policy.CmdObserve,
-	1<<8 + 0: policy.CmdGetUser,
-	1<<9 + 0: policy.CmdGameCreate,
-	1<<9 + 1: policy.CmdGameJoin,
-	1<<9 + 2: policy.CmdGameLeave,
-	1<<9 + 3: policy.CmdGameDelete,
+	0000 + 0:  policy.CmdEmpty,
+	0000 + 1:  policy.CmdRegister,
+	0000 + 2:  policy.CmdLogin,
+	0000 + 3:  policy.CmdLoginOIDC,
+	0000 + 4:  policy.CmdLoginGuest,
+	0000 + 5:  policy.CmdForgotPass,
+	0000 + 6:  policy.CmdResetPass,
+	1<<4 + 0:  policy.CmdAction,
+	1<<4 + 1:  policy.CmdObserve,
+	1<<8 + 0:  policy.CmdGetUser,
+	1<<8 + 1:  policy.CmdLogout,
+	1<<8 + 2:  policy.CmdLogoutAll,
+	1<<8 + 3:  policy.CmdChangePass,
+	1<<8 + 4:  policy.CmdChangeName,
+	1<<8 + 5:  policy.CmdDeleteAcct,
+	1<<8 + 6:  policy.CmdGetProfile,
+	1<<8 + 7:  policy.CmdSetProfile,
+	1<<8 + 8:  policy.CmdUpgrade,
+	1<<8 + 9:  policy.CmdSetEmail,
+	1<<8 + 10: policy.CmdKeyCreate,
+	1<<8 + 11: policy.CmdKeyList,
+	1<<8 + 12: policy.CmdKeyRevoke,
+	1<<9 + 0:  policy.CmdGameCreate,
+	1<<9 + 1:  policy.CmdGameJoin,
+	1<<9 + 2:  policy.CmdGameLeave,
+	1<<9 + 3:  policy.CmdGameDelete,
+	1<<9 + 4:  policy.CmdGameList,
+	1<<9 + 5:  policy.CmdGameConfig,
+	1<<9 + 6:  policy.CmdGameInvite,
+	1<<9 + 7:  policy.CmdGameResult,
+	1<<9 + 8:  policy.CmdGameLog,
+	1<<9 + 9:  policy.CmdGameOwner,
+	1<<9 + 10: policy.CmdGameKick,
+	1<<9 + 11: policy.CmdGameBan,
+	3<<8 + 0:  policy.CmdFriendRequest,
+	3<<8 + 1:  policy.CmdFriendAccept,
+	3<<8 + 2:  policy.CmdFriendDecline,
+	3<<8 + 3:  policy.CmdFriendRemove,
+	3<<8 + 4:  policy.CmdFriendList,
+	1<<10 + 0: policy.CmdRevokeUser,
+	1<<10 + 1: policy.CmdSetRole,
+	1<<10 + 2: policy.CmdUnlockUser,
+	1<<10 + 3: policy.CmdAuditQuery,
+	1<<10 + 4: policy.CmdGameQuota,
+	5<<8 + 0:  policy.CmdMatchQueue,
+	5<<8 + 1:  policy.CmdMatchCancel,
+	5<<8 + 2:  policy.CmdMatchStatus,
+	5<<8 + 3:  policy.CmdRatingGet,
+	5<<8 + 4:  policy.CmdRatingLog,
+	5<<8 + 5:  policy.CmdLeaderboard,
 }
 
 //// Functions!
@@ -48,6 +88,18 @@ func ParseCommand(mostSignificant byte, leastSignificant byte) (policy.ClientCmd
 	return result, nil
 }
 
+// Command Code returns the two byte code for a command. This is the
+// inverse of ParseCommand and is used when signing requests.
+func CommandCode(cmd policy.ClientCmd) (int64, error) {
+	for code, mapped := range commandMap {
+		if mapped == cmd {
+			return code, nil
+		}
+	}
+
+	return 0, errors.New("Invalid Command")
+}
+
 // Creates the Authentication Structure based on the structure
 // and byte slice provided to the function
 //
@@ -70,7 +122,12 @@ func parseRequestAttachment(isJSON bool, data *[]byte) (policy.RequestAttachment
 //     (see json.Unmarshall in golang docs)
 // prefix :: Structure Metadata
 // body   :: byte slice of request data
+// returns policy.ErrEmptyBody if there is no request data
 func parseBody(ptr interface{}, prefix TCPRequestPrefix, body *[]byte) error {
+	if len(*body) == 0 {
+		return policy.ErrEmptyBody
+	}
+
 	var err error
 	if prefix.IsBase64Enc {
 		*body, err = util.Base64Decode(body)
@@ -102,6 +159,9 @@ func switchOnCommand(header policy.RequestHeader, bodyFactories policy.RequestBo
 
 	if NeedsSecurity(header.Command) && !isSecureConnection {
 		return util.NewErrorJson("Unsecure Connection!"), nil
+	} else if header.SigVersion == SigVersionAPIKey && !isSecureConnection {
+		// API Keys are sent in plain text
+		return util.NewErrorJson("Unsecure Connection!"), nil
 	}
 
 	switch header.Command {
@@ -119,6 +179,22 @@ func switchOnCommand(header policy.RequestHeader, bodyFactories policy.RequestBo
 		res = data.Login(header, bodyFactories, isSecureConnection)
 		break
 
+	case policy.CmdLoginOIDC:
+		res = data.LoginOIDC(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdLoginGuest:
+		res = data.LoginGuest(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdForgotPass:
+		res = data.ForgotPassword(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdResetPass:
+		res = data.ResetPassword(header, bodyFactories, isSecureConnection)
+		break
+
 	// cmdStartTLS is an exception to this switch statement. (It occurs in main.go)
 
 	// Through Commands (To Third Party)
@@ -135,6 +211,54 @@ func switchOnCommand(header policy.RequestHeader, bodyFactories policy.RequestBo
 		res = data.GetUser(header, bodyFactories, isSecureConnection)
 		break
 
+	case policy.CmdLogout:
+		res = data.Logout(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdLogoutAll:
+		res = data.LogoutAll(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdChangePass:
+		res = data.ChangePassword(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdChangeName:
+		res = data.ChangeUsername(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdDeleteAcct:
+		res = data.DeleteAccount(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGetProfile:
+		res = data.GetProfile(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdSetProfile:
+		res = data.UpdateProfile(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdUpgrade:
+		res = data.UpgradeGuest(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdSetEmail:
+		res = data.SetEmail(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdKeyCreate:
+		res = data.CreateAPIKey(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdKeyList:
+		res = data.ListAPIKeys(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdKeyRevoke:
+		res = data.RevokeAPIKey(header, bodyFactories, isSecureConnection)
+		break
+
 	// Game Management Commands
 	case policy.CmdGameCreate:
 		res = data.CreateGame(header, bodyFactories, isSecureConnection)
@@ -148,6 +272,109 @@ func switchOnCommand(header policy.RequestHeader, bodyFactories policy.RequestBo
 		res = data.LeaveGame(header, bodyFactories, isSecureConnection)
 		break
 
+	case policy.CmdGameDelete:
+		res = data.DeleteGame(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameList:
+		res = data.ListGames(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameConfig:
+		res = data.UpdateGameSettings(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameInvite:
+		res = data.CreateGameInvite(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameResult:
+		res = data.GetGameResult(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameLog:
+		res = data.GetMatchHistory(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameOwner:
+		res = data.TransferGame(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameKick:
+		res = data.KickPlayer(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameBan:
+		res = data.BanPlayer(header, bodyFactories, isSecureConnection)
+		break
+
+	// Social Commands
+	case policy.CmdFriendRequest:
+		res = data.SendFriendRequest(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdFriendAccept:
+		res = data.AcceptFriendRequest(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdFriendDecline:
+		res = data.DeclineFriendRequest(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdFriendRemove:
+		res = data.RemoveFriend(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdFriendList:
+		res = data.GetFriendList(header, bodyFactories, isSecureConnection)
+		break
+
+	// Administration Commands
+	case policy.CmdRevokeUser:
+		res = data.RevokeUser(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdSetRole:
+		res = data.SetUserRole(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdUnlockUser:
+		res = data.UnlockLogin(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdAuditQuery:
+		res = data.QueryAuditLog(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdGameQuota:
+		res = data.SetGameQuota(header, bodyFactories, isSecureConnection)
+		break
+
+	// Matchmaking Commands
+	case policy.CmdMatchQueue:
+		res = data.QueueForMatch(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdMatchCancel:
+		res = data.CancelMatch(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdMatchStatus:
+		res = data.GetMatchStatus(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdRatingGet:
+		res = data.GetRatingCommand(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdRatingLog:
+		res = data.GetRatingHistory(header, bodyFactories, isSecureConnection)
+		break
+
+	case policy.CmdLeaderboard:
+		res = data.GetLeaderboard(header, bodyFactories, isSecureConnection)
+		break
+
 	default:
 		return nil, errors.New("Command is Not Defined!")
 	}
@@ -172,4 +172,10 @@ func TestParseAttachmentBody(t *testing.T) {
 		fooey.Baz != fooeyAssert.Baz {
 		t.Errorf("Expected %v does not match actual %v\n", attachment, attachmentAssert)
 	}
+
+	emptySlice := marshalled[len(marshalled):]
+	err = parseBody(&fooeyAssert, prefix, &emptySlice)
+	if err != policy.ErrEmptyBody {
+		t.Errorf("Expected %v for an Empty Body but got %v!\n", policy.ErrEmptyBody, err)
+	}
 }
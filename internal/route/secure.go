@@ -31,8 +31,18 @@ var tlsConfig tls.Config = tls.Config{}
 // This Map is a Set!
 // This should never change during runtime!
 var secureMap map[policy.ClientCmd]bool = map[policy.ClientCmd]bool{
-	policy.CmdRegister: true,
-	policy.CmdLogin:    true,
+	policy.CmdRegister:   true,
+	policy.CmdLogin:      true,
+	policy.CmdLoginOIDC:  true,
+	policy.CmdLoginGuest: true,
+	policy.CmdForgotPass: true,
+	policy.CmdResetPass:  true,
+	policy.CmdChangePass: true,
+	policy.CmdChangeName: true,
+	policy.CmdDeleteAcct: true,
+	policy.CmdUpgrade:    true,
+	policy.CmdSetEmail:   true,
+	policy.CmdKeyCreate:  true,
 }
 
 // ServerTask Startup Function for Encryption. Takes care of initialization.
@@ -1,95 +1,353 @@
 package route
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/data"
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/util"
 )
 
+//// Configurables
+
+//
+// Signing Schemes
+
+// Legacy Signing Scheme. sha256(body + token + counter)
+const SigVersionLegacy int = 0
+
+// HMAC Signing Scheme. HMAC-SHA256 keyed with the token over
+// a canonical string of the request (see canonicalRequestString)
+const SigVersionHMAC int = 1
+
+// Stateless Signing Scheme. Same as the HMAC Signing Scheme, but keyed
+// with the session secret of a Stateless Token (see data.IssueStatelessToken)
+// sent with the request. The counter is always 0. Each signature is only
+// accepted once (see data.ConsumeStatelessNonce) so clients sending the
+// same request twice must sign it with different timestamps.
+const SigVersionStateless int = 2
+
+// API Key Scheme. The API Key (see data.CreateAPIKey) is sent as the
+// token in place of a signature, so it is only accepted over a secure
+// connection. The key must allow the command and may be limited to an
+// IP Address.
+const SigVersionAPIKey int = 3
+
+// Commands which can be used with an API Key. Sessions, credentials,
+// API Keys, and administration are left out, so a leaked key can not
+// take over the account or be used to make more keys.
+//
+// This Map is a Set!
+// This should never change during runtime!
+var apiKeyAllowedCmds map[policy.ClientCmd]bool = map[policy.ClientCmd]bool{
+	policy.CmdAction:        true,
+	policy.CmdObserve:       true,
+	policy.CmdGetUser:       true,
+	policy.CmdGetProfile:    true,
+	policy.CmdSetProfile:    true,
+	policy.CmdGameCreate:    true,
+	policy.CmdGameJoin:      true,
+	policy.CmdGameLeave:     true,
+	policy.CmdGameDelete:    true,
+	policy.CmdGameList:      true,
+	policy.CmdGameConfig:    true,
+	policy.CmdGameInvite:    true,
+	policy.CmdGameResult:    true,
+	policy.CmdGameLog:       true,
+	policy.CmdGameOwner:     true,
+	policy.CmdGameKick:      true,
+	policy.CmdGameBan:       true,
+	policy.CmdFriendRequest: true,
+	policy.CmdFriendAccept:  true,
+	policy.CmdFriendDecline: true,
+	policy.CmdFriendRemove:  true,
+	policy.CmdFriendList:    true,
+	policy.CmdMatchQueue:    true,
+	policy.CmdMatchCancel:   true,
+	policy.CmdMatchStatus:   true,
+	policy.CmdRatingGet:     true,
+	policy.CmdRatingLog:     true,
+	policy.CmdLeaderboard:   true,
+}
+
+// Prefix Line for the Canonical String of HMAC Signatures
+const SigHMACAlgorithm string = "LAPLACE-HMAC-SHA256"
+
+// Whether Legacy Signatures are accepted. This should be turned off
+// once all clients have moved to the HMAC Signing Scheme.
+var AcceptLegacySignatures bool = true
+
+// Largest difference between a signed request's timestamp and the
+// server's clock before the request is rejected as stale.
+const SignatureTimestampSkew time.Duration = 30 * time.Second
+
 // Typical Verification of users for authentication. Used in most
 // other endpoints as SigVerify in RequestBodyFactories
 //
-// Takes the authID, Signature (hash of token and content), and content
-// to see if the user can indeed make the request (they are who they say
-// they are).
+// Takes the header (UserID, Signature, Signing Scheme and Timestamp),
+// and content to see if the user can indeed make the request (they are
+// who they say they are). The signature may be made with any unused
+// counter in the acceptance window (see data.TokenCounterWindow). The
+// matched counter is consumed atomically so a replayed request is
+// rejected. Verified requests count as activity for presence
+// (see data.RecordActivity). Failed requests which sent a signature
+// or token are added to the Audit Log.
 //
 // returns an error if they are not who they say they are.
-func SigVerification(authID string, signature string, content *[]byte) error {
-	token, err := data.GetToken(authID)
-	if err != nil {
-		log.Printf("Error in Signature Verification! AuthID:%s\tSignature:%s\nErr: %v\n", authID, signature, err)
+func SigVerification(header policy.RequestHeader, content *[]byte) error {
+	err := verifySignature(header, content)
+	if err == nil {
+		data.RecordActivity(header.UserID)
+	} else if header.Sig != "" || header.Token != "" {
+		data.RecordAudit(data.AuditEvent{
+			Event:   data.AuditSignatureFailure,
+			Actor:   header.UserID,
+			IP:      header.RemoteAddr,
+			Outcome: data.AuditFailure,
+			Detail:  err.Error(),
+		})
 	}
 
-	tokenByte := []byte(token.Token)
-	counterByte := []byte(fmt.Sprintf("%d", token.Uses))
+	return err
+}
 
-	if token.Stale.Before(time.Now().UTC()) {
-		return errors.New("Token Is Stale!")
+// Verifies the signature using the Signing Scheme from the header
+// (see SigVerification).
+func verifySignature(header policy.RequestHeader, content *[]byte) error {
+	switch header.SigVersion {
+	case SigVersionLegacy:
+		if !AcceptLegacySignatures {
+			return errors.New("Legacy Signatures Are Not Accepted!")
+		}
+
+		return verifyWithToken(header.UserID, header.Sig, func(token *[]byte, counter int) (string, error) {
+			return legacyChecksum(token, content, counter)
+		})
+
+	case SigVersionHMAC:
+		err := checkTimestamp(header.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		return verifyWithToken(header.UserID, header.Sig, func(token *[]byte, counter int) (string, error) {
+			return hmacChecksum(token, header, content, counter)
+		})
+
+	case SigVersionStateless:
+		err := checkTimestamp(header.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		return verifyStateless(header, content)
+
+	case SigVersionAPIKey:
+		return verifyAPIKey(header)
 	}
 
-	contentLen := len(*content)
-	tokenLen := len(tokenByte)
-	counterLen := len(counterByte)
+	return errors.New("Unknown Signature Version!")
+}
 
-	input := make([]byte, contentLen+tokenLen+counterLen)
-	err = util.Concat(&input, content, 0)
+// Rejects a request if its timestamp is too far from the server's clock
+// (see SignatureTimestampSkew).
+func checkTimestamp(timestamp int64) error {
+	signedAt := time.Unix(timestamp, 0)
+	now := time.Now().UTC()
+	if signedAt.Before(now.Add(-SignatureTimestampSkew)) || signedAt.After(now.Add(SignatureTimestampSkew)) {
+		return errors.New("Signature Timestamp Is Stale!")
+	}
+
+	return nil
+}
+
+// Verifies the Stateless Token sent with the request and compares the
+// signature against one made with the token's session secret. The
+// signature is then recorded so a replayed request is rejected.
+func verifyStateless(header policy.RequestHeader, content *[]byte) error {
+	claims, err := data.VerifyStatelessToken(header.Token)
 	if err != nil {
 		return err
+	} else if claims.UserID != header.UserID {
+		return errors.New("Token Does Not Belong To User!")
 	}
 
-	err = util.Concat(&input, &tokenByte, contentLen)
+	secret := data.SessionSecret(claims.SessionID)
+	expected, err := hmacChecksum(&secret, header, content, 0)
 	if err != nil {
 		return err
 	}
 
-	err = util.Concat(&input, &counterByte, contentLen+tokenLen)
+	if !hmac.Equal([]byte(header.Sig), []byte(expected)) {
+		return errors.New("Signature is Incorrect!")
+	}
+
+	return data.ConsumeStatelessNonce(claims.SessionID, header.Sig)
+}
+
+// Lets API Keys be created for the commands they can be used with
+// (see apiKeyAllowedCmds and data.APIKeyCommandCodes)
+func registerAPIKeyCommands() error {
+	for cmd := range apiKeyAllowedCmds {
+		code, err := CommandCode(cmd)
+		if err != nil {
+			return err
+		}
+
+		data.APIKeyCommandCodes[code] = true
+	}
+
+	return nil
+}
+
+// Verifies the API Key sent with the request allows the request's user,
+// command, and IP Address.
+func verifyAPIKey(header policy.RequestHeader) error {
+	if !apiKeyAllowedCmds[header.Command] {
+		return errors.New("Command Can Not Be Used With an API Key!")
+	}
+
+	code, err := CommandCode(header.Command)
 	if err != nil {
 		return err
 	}
 
-	checksumByte := sha256.Sum256(input)
-	checksum := base64.RawStdEncoding.EncodeToString(checksumByte[:])
+	return data.VerifyAPIKey(header.Token, header.UserID, code, header.RemoteAddr)
+}
+
+// Loads the user's token and compares the signature against the
+// checksum for each available counter. The matched counter is consumed.
+//
+// authID    :: Unique Identifier for a user
+// signature :: Signature sent with the request
+// checksum  :: Function computing the expected signature for a counter
+func verifyWithToken(authID string, signature string, checksum func(token *[]byte, counter int) (string, error)) error {
+	token, err := data.GetToken(authID)
+	if err != nil {
+		log.Printf("Error in Signature Verification! AuthID:%s\nErr: %v\n", authID, err)
+		return errors.New("Token Could Not Be Loaded!")
+	}
+
+	if token.IsRevoked() {
+		return errors.New("Token Has Been Revoked!")
+	} else if token.Stale.Before(time.Now().UTC()) {
+		return errors.New("Token Is Stale!")
+	}
+
+	tokenByte := []byte(token.Token)
 
-	if signature == checksum {
-		return data.IncrementTokenUses(authID, token.Uses)
+	for _, counter := range token.AvailableCounters() {
+		expected, err := checksum(&tokenByte, counter)
+		if err != nil {
+			return err
+		}
+
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return data.ConsumeTokenUse(authID, token, counter)
+		}
 	}
 
-	return errors.New(fmt.Sprintf("Signature is Incorrect!: %s vs %s", signature, checksum))
+	return errors.New("Signature is Incorrect!")
 }
 
-func TestHelperGenSig(token *[]byte, content string, counter int) string {
-	counterString := fmt.Sprintf("%d", counter)
+// Copies the header with the given UserID and Signature. SigVerify is
+// given these separately from the header.
+func signedHeader(header policy.RequestHeader, userID string, userSig string) policy.RequestHeader {
+	header.UserID = userID
+	header.Sig = userSig
+	return header
+}
 
-	counterByte := []byte(counterString)
-	contentByte := []byte(content)
+// Computes the base64 sha256 checksum of the content, token and counter
+// concatenated together.
+func legacyChecksum(token *[]byte, content *[]byte, counter int) (string, error) {
+	counterByte := []byte(fmt.Sprintf("%d", counter))
 
-	contentLen := len(contentByte)
+	contentLen := len(*content)
 	tokenLen := len(*token)
 	counterLen := len(counterByte)
 
 	input := make([]byte, contentLen+tokenLen+counterLen)
-	err := util.Concat(&input, &contentByte, 0)
+	err := util.Concat(&input, content, 0)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	err = util.Concat(&input, token, contentLen)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	err = util.Concat(&input, &counterByte, contentLen+tokenLen)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	checksumByte := sha256.Sum256(input)
-	checksum := base64.RawStdEncoding.EncodeToString(checksumByte[:])
+	return base64.RawStdEncoding.EncodeToString(checksumByte[:]), nil
+}
+
+// Computes the base64 HMAC-SHA256 of the canonical request string using
+// the token as the key.
+func hmacChecksum(token *[]byte, header policy.RequestHeader, content *[]byte, counter int) (string, error) {
+	canonical, err := canonicalRequestString(header.Command, header.UserID, header.Timestamp, counter, content)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, *token)
+	mac.Write([]byte(canonical))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Builds the string signed by the HMAC Signing Scheme. Each field is on
+// its own line:
+//
+//   LAPLACE-HMAC-SHA256
+//   command code (see CommandCode) in decimal
+//   user ID
+//   timestamp in unix seconds
+//   counter
+//   hex sha256 of the body
+func canonicalRequestString(cmd policy.ClientCmd, userID string, timestamp int64, counter int, content *[]byte) (string, error) {
+	code, err := CommandCode(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	bodyHash := sha256.Sum256(*content)
+
+	return fmt.Sprintf("%s\n%d\n%s\n%d\n%d\n%s", SigHMACAlgorithm, code, userID, timestamp, counter, hex.EncodeToString(bodyHash[:])), nil
+}
+
+// Generates a signature the way a client would. Only meant for tests.
+func TestHelperGenSig(token *[]byte, content string, counter int) string {
+	contentByte := []byte(content)
+
+	checksum, err := legacyChecksum(token, &contentByte, counter)
+	if err != nil {
+		return ""
+	}
+
+	return checksum
+}
+
+// Generates a HMAC signature the way a client would. Only meant for tests.
+func TestHelperGenHMACSig(token *[]byte, cmd policy.ClientCmd, userID string, timestamp int64, content string, counter int) string {
+	contentByte := []byte(content)
+	header := policy.RequestHeader{Command: cmd, UserID: userID, Timestamp: timestamp}
+
+	checksum, err := hmacChecksum(token, header, &contentByte, counter)
+	if err != nil {
+		return ""
+	}
+
 	return checksum
 }
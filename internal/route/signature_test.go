@@ -1,8 +1,10 @@
 package route
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/data"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/policy"
@@ -82,7 +84,7 @@ func TestSigVerify(t *testing.T) {
 	contentByte := []byte(content)
 	signature := TestHelperGenSig(&token, content, counter)
 	// Remember, each success increments counter!
-	err = SigVerification(authResponse.AuthID, signature, &contentByte)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: signature}, &contentByte)
 	if err != nil {
 		t.Errorf("Error Verifying Signature! Err: %v\n", err)
 	}
@@ -90,7 +92,7 @@ func TestSigVerify(t *testing.T) {
 	counter += 1
 
 	signature = TestHelperGenSig(&token, content, counter)
-	err = SigVerification(authResponse.AuthID, signature, &contentByte)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: signature}, &contentByte)
 	if err != nil {
 		t.Errorf("Error Verifying Signature! Err: %v\n", err)
 	}
@@ -98,7 +100,7 @@ func TestSigVerify(t *testing.T) {
 	counter += 1
 
 	signature = TestHelperGenSig(&token, content, counter)
-	err = SigVerification(authResponse.AuthID, signature, &contentByte)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: signature}, &contentByte)
 	if err != nil {
 		t.Errorf("Error Verifying Signature! Err: %v\n", err)
 	}
@@ -106,20 +108,20 @@ func TestSigVerify(t *testing.T) {
 	counter += 1
 
 	signature = TestHelperGenSig(&token, content, counter)
-	err = SigVerification(authResponse.AuthID, signature, &contentByte)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: signature}, &contentByte)
 	if err != nil {
 		t.Errorf("Error Verifying Signature! Err: %v\n", err)
 	}
 
 	// Bad Signature Results in Error
 	signature = TestHelperGenSig(&token, content, counter)
-	err = SigVerification(authResponse.AuthID, signature, &contentByte)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: signature}, &contentByte)
 	if err == nil {
 		t.Errorf("No Error In Verifying Bad Signature!")
 	}
 
 	empty := []byte{}
-	err = SigVerification(authResponse.AuthID, "", &empty)
+	err = SigVerification(policy.RequestHeader{UserID: authResponse.AuthID, Sig: ""}, &empty)
 	if err == nil {
 		t.Errorf("No Error In Verifying Bad Signature!")
 	}
@@ -132,3 +134,386 @@ func TestSigVerify(t *testing.T) {
 		t.Errorf("User did not exist upon deletion!\n")
 	}
 }
+
+func TestSigVerifyReplay(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			data.StartUsers,
+		})
+	defer cleanup()
+
+	username := testUserNamePrefix + "REPLAY"
+	password := "SomeP@ssword123"
+	data.DeleteUser(username)
+
+	authID, token := sigTestLoginHelper(t, username, password)
+	content := "derp1234!@#$"
+	contentByte := []byte(content)
+
+	// Concurrent requests with the same counter only pass once
+	signature := TestHelperGenSig(&token, content, 0)
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			results <- SigVerification(policy.RequestHeader{UserID: authID, Sig: signature}, &contentByte)
+		}()
+	}
+
+	passed := 0
+	for i := 0; i < 10; i++ {
+		if <-results == nil {
+			passed += 1
+		}
+	}
+
+	if passed != 1 {
+		t.Errorf("Same Signature Passed Verification %d times!\n", passed)
+	}
+
+	// Out of order requests are rejected without a window
+	signature = TestHelperGenSig(&token, content, 2)
+	err := SigVerification(policy.RequestHeader{UserID: authID, Sig: signature}, &contentByte)
+	if err == nil {
+		t.Errorf("Out of Order Signature Passed Without a Window!\n")
+	}
+
+	// Out of order requests inside the window pass once
+	data.TokenCounterWindow = 4
+	defer func() { data.TokenCounterWindow = 1 }()
+
+	for _, counter := range []int{2, 1, 4, 3} {
+		signature = TestHelperGenSig(&token, content, counter)
+		err = SigVerification(policy.RequestHeader{UserID: authID, Sig: signature}, &contentByte)
+		if err != nil {
+			t.Errorf("Error Verifying Signature With Counter %d! Err: %v\n", counter, err)
+		}
+
+		err = SigVerification(policy.RequestHeader{UserID: authID, Sig: signature}, &contentByte)
+		if err == nil {
+			t.Errorf("Replayed Signature With Counter %d Passed!\n", counter)
+		}
+	}
+
+	// Counters beyond the window are rejected
+	signature = TestHelperGenSig(&token, content, 9)
+	err = SigVerification(policy.RequestHeader{UserID: authID, Sig: signature}, &contentByte)
+	if err == nil {
+		t.Errorf("Signature Outside of Window Passed!\n")
+	}
+
+	data.DeleteUser(username)
+}
+
+// Registers and Logs in a user returning their AuthID and Token
+func sigTestLoginHelper(t *testing.T, username string, password string) (string, []byte) {
+	regBody := data.RegisterCommandBody{Username: username, Password: password}
+	req, err := policy.RequestWithUserForTesting("", false, policy.CmdRegister, regBody)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response := data.Register(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Errorf("Failure to Register user! Err: %v\n", response.ServerError)
+	}
+
+	loginBody := data.LoginCommandBody{Username: username, Password: password}
+	req, err = policy.RequestWithUserForTesting("", false, policy.CmdLogin, loginBody)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response = data.Login(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Errorf("Failure to Login user! Err: %v\n", response.ServerError)
+	}
+
+	token, err := util.Base64Decode(&response.Raw)
+	if err != nil {
+		t.Errorf("Base64 Did Not Decode Correctly! Err: %v\n", err)
+	}
+
+	getUserBody := data.GetUserCommandBody{Username: username}
+	req, err = policy.RequestWithUserForTesting("", false, policy.CmdGetUser, getUserBody)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response = data.GetUser(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Errorf("Failure to Get user! Err: %v\n", response.ServerError)
+	}
+
+	var authResponse data.UserInfo
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+
+	err = json.Unmarshal(bytes, &authResponse)
+	if err != nil {
+		t.Fatalf("Error Unmarshalling Response! Err: %v\n", err)
+	}
+
+	return authResponse.AuthID, token
+}
+
+func TestSigVerifyHMAC(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			data.StartUsers,
+		})
+	defer cleanup()
+
+	username := testUserNamePrefix + "HMAC"
+	password := "SomeP@ssword123"
+	data.DeleteUser(username)
+
+	authID, token := sigTestLoginHelper(t, username, password)
+	content := "{\"GameID\":\"derp\"}"
+	contentByte := []byte(content)
+	now := time.Now().UTC().Unix()
+	counter := 0
+
+	header := policy.RequestHeader{
+		Command:    policy.CmdGameJoin,
+		UserID:     authID,
+		SigVersion: SigVersionHMAC,
+		Timestamp:  now,
+	}
+
+	// Valid Signature
+	header.Sig = TestHelperGenHMACSig(&token, header.Command, authID, now, content, counter)
+	err := SigVerification(header, &contentByte)
+	if err != nil {
+		t.Errorf("Error Verifying HMAC Signature! Err: %v\n", err)
+	}
+	counter += 1
+
+	// Signature for a different command is rejected
+	header.Sig = TestHelperGenHMACSig(&token, policy.CmdGameLeave, authID, now, content, counter)
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("HMAC Signature for a Different Command Passed!\n")
+	}
+
+	// Signature for a different user is rejected
+	header.Sig = TestHelperGenHMACSig(&token, header.Command, "0", now, content, counter)
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("HMAC Signature for a Different User Passed!\n")
+	}
+
+	// Stale Timestamps are rejected
+	stale := now - int64(2*SignatureTimestampSkew/time.Second)
+	header.Timestamp = stale
+	header.Sig = TestHelperGenHMACSig(&token, header.Command, authID, stale, content, counter)
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("HMAC Signature with a Stale Timestamp Passed!\n")
+	}
+	header.Timestamp = now
+
+	// Legacy Signatures are rejected when turned off
+	AcceptLegacySignatures = false
+	defer func() { AcceptLegacySignatures = true }()
+
+	legacy := policy.RequestHeader{UserID: authID, Sig: TestHelperGenSig(&token, content, counter)}
+	err = SigVerification(legacy, &contentByte)
+	if err == nil {
+		t.Errorf("Legacy Signature Passed When Turned Off!\n")
+	}
+
+	// HMAC Signatures still pass
+	header.Sig = TestHelperGenHMACSig(&token, header.Command, authID, now, content, counter)
+	err = SigVerification(header, &contentByte)
+	if err != nil {
+		t.Errorf("Error Verifying HMAC Signature! Err: %v\n", err)
+	}
+
+	data.DeleteUser(username)
+}
+
+func TestSigVerifyStateless(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			data.StartSessions,
+		})
+	defer cleanup()
+
+	authID := testUserNamePrefix + "STATELESS"
+	session, err := data.IssueStatelessToken(authID)
+	if err != nil {
+		t.Fatalf("Error Issuing Stateless Token! Err: %v\n", err)
+	}
+
+	secret, err := base64.RawStdEncoding.DecodeString(session.Secret)
+	if err != nil {
+		t.Fatalf("Error Decoding Session Secret! Err: %v\n", err)
+	}
+
+	content := "{\"GameID\":\"derp\"}"
+	contentByte := []byte(content)
+	now := time.Now().UTC().Unix()
+
+	header := policy.RequestHeader{
+		Command:    policy.CmdGameJoin,
+		UserID:     authID,
+		SigVersion: SigVersionStateless,
+		Timestamp:  now,
+		Token:      session.Token,
+	}
+
+	// Valid Signature
+	header.Sig = TestHelperGenHMACSig(&secret, header.Command, authID, now, content, 0)
+	err = SigVerification(header, &contentByte)
+	if err != nil {
+		t.Errorf("Error Verifying Stateless Signature! Err: %v\n", err)
+	}
+
+	// Replayed Signature is rejected
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("Replayed Stateless Signature Passed!\n")
+	}
+
+	// Token for a different user is rejected
+	other := header
+	other.UserID = "0"
+	other.Sig = TestHelperGenHMACSig(&secret, header.Command, "0", now, content, 0)
+	err = SigVerification(other, &contentByte)
+	if err == nil {
+		t.Errorf("Stateless Signature for a Different User Passed!\n")
+	}
+
+	// Signature made without the session secret is rejected
+	header.Sig = TestHelperGenHMACSig(&contentByte, header.Command, authID, now, content, 0)
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("Stateless Signature with the Wrong Secret Passed!\n")
+	}
+
+	// Revoked Sessions are rejected
+	claims, err := data.ParseStatelessToken(session.Token)
+	if err != nil {
+		t.Fatalf("Error Parsing Stateless Token! Err: %v\n", err)
+	}
+
+	err = data.RevokeSession(claims)
+	if err != nil {
+		t.Fatalf("Error Revoking Session! Err: %v\n", err)
+	}
+
+	header.Timestamp = now + 1
+	header.Sig = TestHelperGenHMACSig(&secret, header.Command, authID, now+1, content, 0)
+	err = SigVerification(header, &contentByte)
+	if err == nil {
+		t.Errorf("Stateless Signature for a Revoked Session Passed!\n")
+	}
+}
+
+func TestSigVerifyAPIKey(t *testing.T) {
+	cleanup := startup.InitServerStartupOnTaskList(
+		[]startup.ServerTask{
+			redis.StartDatabase,
+			data.StartUsers,
+		})
+	defer cleanup()
+
+	username := testUserNamePrefix + "APIKEY"
+	password := "SomeP@ssword123"
+	data.DeleteUser(username)
+
+	err := registerAPIKeyCommands()
+	if err != nil {
+		t.Fatalf("Error Registering API Key Commands! Err: %v\n", err)
+	}
+
+	authID, _ := sigTestLoginHelper(t, username, password)
+	joinCode, _ := CommandCode(policy.CmdGameJoin)
+	createCode, _ := CommandCode(policy.CmdKeyCreate)
+
+	// API Keys can not be created for commands they can not be used with
+	body := data.CreateAPIKeyCommandBody{Commands: []int64{joinCode, createCode}}
+	req, err := policy.RequestWithUserForTesting(authID, false, policy.CmdKeyCreate, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response := data.CreateAPIKey(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure to Create API Key! Err: %v\n", response.ServerError)
+	}
+
+	var rejected data.CreatedAPIKey
+	bytes, err := response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &rejected)
+	if rejected.Key != "" {
+		t.Errorf("API Key was Created for a Command it can not be Used With!\n")
+	}
+
+	body = data.CreateAPIKeyCommandBody{Commands: []int64{joinCode}}
+	req, err = policy.RequestWithUserForTesting(authID, false, policy.CmdKeyCreate, body)
+	if err != nil {
+		t.Errorf("Failure to create Request! Err: %v\n", err)
+	}
+
+	response = data.CreateAPIKey(req.Header, req.BodyFactories, req.IsSecureConnection)
+	if response.ServerError != nil {
+		t.Fatalf("Failure to Create API Key! Err: %v\n", response.ServerError)
+	}
+
+	var created data.CreatedAPIKey
+	bytes, err = response.Digest(response.Data)
+	if err != nil {
+		t.Errorf("Error Digesting Response! Err: %v\n", err)
+	}
+	json.Unmarshal(bytes, &created)
+
+	content := []byte("{\"GameID\":\"derp\"}")
+	header := policy.RequestHeader{
+		Command:    policy.CmdGameJoin,
+		UserID:     authID,
+		SigVersion: SigVersionAPIKey,
+		Token:      created.Key,
+	}
+
+	// Allowed Command
+	err = SigVerification(header, &content)
+	if err != nil {
+		t.Errorf("Error Verifying API Key! Err: %v\n", err)
+	}
+
+	// API Keys can never make more API Keys
+	header.Command = policy.CmdKeyCreate
+	err = SigVerification(header, &content)
+	if err == nil {
+		t.Errorf("API Key was Used to Create an API Key!\n")
+	}
+
+	// API Keys can not manage the account or administrate
+	for _, cmd := range []policy.ClientCmd{policy.CmdDeleteAcct, policy.CmdChangePass, policy.CmdSetRole} {
+		header.Command = cmd
+		err = SigVerification(header, &content)
+		if err == nil {
+			t.Errorf("API Key was Used for Command %d!\n", cmd)
+		}
+	}
+
+	// API Keys are only accepted over secure connections
+	header.Command = policy.CmdGameJoin
+	res, err := switchOnCommand(header, policy.RequestBodyFactories{}, false)
+	if err != nil {
+		t.Errorf("Error Switching on Command! Err: %v\n", err)
+	} else if string(res) != string(util.NewErrorJson("Unsecure Connection!")) {
+		t.Errorf("API Key was Accepted Over an Unsecure Connection! Response: %s\n", res)
+	}
+
+	data.DeleteUser(username)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/data"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/event"
 	"github.com/Laplace-Game-Development/Laplace-Entangled-Environment/internal/redis"
 	"github.com/mediocregopher/radix/v3"
@@ -26,6 +27,10 @@ type CronEvent struct {
 // functions to be run.
 var initialCronLedger []CronEvent = []CronEvent{
 	{"5 * * * * *", eventCheckHealth},
+	{"0 */10 * * * *", eventExpireGuests},
+	{"0 0 * * * *", eventTrimAuditLog},
+	{"*/10 * * * * *", eventMatchmaking},
+	{"0 0 0 1 * *", eventLeaderboardSeason},
 }
 
 //// Global Variables | Singletons
@@ -116,3 +121,66 @@ func eventCheckHealth() {
 		log.Fatalf("Trouble Using Health Event! Error: %v", err.Error())
 	}
 }
+
+// Function added through the "initialCronLedger." Deletes guest accounts
+// which have not been active recently (see data.ExpireGuests).
+func eventExpireGuests() {
+	expired, err := data.ExpireGuests()
+	if err != nil {
+		log.Printf("Trouble Expiring Guests! Error: %v\n", err)
+	}
+
+	if expired > 0 {
+		log.Printf("Expired %d Guest Accounts\n", expired)
+	}
+}
+
+// Function added through the "initialCronLedger." Removes events older
+// than the retention from the Audit Log (see data.TrimAuditLog).
+func eventTrimAuditLog() {
+	removed, err := data.TrimAuditLog()
+	if err != nil {
+		log.Printf("Trouble Trimming Audit Log! Error: %v\n", err)
+	}
+
+	if removed > 0 {
+		log.Printf("Trimmed %d Audit Events\n", removed)
+	}
+}
+
+// Function added through the "initialCronLedger." Sends each matchmaking
+// queue with waiting players to the Workers. See matchTaskWork to see
+// how this data is used.
+func eventMatchmaking() {
+	queues, err := data.MatchQueues()
+	if err != nil {
+		log.Printf("Trouble Finding Match Queues! Error: %v\n", err)
+		return
+	} else if len(queues) == 0 {
+		return
+	}
+
+	tasks := make([]string, len(queues))
+	for i, queue := range queues {
+		tasks[i] = constructTaskWithPrefix(MatchTaskPrefix, queue)
+	}
+
+	err = SendTasksToWorkers(tasks...)
+	if err != nil {
+		log.Printf("Trouble Using Matchmaking Event! Error: %v\n", err)
+	}
+}
+
+// Function added through the "initialCronLedger." Archives the current
+// leaderboard season and starts a new one at the start of each month
+// (see data.StartLeaderboardSeason).
+func eventLeaderboardSeason() {
+	season, err := data.StartLeaderboardSeason()
+	if err != nil {
+		log.Printf("Trouble Starting Leaderboard Season! Error: %v\n", err)
+	}
+
+	if season > 0 {
+		log.Printf("Started Leaderboard Season %d\n", season)
+	}
+}
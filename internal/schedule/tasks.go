@@ -53,6 +53,9 @@ const MagicRune rune = '~'
 // Game Health Checking to garbage collect game data
 const HealthTaskPrefix string = "healthTask"
 
+// Matching players waiting in a matchmaking queue
+const MatchTaskPrefix string = "matchTask"
+
 // Unit Testing Prefix for adding to the database using workers
 const TestTaskPrefix string = "unitTest0"
 
@@ -359,6 +362,7 @@ func SendTasksToWorkers(msgs ...string) error {
 // required data to call a function in the event module. These are called and used by workers.
 var mapPrefixToWork map[string]func([]string) error = map[string]func([]string) error{
 	HealthTaskPrefix: healthTaskWork,
+	MatchTaskPrefix:  matchTaskWork,
 	TestTaskPrefix:   testTaskWork,
 }
 
@@ -399,12 +403,12 @@ func healthTaskWork(args []string) error {
 	}
 
 	if gameTime.Add(policy.StaleGameDuration).Before(time.Now().UTC()) {
-		superUserRequest, err := policy.RequestWithSuperUser(true, policy.CmdGameDelete, data.SelectGameArgs{GameID: args[0]})
+		serviceRequest, err := policy.RequestWithServiceUser(true, policy.CmdGameDelete, data.SelectGameArgs{GameID: args[0]})
 		if err != nil {
 			return err
 		}
 
-		resp := data.DeleteGame(superUserRequest.Header, superUserRequest.BodyFactories, superUserRequest.IsSecureConnection)
+		resp := data.DeleteGame(serviceRequest.Header, serviceRequest.BodyFactories, serviceRequest.IsSecureConnection)
 		if resp.ServerError != nil {
 			return resp.ServerError
 		}
@@ -416,6 +420,24 @@ func healthTaskWork(args []string) error {
 	return nil
 }
 
+// Matches the players waiting in a matchmaking queue (see
+// data.RunMatchmaking).
+//
+// args :: the data from the msg
+// args[0] :: name of the matchmaking queue
+func matchTaskWork(args []string) error {
+	if len(args) < 1 {
+		return errors.New("Task Did Not Receive Match Queue!")
+	}
+
+	matches, err := data.RunMatchmaking(args[0])
+	if matches > 0 {
+		log.Printf("Created %d Matches in Queue %s\n", matches, args[0])
+	}
+
+	return err
+}
+
 // Adds a given set of arguments to the redis database for testing
 //
 // args:: the data from the msg